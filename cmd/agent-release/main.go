@@ -0,0 +1,133 @@
+// Command agent-release manages the ed25519 key agent builds are signed
+// with and signs build manifests for the controller's release store.
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"teleport_lite/internal/agentupdate"
+)
+
+const usage = `usage: agent-release <command>
+
+commands:
+  keygen --key release.key        create a signing key and print its public key
+  pubkey --key release.key        print the public key for update_public_key
+  sign --key release.key --version 1.4.0 <file>…
+                                  write <file>.manifest and its <file>.sig
+                                  for each teleport-agent-<os>-<arch> build
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	keyPath := fs.String("key", "release.key", "signing key file")
+	version := fs.String("version", "", "version the builds report (sign)")
+	fs.Parse(args)
+
+	var err error
+	switch cmd {
+	case "keygen":
+		err = keygen(*keyPath)
+	case "pubkey":
+		var key ed25519.PrivateKey
+		if key, err = readKey(*keyPath); err == nil {
+			fmt.Println(base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+		}
+	case "sign":
+		err = sign(*keyPath, *version, fs.Args())
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+}
+
+func keygen(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(priv.Seed())+"\n"), 0600); err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(pub))
+	return nil
+}
+
+// readKey reads a key written by keygen: the base64 ed25519 seed.
+func readKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s is not a signing key", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// sign writes a manifest of each build's version, platform and SHA-256,
+// taking the platform from the file name, and signs the manifest.
+func sign(keyPath, version string, files []string) error {
+	if !agentupdate.ValidVersion(version) {
+		return errors.New("--version must be set to the version the builds report")
+	}
+	if len(files) == 0 {
+		return errors.New("no files to sign")
+	}
+	key, err := readKey(keyPath)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		goos, goarch, ok := platform(filepath.Base(f))
+		if !ok {
+			return fmt.Errorf("%s is not named %s", f, agentupdate.BinaryName("<os>", "<arch>"))
+		}
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		manifest, _ := json.Marshal(agentupdate.NewManifest(version, goos, goarch, data))
+		if err := os.WriteFile(f+".manifest", manifest, 0644); err != nil {
+			return err
+		}
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, manifest))
+		if err := os.WriteFile(f+".sig", []byte(sig+"\n"), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("✅ signed %s as %s for %s/%s\n", f, version, goos, goarch)
+	}
+	return nil
+}
+
+// platform parses the os and arch out of a build's file name.
+func platform(name string) (goos, goarch string, ok bool) {
+	rest, ok := strings.CutPrefix(name, "teleport-agent-")
+	if !ok {
+		return "", "", false
+	}
+	goos, goarch, ok = strings.Cut(rest, "-")
+	return goos, goarch, ok && goos != "" && goarch != "" && agentupdate.BinaryName(goos, goarch) == name
+}
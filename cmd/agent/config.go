@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"teleport_lite/internal/agentupdate"
+)
+
+// defaultConfigPath is read when --config is not given and the file
+// exists; it is also where `install` writes the config.
+const defaultConfigPath = "/etc/teleport-agent/config.yaml"
+
+// Config is the agent configuration, read from a YAML file. The
+// CONTROLLER_URL, AGENT_REG_TOKEN and AGENT_TUNNEL environment variables
+// override the file, so env-only setups keep working.
+type Config struct {
+	ControllerURL string `yaml:"controller_url"`
+	// RegistrationToken is only needed until the agent is registered.
+	RegistrationToken string `yaml:"registration_token,omitempty"`
+	// TokenFile holds the agent token issued at registration, default
+	// <data_dir>/agent_token.
+	TokenFile string            `yaml:"token_file,omitempty"`
+	Labels    map[string]string `yaml:"labels,omitempty"`
+	// HeartbeatInterval is a Go duration such as "60s".
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	// DataDir holds the agent's SSH key, token and state, default
+	// ~/.teleport-agent.
+	DataDir  string `yaml:"data_dir"`
+	LogLevel string `yaml:"log_level"` // debug, info, warn or error
+	Tunnel   bool   `yaml:"tunnel"`    // keep a reverse tunnel to the controller
+	// HostUsers creates the Unix accounts users may log in as. The agent
+	// must run as root for it.
+	HostUsers HostUsersConfig `yaml:"host_users,omitempty"`
+	// UpdatePublicKey is the base64 ed25519 key release builds are signed
+	// with. The agent only updates itself when it is set.
+	UpdatePublicKey string `yaml:"update_public_key,omitempty"`
+	// SSHServer runs the agent's own SSH server in place of the host's
+	// sshd. The agent must run as root to start sessions as other users.
+	SSHServer SSHServerConfig `yaml:"ssh_server,omitempty"`
+
+	path string // file the config was read from, "" for env only
+}
+
+// HostUsersConfig controls host account provisioning.
+type HostUsersConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// DeleteRevoked removes accounts the agent created once access to
+	// them is revoked; otherwise they only lose sudo.
+	DeleteRevoked bool   `yaml:"delete_revoked,omitempty"`
+	DefaultShell  string `yaml:"default_shell,omitempty"` // default /bin/bash
+}
+
+// SSHServerConfig controls the agent's SSH server.
+type SSHServerConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Listen is the address to accept direct connections on, e.g.
+	// ":3022". Left empty with the tunnel on, only tunnel connections are
+	// served.
+	Listen string `yaml:"listen,omitempty"`
+}
+
+// defaultSSHServerPort is the port the controller asks the tunnel for
+// when the SSH server doesn't listen directly.
+const defaultSSHServerPort = 3022
+
+// port is the port the controller reaches the SSH server on.
+func (c SSHServerConfig) port() int {
+	if _, p, err := net.SplitHostPort(c.Listen); err == nil {
+		if n, err := strconv.Atoi(p); err == nil {
+			return n
+		}
+	}
+	return defaultSSHServerPort
+}
+
+// loadConfig reads path, or defaultConfigPath if path is "" and the file
+// exists, then applies the environment and defaults.
+func loadConfig(path string) (*Config, error) {
+	cfg, err := readConfig(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, cfg.validate()
+}
+
+// readConfig is loadConfig without validation. With optional set a
+// missing file yields the defaults.
+func readConfig(path string, optional bool) (*Config, error) {
+	cfg := &Config{Tunnel: true}
+	if path == "" {
+		if _, err := os.Stat(defaultConfigPath); err == nil {
+			path = defaultConfigPath
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if optional && errors.Is(err, os.ErrNotExist) {
+			data, err = nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		cfg.path = path
+	}
+
+	if v := os.Getenv("CONTROLLER_URL"); v != "" {
+		cfg.ControllerURL = v
+	}
+	if v := os.Getenv("AGENT_REG_TOKEN"); v != "" {
+		cfg.RegistrationToken = v
+	}
+	if os.Getenv("AGENT_TUNNEL") == "off" {
+		cfg.Tunnel = false
+	}
+
+	if cfg.HeartbeatInterval == 0 {
+		cfg.HeartbeatInterval = 60 * time.Second
+	}
+	if cfg.DataDir == "" {
+		usr, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		cfg.DataDir = filepath.Join(usr.HomeDir, ".teleport-agent")
+	}
+	if cfg.TokenFile == "" {
+		cfg.TokenFile = filepath.Join(cfg.DataDir, "agent_token")
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = "info"
+	}
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.ControllerURL == "" {
+		return errors.New("controller_url is not set (config file or CONTROLLER_URL), e.g. http://192.168.1.10:8080")
+	}
+	c.ControllerURL = strings.TrimRight(c.ControllerURL, "/")
+	if c.UpdatePublicKey != "" {
+		if _, err := agentupdate.ParsePublicKey(c.UpdatePublicKey); err != nil {
+			return err
+		}
+	}
+	if c.SSHServer.Enabled {
+		if c.SSHServer.Listen == "" && !c.Tunnel {
+			return errors.New("ssh_server.listen must be set when the tunnel is off, e.g. \":3022\"")
+		}
+		if c.SSHServer.Listen != "" {
+			_, p, err := net.SplitHostPort(c.SSHServer.Listen)
+			if n, perr := strconv.Atoi(p); err != nil || perr != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("invalid ssh_server.listen %q, want host:port such as \":3022\"", c.SSHServer.Listen)
+			}
+		}
+	}
+	if c.HeartbeatInterval < 5*time.Second {
+		return errors.New("heartbeat_interval must be at least 5s")
+	}
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		return fmt.Errorf("unknown log_level %q, want debug, info, warn or error", c.LogLevel)
+	}
+	return nil
+}
+
+// write saves the config as YAML to path.
+func (c *Config) write(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// The registration token is a secret
+	return os.WriteFile(path, data, 0600)
+}
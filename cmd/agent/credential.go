@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+)
+
+// credential is the agent token issued at registration. It is kept in a
+// file so it survives restarts and is replaced when the controller
+// rotates it.
+type credential struct {
+	path  string
+	mu    sync.Mutex
+	token string
+}
+
+func loadCredential(path string) *credential {
+	c := &credential{path: path}
+	if b, err := os.ReadFile(path); err == nil {
+		c.token = strings.TrimSpace(string(b))
+	}
+	return c
+}
+
+// Token returns the current token, "" before the first registration.
+func (c *credential) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// Set stores a new token.
+func (c *credential) Set(token string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := os.WriteFile(c.path, []byte(token+"\n"), 0600); err != nil {
+		return err
+	}
+	c.token = token
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"teleport_lite/internal/provision"
+)
+
+// syncHostUsers fetches the accounts this host should have, reconciles
+// them and reports the outcome to the controller.
+func syncHostUsers(cfg *Config, cred *credential) error {
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	req, _ := http.NewRequest(http.MethodGet, cfg.ControllerURL+"/agents/logins", nil)
+	req.Header.Set("Authorization", "Bearer "+cred.Token())
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	var desired struct {
+		Error  string            `json:"error"`
+		Logins []provision.Login `json:"logins"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&desired)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("desired logins responded with %d: %s", resp.StatusCode, desired.Error)
+	}
+	if err != nil {
+		return err
+	}
+
+	st := loadState(cfg.DataDir)
+	r := provision.Reconciler{
+		DefaultShell:  cfg.HostUsers.DefaultShell,
+		DeleteRevoked: cfg.HostUsers.DeleteRevoked,
+	}
+	results, managed := r.Reconcile(desired.Logins, st.ManagedUsers)
+	st.ManagedUsers = managed
+	if err := st.save(cfg.DataDir); err != nil {
+		warnf("⚠️ failed to save state: %v", err)
+	}
+	for _, res := range results {
+		switch res.Action {
+		case provision.ActionFailed:
+			warnf("⚠️ host user %s: %s", res.Login, res.Error)
+		case provision.ActionUnchanged:
+			debugf("👤 host user %s unchanged", res.Login)
+		default:
+			infof("👤 host user %s %s", res.Login, res.Action)
+		}
+	}
+
+	body, _ := json.Marshal(provision.Report{Results: results, At: time.Now()})
+	req, _ = http.NewRequest(http.MethodPost, cfg.ControllerURL+"/agents/logins/report", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cred.Token())
+	resp, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login report responded with %d", resp.StatusCode)
+	}
+	return nil
+}
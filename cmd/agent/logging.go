@@ -0,0 +1,31 @@
+package main
+
+import "log"
+
+// Log levels, set from the config's log_level.
+const (
+	levelDebug = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevels = map[string]int{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"warn":  levelWarn,
+	"error": levelError,
+}
+
+var logLevel = levelInfo
+
+func logf(level int, format string, args ...interface{}) {
+	if level >= logLevel {
+		log.Printf(format, args...)
+	}
+}
+
+func debugf(format string, args ...interface{}) { logf(levelDebug, format, args...) }
+func infof(format string, args ...interface{})  { logf(levelInfo, format, args...) }
+func warnf(format string, args ...interface{})  { logf(levelWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logf(levelError, format, args...) }
@@ -8,7 +8,8 @@ import (
 	"encoding/json"
 	"encoding/pem"
 
-	//"fmt"
+	"flag"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
@@ -20,6 +21,11 @@ import (
 	"time"
 
 	"golang.org/x/crypto/ssh"
+
+	"teleport_lite/internal/agentssh"
+	"teleport_lite/internal/agentupdate"
+	"teleport_lite/internal/inventory"
+	"teleport_lite/internal/tunnel"
 )
 
 // installAuthorizedKey appends the public key file to the current user's
@@ -77,18 +83,88 @@ func installAuthorizedKey(pubPath string) error {
 	return nil
 }
 
+// Version is reported in heartbeats; release builds set it with
+// -ldflags "-X main.Version=...".
+var Version = "dev"
+
+const usage = `usage: teleport-agent [command] [--config path]
+
+commands:
+  run        register and keep heartbeating (default)
+  install    write the config and a systemd unit, then start the service
+  uninstall  stop the service and remove its unit
+  status     show configuration, registration and service state
+  deregister remove this host's resource from the controller
+  version    print the agent version
+  sftp-server
+             serve SFTP on stdin and stdout (run by the SSH server)
+`
+
 func main() {
-	controllerURL := os.Getenv("CONTROLLER_URL") // e.g., http://192.168.1.10:8080
-	if controllerURL == "" {
-		log.Fatal("❌ CONTROLLER_URL not set. Example: CONTROLLER_URL=http://192.168.1.10:8080 ./teleport-agent")
+	cmd := "run"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "run":
+		err = cmdRun(args)
+	case "install":
+		err = cmdInstall(args)
+	case "uninstall":
+		err = cmdUninstall(args)
+	case "status":
+		err = cmdStatus(args)
+	case "deregister":
+		err = cmdDeregister(args)
+	case "version":
+		fmt.Println(Version)
+	case "sftp-server":
+		err = agentssh.ServeSFTP(os.Stdin, os.Stdout, os.Stderr)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("❌ %v", err)
 	}
+}
 
+func cmdRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := fs.String("config", "", "config file (default "+defaultConfigPath+" if present)")
+	fs.Parse(args)
+
+	// A pending update is checked before validating, so a new binary that
+	// rejects the config still counts its starts and gets rolled back
+	cfg, err := readConfig(*configPath, false)
+	if err != nil {
+		return err
+	}
+	checkPendingUpdate(cfg.DataDir)
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	logLevel = logLevels[cfg.LogLevel]
+	runAgent(cfg)
+	return nil
+}
+
+// runAgent registers with the controller and heartbeats forever.
+func runAgent(cfg *Config) {
 	hostname, _ := os.Hostname()
 	osVersion := detectOS()
 	ip := getLocalIP()
 
-	usr, _ := user.Current()
-	keyDir := filepath.Join(usr.HomeDir, ".teleport-agent")
+	keyDir := cfg.DataDir
+	id, err := hostID(keyDir)
+	if err != nil {
+		log.Fatalf("❌ host ID: %v", err)
+	}
 	priv := filepath.Join(keyDir, "id_rsa")
 	pub := priv + ".pub"
 
@@ -97,11 +173,17 @@ func main() {
 		log.Fatalf("❌ keygen failed: %v", err)
 	}
 
-	// Ensure public key is present in ~/.ssh/authorized_keys
-	if err := installAuthorizedKey(pub); err != nil {
-		log.Printf("⚠️ failed to install public key to authorized_keys: %v", err)
+	// Ensure public key is present in ~/.ssh/authorized_keys; the agent's
+	// own SSH server doesn't read it
+	var hostKey ssh.Signer
+	if cfg.SSHServer.Enabled {
+		if hostKey, err = sshHostKey(keyDir); err != nil {
+			log.Fatalf("❌ SSH server host key: %v", err)
+		}
+	} else if err := installAuthorizedKey(pub); err != nil {
+		warnf("⚠️ failed to install public key to authorized_keys: %v", err)
 	} else {
-		log.Println("✅ public key installed to authorized_keys (or already present)")
+		debugf("✅ public key installed to authorized_keys (or already present)")
 	}
 
 	pubBytes, _ := os.ReadFile(pub)
@@ -110,25 +192,40 @@ func main() {
 	privBytes, _ := os.ReadFile(priv)
 	privStr := strings.TrimSpace(string(privBytes))
 
-	payload := map[string]string{
+	payload := map[string]interface{}{
+		"host_id":     id,
 		"hostname":    hostname,
 		"ip":          ip,
 		"os":          osVersion,
 		"public_key":  pubStr,
 		"private_key": privStr,
 		"role":        "agent",
+		"tunnel":      cfg.Tunnel,
+		"labels":      cfg.Labels,
+	}
+	if hostKey != nil {
+		payload["ssh_server"] = map[string]interface{}{
+			"port":     cfg.SSHServer.port(),
+			"host_key": strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey.PublicKey()))),
+		}
 	}
 
 	body, _ := json.Marshal(payload)
 	// Create request so we can attach registration token header if provided
-	reqURL := controllerURL + "/agents/register"
+	reqURL := cfg.ControllerURL + "/agents/register"
 	req, err := http.NewRequest(http.MethodPost, reqURL, bytes.NewReader(body))
 	if err != nil {
 		log.Fatalf("❌ failed to create register request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	if tok := os.Getenv("AGENT_REG_TOKEN"); tok != "" {
-		req.Header.Set("X-Registration-Token", tok)
+	if cfg.RegistrationToken != "" {
+		req.Header.Set("X-Registration-Token", cfg.RegistrationToken)
+	}
+	// A registered host is only re-registered by the agent holding it
+	cred := loadCredential(cfg.TokenFile)
+	st := loadState(cfg.DataDir)
+	if cred.Token() != "" {
+		req.Header.Set("Authorization", "Bearer "+cred.Token())
 	}
 
 	client := &http.Client{Timeout: 15 * time.Second}
@@ -136,26 +233,140 @@ func main() {
 	if err != nil {
 		log.Fatalf("❌ register failed: %v", err)
 	}
-	defer resp.Body.Close()
+	var reg struct {
+		Error      string `json:"error"`
+		ResourceID int64  `json:"resource_id"`
+		AgentToken string `json:"agent_token"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&reg)
+	resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("⚠️ Controller responded with %d", resp.StatusCode)
-	} else {
-		log.Printf("✅ Registered agent: %s (%s)", hostname, ip)
+	// A stored token keeps working when a single-use registration token
+	// can't be used again after a restart
+	switch {
+	case resp.StatusCode == http.StatusOK && reg.AgentToken != "":
+		if err := cred.Set(reg.AgentToken); err != nil {
+			log.Fatalf("❌ failed to store agent token: %v", err)
+		}
+		st.ResourceID, st.RegisteredAt = reg.ResourceID, time.Now()
+		if err := st.save(cfg.DataDir); err != nil {
+			warnf("⚠️ failed to save state: %v", err)
+		}
+		infof("✅ Registered agent: %s (%s)", hostname, ip)
+	case cred.Token() != "":
+		warnf("⚠️ Controller responded with %d (%s), continuing with the stored agent token", resp.StatusCode, reg.Error)
+	default:
+		log.Fatalf("❌ registration refused with %d: %s", resp.StatusCode, reg.Error)
+	}
+
+	signer, err := ssh.ParsePrivateKey(privBytes)
+	if err != nil {
+		log.Fatalf("❌ invalid agent key: %v", err)
+	}
+	var srv *agentssh.Server
+	if hostKey != nil {
+		if srv, err = startSSHServer(cfg, cred, hostKey); err != nil {
+			log.Fatalf("❌ SSH server: %v", err)
+		}
+	}
+
+	if cfg.Tunnel {
+		t := &tunnel.Agent{
+			ControllerURL: cfg.ControllerURL,
+			Signer:        signer,
+			Token:         cred.Token,
+			HostKeyFile:   filepath.Join(keyDir, "controller_host_key"),
+		}
+		if srv != nil {
+			t.Local = map[uint32]func(net.Conn){
+				uint32(cfg.SSHServer.port()): func(nc net.Conn) { srv.ServeConn(nc) },
+			}
+		}
+		go t.Run()
 	}
 
 	// ✅ Heartbeat loop
 	for {
-		time.Sleep(60 * time.Second)
-		hb, _ := json.Marshal(map[string]string{"ip": ip})
-		hbReq, _ := http.NewRequest(http.MethodPost, controllerURL+"/agents/heartbeat", bytes.NewReader(hb))
-		hbReq.Header.Set("Content-Type", "application/json")
-		if tok := os.Getenv("AGENT_REG_TOKEN"); tok != "" {
-			hbReq.Header.Set("X-Registration-Token", tok)
+		time.Sleep(cfg.HeartbeatInterval)
+		st := loadState(cfg.DataDir)
+		offer, err := heartbeat(cfg.ControllerURL, ip, cred, st.Update)
+		st = loadState(cfg.DataDir)
+		st.HeartbeatError = ""
+		if err != nil {
+			st.HeartbeatError = err.Error()
+		} else {
+			st.LastHeartbeat = time.Now()
+		}
+		_ = st.save(cfg.DataDir)
+		if err != nil {
+			continue
+		}
+		confirmUpdate(cfg)
+		if srv != nil && srv.UserCA() == nil {
+			if err := fetchUserCA(cfg, cred, srv); err != nil {
+				warnf("⚠️ host access CA still unavailable: %v", err)
+			}
+		}
+		if cfg.HostUsers.Enabled {
+			if err := syncHostUsers(cfg, cred); err != nil {
+				warnf("⚠️ host user sync failed: %v", err)
+			}
+		}
+		switch {
+		case offer == nil:
+		case cfg.UpdatePublicKey == "":
+			debugf("update to %s offered, but no update_public_key is configured", offer.Version)
+		default:
+			infof("⬆️ update to %s offered", offer.Version)
+			updateFailed(cfg, offer, applyUpdate(cfg, cred, offer))
+		}
+	}
+}
+
+// heartbeat reports the agent alive with its last update attempt, picks
+// up a rotated token and returns the update offered, if any.
+func heartbeat(controllerURL, ip string, cred *credential, update *agentupdate.Status) (*agentupdate.Offer, error) {
+	hb, _ := json.Marshal(map[string]interface{}{
+		"ip":        ip,
+		"inventory": inventory.Collector{}.Collect(Version),
+		"version":   Version,
+		"os":        runtime.GOOS,
+		"arch":      runtime.GOARCH,
+		"update":    update,
+	})
+	hbReq, _ := http.NewRequest(http.MethodPost, controllerURL+"/agents/heartbeat", bytes.NewReader(hb))
+	hbReq.Header.Set("Content-Type", "application/json")
+	hbReq.Header.Set("Authorization", "Bearer "+cred.Token())
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(hbReq)
+	if err != nil {
+		warnf("⚠️ heartbeat failed: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Error      string             `json:"error"`
+		AgentToken string             `json:"agent_token"`
+		Update     *agentupdate.Offer `json:"update"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		errorf("❌ agent credential rejected (%s): register again with a new registration token", out.Error)
+		return nil, fmt.Errorf("agent credential rejected: %s", out.Error)
+	case resp.StatusCode != http.StatusOK:
+		warnf("⚠️ heartbeat responded with %d: %s", resp.StatusCode, out.Error)
+		return nil, fmt.Errorf("heartbeat responded with %d: %s", resp.StatusCode, out.Error)
+	case out.AgentToken != "":
+		if err := cred.Set(out.AgentToken); err != nil {
+			warnf("⚠️ failed to store rotated agent token: %v", err)
+		} else {
+			infof("🔑 agent token rotated")
 		}
-		client := &http.Client{Timeout: 10 * time.Second}
-		client.Do(hbReq)
 	}
+	debugf("💓 heartbeat ok")
+	return out.Update, nil
 }
 
 // ------------------------------------------------------------
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+func reexec(exe string) error {
+	return errors.New("self-update is not supported on this platform")
+}
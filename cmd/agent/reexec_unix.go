@@ -0,0 +1,14 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reexec replaces the running process with exe, keeping the PID so a
+// service manager keeps tracking it.
+func reexec(exe string) error {
+	return syscall.Exec(exe, append([]string{exe}, os.Args[1:]...), os.Environ())
+}
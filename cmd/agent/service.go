@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	serviceName = "teleport-agent"
+	unitDir     = "/etc/systemd/system"
+)
+
+const unitTemplate = `[Unit]
+Description=Teleport Lite agent
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=%s run --config %s
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+func unitPath() string {
+	return filepath.Join(unitDir, serviceName+".service")
+}
+
+// cmdInstall writes the config file (merging flags into an existing one)
+// and a systemd unit running this binary, then enables and starts it.
+func cmdInstall(args []string) error {
+	fs := flag.NewFlagSet("install", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "config file to write")
+	controller := fs.String("controller", "", "controller URL")
+	token := fs.String("token", "", "registration token")
+	dataDir := fs.String("data-dir", "", "data directory")
+	labels := fs.String("labels", "", "resource labels, k=v,k2=v2")
+	noStart := fs.Bool("no-start", false, "write the files but don't enable or start the service")
+	fs.Parse(args)
+
+	cfg, err := readConfig(*configPath, true)
+	if err != nil {
+		return err
+	}
+	if *controller != "" {
+		cfg.ControllerURL = *controller
+	}
+	if *token != "" {
+		cfg.RegistrationToken = *token
+	}
+	if *dataDir != "" {
+		cfg.DataDir = *dataDir
+		cfg.TokenFile = filepath.Join(*dataDir, "agent_token")
+	}
+	if *labels != "" {
+		if cfg.Labels == nil {
+			cfg.Labels = map[string]string{}
+		}
+		for _, part := range strings.Split(*labels, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok || k == "" {
+				return fmt.Errorf("invalid label %q, want k=v", part)
+			}
+			cfg.Labels[k] = v
+		}
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	configAbs, err := filepath.Abs(*configPath)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.write(configAbs); err != nil {
+		return err
+	}
+	fmt.Println("✅ wrote", configAbs)
+	if err := os.WriteFile(unitPath(), []byte(fmt.Sprintf(unitTemplate, exe, configAbs)), 0644); err != nil {
+		return err
+	}
+	fmt.Println("✅ wrote", unitPath())
+
+	if *noStart {
+		return systemctl("daemon-reload")
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", "--now", serviceName); err != nil {
+		return err
+	}
+	fmt.Println("🚀 started", serviceName)
+	return nil
+}
+
+// cmdUninstall stops and removes the service. --purge also deletes the
+// config file and data directory, so the host has to register again.
+func cmdUninstall(args []string) error {
+	fs := flag.NewFlagSet("uninstall", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath, "config file")
+	purge := fs.Bool("purge", false, "also remove the config file and data directory")
+	fs.Parse(args)
+
+	if _, err := os.Stat(unitPath()); err == nil {
+		// The unit may already be stopped or disabled
+		_ = systemctl("disable", "--now", serviceName)
+		if err := os.Remove(unitPath()); err != nil {
+			return err
+		}
+		if err := systemctl("daemon-reload"); err != nil {
+			return err
+		}
+		fmt.Println("🗑️ removed", unitPath())
+	} else {
+		fmt.Println("ℹ️ service is not installed")
+	}
+
+	if !*purge {
+		return nil
+	}
+	cfg, err := readConfig(*configPath, true)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{*configPath, cfg.DataDir} {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		fmt.Println("🗑️ removed", path)
+	}
+	return nil
+}
+
+// cmdStatus prints the configuration, registration and service state.
+func cmdStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	configPath := fs.String("config", "", "config file (default "+defaultConfigPath+" if present)")
+	fs.Parse(args)
+
+	cfg, err := readConfig(*configPath, false)
+	if err != nil {
+		return err
+	}
+	st := loadState(cfg.DataDir)
+	registered := "no"
+	if loadCredential(cfg.TokenFile).Token() != "" {
+		registered = "yes"
+		if st.ResourceID != 0 {
+			registered = fmt.Sprintf("yes, resource %d since %s", st.ResourceID, st.RegisteredAt.Format(time.RFC3339))
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	row := func(k, v string) { fmt.Fprintf(tw, "%s\t%s\n", k, v) }
+	row("version", Version)
+	row("config", orNone(cfg.path))
+	row("controller", orNone(cfg.ControllerURL))
+	row("data dir", cfg.DataDir)
+	if id, err := os.ReadFile(filepath.Join(cfg.DataDir, "host_id")); err == nil {
+		row("host id", strings.TrimSpace(string(id)))
+	}
+	row("tunnel", fmt.Sprint(cfg.Tunnel))
+	if cfg.SSHServer.Enabled {
+		listen := "tunnel only"
+		if cfg.SSHServer.Listen != "" {
+			listen = "listening on " + cfg.SSHServer.Listen
+		}
+		row("ssh server", fmt.Sprintf("port %d, %s", cfg.SSHServer.port(), listen))
+	}
+	row("heartbeat", cfg.HeartbeatInterval.String())
+	row("labels", orNone(formatLabels(cfg.Labels)))
+	row("registered", registered)
+	if cfg.HostUsers.Enabled {
+		row("host users", fmt.Sprintf("%d managed: %s", len(st.ManagedUsers), orNone(strings.Join(st.ManagedUsers, ","))))
+	}
+	switch {
+	case st.HeartbeatError != "":
+		row("last heartbeat", "failed: "+st.HeartbeatError)
+	case !st.LastHeartbeat.IsZero():
+		row("last heartbeat", st.LastHeartbeat.Format(time.RFC3339)+" ("+time.Since(st.LastHeartbeat).Truncate(time.Second).String()+" ago)")
+	default:
+		row("last heartbeat", "never")
+	}
+	if u := st.Update; u != nil {
+		detail := fmt.Sprintf("%s %s -> %s at %s", u.State, orNone(u.From), u.To, u.At.Format(time.RFC3339))
+		if u.Error != "" {
+			detail += ": " + u.Error
+		}
+		row("last update", detail)
+	}
+	row("service", serviceState())
+	return tw.Flush()
+}
+
+// cmdDeregister removes this host's resource from the controller and
+// forgets the agent token. The host ID is kept, so registering again
+// creates a fresh resource for the same host.
+func cmdDeregister(args []string) error {
+	fs := flag.NewFlagSet("deregister", flag.ExitOnError)
+	configPath := fs.String("config", "", "config file (default "+defaultConfigPath+" if present)")
+	fs.Parse(args)
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	cred := loadCredential(cfg.TokenFile)
+	if cred.Token() == "" {
+		return errors.New("agent is not registered")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.ControllerURL+"/agents/deregister", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+cred.Token())
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("controller responded with %d: %s", resp.StatusCode, e.Error)
+	}
+
+	for _, path := range []string{cfg.TokenFile, statePath(cfg.DataDir)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	fmt.Println("👋 deregistered; run `teleport-agent uninstall` too, or the service registers again while its registration token is valid")
+	return nil
+}
+
+func serviceState() string {
+	if _, err := os.Stat(unitPath()); err != nil {
+		return "not installed"
+	}
+	out, _ := exec.Command("systemctl", "is-active", serviceName).Output()
+	return strings.TrimSpace(string(out))
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return errors.New("systemctl " + strings.Join(args, " ") + ": " + strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func formatLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
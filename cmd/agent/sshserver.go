@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"teleport_lite/internal/agentssh"
+)
+
+const (
+	// eventFlushInterval is how often session events are sent.
+	eventFlushInterval = 5 * time.Second
+	// maxEventBatch matches the controller's per-request limit.
+	maxEventBatch = 500
+	// maxQueuedEvents caps the events kept while the controller is
+	// unreachable; the oldest are dropped.
+	maxQueuedEvents = 5000
+)
+
+// sshHostKey loads the SSH server's host key from the data dir, creating
+// it on first use.
+func sshHostKey(dataDir string) (ssh.Signer, error) {
+	path := filepath.Join(dataDir, "ssh_host_ed25519_key")
+	if b, err := os.ReadFile(path); err == nil {
+		return ssh.ParsePrivateKey(b)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "teleport-agent host key")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(priv)
+}
+
+// startSSHServer starts the agent's SSH server, listening directly when
+// configured. Tunnel connections are handed to it by the caller.
+func startSSHServer(cfg *Config, cred *credential, hostKey ssh.Signer) (*agentssh.Server, error) {
+	events := &eventReporter{cfg: cfg, cred: cred}
+	srv := &agentssh.Server{
+		HostKey: hostKey,
+		Events:  events.add,
+	}
+	if exe, err := executable(); err == nil {
+		srv.SFTPCommand = []string{exe, "sftp-server"}
+	} else {
+		warnf("⚠️ SFTP disabled: %v", err)
+	}
+	if err := fetchUserCA(cfg, cred, srv); err != nil {
+		warnf("⚠️ host access CA unavailable, no logins are accepted until it is fetched: %v", err)
+	}
+
+	if cfg.SSHServer.Listen != "" {
+		l, err := net.Listen("tcp", cfg.SSHServer.Listen)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			errorf("❌ ssh server stopped: %v", srv.Serve(l))
+		}()
+		infof("🖥️ SSH server listening on %s", cfg.SSHServer.Listen)
+	}
+	go events.run()
+	return srv, nil
+}
+
+// fetchUserCA gives srv the organization's host access CA, falling back
+// to the copy saved by an earlier run when the controller can't be asked.
+func fetchUserCA(cfg *Config, cred *credential, srv *agentssh.Server) error {
+	path := filepath.Join(cfg.DataDir, "host_access_ca.pub")
+	key, fetchErr := requestUserCA(cfg, cred)
+	if fetchErr == nil {
+		_ = os.WriteFile(path, ssh.MarshalAuthorizedKey(key), 0644)
+	} else {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fetchErr
+		}
+		if key, _, _, _, err = ssh.ParseAuthorizedKey(b); err != nil {
+			return fetchErr
+		}
+		warnf("⚠️ using the saved host access CA: %v", fetchErr)
+	}
+	srv.SetUserCA(key)
+	return nil
+}
+
+func requestUserCA(cfg *Config, cred *credential) (ssh.PublicKey, error) {
+	req, _ := http.NewRequest(http.MethodGet, cfg.ControllerURL+"/agents/ssh/ca", nil)
+	req.Header.Set("Authorization", "Bearer "+cred.Token())
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Error     string `json:"error"`
+		PublicKey string `json:"public_key"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("host access CA responded with %d: %s", resp.StatusCode, out.Error)
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(out.PublicKey))
+	return key, err
+}
+
+// eventReporter sends the SSH server's session events to the controller
+// in batches, keeping them while it is unreachable.
+type eventReporter struct {
+	cfg  *Config
+	cred *credential
+
+	mu    sync.Mutex
+	queue []agentssh.Event
+	// dropped counts events dropped from the head of the queue while a
+	// batch was being sent
+	dropped int
+}
+
+func (r *eventReporter) add(e agentssh.Event) {
+	debugf("🖥️ ssh %s %s %s%s", e.Type, e.Login, e.Command, e.Path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queue) >= maxQueuedEvents {
+		r.queue = r.queue[1:]
+		r.dropped++
+	}
+	r.queue = append(r.queue, e)
+}
+
+// run flushes the queue every eventFlushInterval. It never returns.
+func (r *eventReporter) run() {
+	for range time.Tick(eventFlushInterval) {
+		for {
+			r.mu.Lock()
+			batch := r.queue[:min(len(r.queue), maxEventBatch)]
+			r.dropped = 0
+			r.mu.Unlock()
+			if len(batch) == 0 {
+				break
+			}
+			if err := r.send(batch); err != nil {
+				warnf("⚠️ sending %d session events failed: %v", len(batch), err)
+				break
+			}
+			r.mu.Lock()
+			r.queue = r.queue[max(len(batch)-r.dropped, 0):]
+			r.mu.Unlock()
+		}
+	}
+}
+
+func (r *eventReporter) send(batch []agentssh.Event) error {
+	body, _ := json.Marshal(map[string]interface{}{"events": batch})
+	req, _ := http.NewRequest(http.MethodPost, r.cfg.ControllerURL+"/agents/ssh/events", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.cred.Token())
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var out struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return fmt.Errorf("responded with %d: %s", resp.StatusCode, strings.TrimSpace(out.Error))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"teleport_lite/internal/agentupdate"
+)
+
+// state is what the agent remembers between runs, kept in
+// <data_dir>/state.json and shown by `status`.
+type state struct {
+	ResourceID     int64     `json:"resource_id,omitempty"`
+	RegisteredAt   time.Time `json:"registered_at,omitempty"`
+	LastHeartbeat  time.Time `json:"last_heartbeat,omitempty"`
+	HeartbeatError string    `json:"heartbeat_error,omitempty"`
+	// ManagedUsers are the host accounts the agent created
+	ManagedUsers []string `json:"managed_users,omitempty"`
+	// Update is the last self-update attempt
+	Update *agentupdate.Status `json:"update,omitempty"`
+}
+
+func statePath(dataDir string) string {
+	return filepath.Join(dataDir, "state.json")
+}
+
+func loadState(dataDir string) state {
+	var st state
+	if b, err := os.ReadFile(statePath(dataDir)); err == nil {
+		_ = json.Unmarshal(b, &st)
+	}
+	return st
+}
+
+func (st state) save(dataDir string) error {
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statePath(dataDir), b, 0600)
+}
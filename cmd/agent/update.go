@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"teleport_lite/internal/agentupdate"
+)
+
+const (
+	// maxUpdateAttempts is how many starts a new binary gets to reach the
+	// controller before the previous one is restored.
+	maxUpdateAttempts = 3
+	// maxBinarySize caps an update download.
+	maxBinarySize = 256 << 20
+)
+
+// executable is the path of the running agent binary.
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// applyUpdate downloads the offered build, verifies it against the signed
+// manifest, checks it starts, swaps it in and re-executes it. Older
+// versions are refused. It only returns on failure, with the running
+// binary untouched.
+func applyUpdate(cfg *Config, cred *credential, offer *agentupdate.Offer) error {
+	if agentupdate.Older(offer.Version, Version) {
+		return fmt.Errorf("refusing to downgrade from %s", Version)
+	}
+	pub, err := agentupdate.ParsePublicKey(cfg.UpdatePublicKey)
+	if err != nil {
+		return err
+	}
+	exe, err := executable()
+	if err != nil {
+		return err
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, cfg.ControllerURL+offer.URL, nil)
+	req.Header.Set("Authorization", "Bearer "+cred.Token())
+	resp, err := (&http.Client{Timeout: 5 * time.Minute}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download responded with %d", resp.StatusCode)
+	}
+	binary, err := io.ReadAll(io.LimitReader(resp.Body, maxBinarySize+1))
+	if err != nil {
+		return err
+	}
+	if len(binary) > maxBinarySize {
+		return errors.New("download exceeds the size limit")
+	}
+	m, err := agentupdate.Verify(pub, []byte(offer.Manifest), offer.Signature)
+	if err != nil {
+		return err
+	}
+	if err := m.Check(offer.Version, runtime.GOOS, runtime.GOARCH, binary); err != nil {
+		return err
+	}
+
+	// Next to the running binary so the swap is a rename on one filesystem
+	next := exe + ".new"
+	if err := os.WriteFile(next, binary, 0755); err != nil {
+		return err
+	}
+	out, err := exec.Command(next, "version").Output()
+	if got := strings.TrimSpace(string(out)); err != nil || got != offer.Version {
+		os.Remove(next)
+		if err != nil {
+			return fmt.Errorf("new binary failed its self-test: %v", err)
+		}
+		return fmt.Errorf("new binary reports version %q", got)
+	}
+
+	// Keep the running binary as .old with a hard link, then rename the
+	// new one over it, so there is a binary at exe at every moment. The
+	// update is recorded as pending first: if we die before the rename,
+	// the old binary starts and marks it rolled back.
+	prev := exe + ".old"
+	_ = os.Remove(prev)
+	if err := os.Link(exe, prev); err != nil {
+		os.Remove(next)
+		return err
+	}
+	st := loadState(cfg.DataDir)
+	st.Update = &agentupdate.Status{State: agentupdate.StatePending, From: Version, To: offer.Version, At: time.Now()}
+	if err := st.save(cfg.DataDir); err != nil {
+		warnf("⚠️ failed to save state: %v", err)
+	}
+	if err := os.Rename(next, exe); err != nil {
+		os.Remove(next)
+		os.Remove(prev)
+		return err
+	}
+	infof("⬆️ updated %s -> %s, restarting", Version, offer.Version)
+	err = reexec(exe)
+	_ = os.Rename(prev, exe)
+	return err
+}
+
+// updateFailed records a failed attempt, reported with the next heartbeat.
+func updateFailed(cfg *Config, offer *agentupdate.Offer, err error) {
+	errorf("❌ update to %s failed: %v", offer.Version, err)
+	st := loadState(cfg.DataDir)
+	st.Update = &agentupdate.Status{State: agentupdate.StateFailed, From: Version, To: offer.Version, Error: err.Error(), At: time.Now()}
+	_ = st.save(cfg.DataDir)
+}
+
+// checkPendingUpdate runs at start. While an update is pending each start
+// of the new binary counts as an attempt; once a binary that keeps
+// crashing used them up, the previous one is restored and re-executed.
+func checkPendingUpdate(dataDir string) {
+	st := loadState(dataDir)
+	u := st.Update
+	if u == nil || u.State != agentupdate.StatePending {
+		return
+	}
+	if Version != u.To {
+		// Started as something else: the binary was replaced behind our back
+		u.State, u.Error, u.At = agentupdate.StateRolledBack, "agent started as "+Version, time.Now()
+		_ = st.save(dataDir)
+		return
+	}
+	u.Attempts++
+	if u.Attempts <= maxUpdateAttempts {
+		_ = st.save(dataDir)
+		return
+	}
+
+	exe, err := executable()
+	if err == nil {
+		err = os.Rename(exe+".old", exe)
+	}
+	if err != nil {
+		errorf("❌ update to %s did not come up and the previous binary can't be restored: %v", u.To, err)
+		return
+	}
+	u.State, u.Error, u.At = agentupdate.StateRolledBack, fmt.Sprintf("did not reach the controller in %d starts", maxUpdateAttempts), time.Now()
+	_ = st.save(dataDir)
+	errorf("❌ update to %s did not come up, rolling back to %s", u.To, u.From)
+	if err := reexec(exe); err != nil {
+		errorf("❌ restart after rollback failed: %v", err)
+		os.Exit(1)
+	}
+}
+
+// confirmUpdate marks a pending update done once the new binary reached
+// the controller, and drops the previous binary.
+func confirmUpdate(cfg *Config) {
+	st := loadState(cfg.DataDir)
+	u := st.Update
+	if u == nil || u.State != agentupdate.StatePending || Version != u.To {
+		return
+	}
+	u.State, u.Error, u.At = agentupdate.StateUpdated, "", time.Now()
+	if err := st.save(cfg.DataDir); err != nil {
+		warnf("⚠️ failed to save state: %v", err)
+		return
+	}
+	if exe, err := executable(); err == nil {
+		_ = os.Remove(exe + ".old")
+	}
+	infof("✅ update to %s confirmed", Version)
+}
@@ -3,13 +3,18 @@ package main
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"teleport_lite/internal/agent"
 	"teleport_lite/internal/config"
+	"teleport_lite/internal/connect"
 	"teleport_lite/internal/db"
+	"teleport_lite/internal/health"
 	httpserver "teleport_lite/internal/http"
 	"teleport_lite/internal/models"
 	"teleport_lite/internal/seed"
+	"teleport_lite/internal/session"
+	"teleport_lite/internal/sshproxy"
 )
 
 func main() {
@@ -31,6 +36,19 @@ func main() {
 		&models.RegistrationToken{},
 		&models.AccessRule{},
 		&models.AuditLog{},
+		&models.AccessReviewCampaign{},
+		&models.AccessReviewItem{},
+		&models.Lock{},
+		&models.Session{},
+		&models.RolePolicy{},
+		&models.CertAuthority{},
+		&models.APIKey{},
+		&models.AgentCredential{},
+		&models.ResourceInventory{},
+		&models.ResourceAddress{},
+		&models.AgentUpdateTarget{},
+		&models.DiscoveryJob{},
+		&models.DiscoveryCandidate{},
 	)
 
 	if err := seed.FirstSetup(gdb); err != nil {
@@ -39,7 +57,37 @@ func main() {
 
 	go agent.RunLocalAgent(gdb)
 
-	r := httpserver.NewRouter(gdb, cfg.JWTSecret)
+	monitor := &health.Monitor{
+		DB:            gdb,
+		DegradedAfter: cfg.ResourceDegradedAfter,
+		OfflineAfter:  cfg.ResourceOfflineAfter,
+		Interval:      30 * time.Second,
+	}
+	go monitor.Run()
+
+	sessions := session.NewRegistry(gdb)
+
+	tunnels, err := connect.NewTunnels(gdb)
+	if err != nil {
+		log.Fatalf("❌ Agent tunnel setup failed: %v", err)
+	}
+	connect.UseTunnels(tunnels)
+	connect.UseCertAuthority(gdb)
+
+	if cfg.SSHProxyAddr != "off" {
+		proxy, err := sshproxy.New(gdb, sessions)
+		if err != nil {
+			log.Fatalf("❌ SSH proxy setup failed: %v", err)
+		}
+		go func() {
+			log.Printf("🔐 SSH proxy listening on %s\n", cfg.SSHProxyAddr)
+			if err := proxy.ListenAndServe(cfg.SSHProxyAddr); err != nil {
+				log.Printf("❌ SSH proxy stopped: %v", err)
+			}
+		}()
+	}
+
+	r := httpserver.NewRouter(gdb, cfg, sessions, tunnels)
 	log.Printf("🚀 Server listening on :%s\n", cfg.AppPort)
 	r.Run(fmt.Sprintf(":%s", cfg.AppPort))
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// apiCall sends a JSON request to the controller and decodes the JSON
+// response into out. Non-2xx responses are returned as errors carrying
+// the server's "error" field.
+func apiCall(p *Profile, method, path string, body, out interface{}) error {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(p.URL, "/")+path, rd)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "" {
+			e.Error = resp.Status
+		}
+		return fmt.Errorf("%s %s: %s", method, path, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// dialWS opens a WebSocket to the controller authenticated with the
+// profile's token. The response body is read for a readable error when
+// the upgrade is refused.
+func dialWS(p *Profile, path string, query url.Values) (*websocket.Conn, error) {
+	u, err := url.Parse(strings.TrimRight(p.URL, "/") + path)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.RawQuery = query.Encode()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+p.Token)
+	conn, resp, err := websocket.DefaultDialer.Dial(u.String(), header)
+	if err != nil && resp != nil {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil && e.Error != "" {
+			return nil, errors.New(e.Error)
+		}
+	}
+	return conn, err
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it; the
+// controller verifies the token on every request.
+func tokenExpiry(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if json.Unmarshal(b, &claims) != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
+
+// resource is the subset of the controller's resource JSON the client uses.
+type resource struct {
+	ID       int64  `json:"ID"`
+	Name     string `json:"Name"`
+	Type     string `json:"Type"`
+	Host     string `json:"Host"`
+	Port     int    `json:"Port"`
+	Status   string `json:"Status"`
+	Metadata struct {
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+}
+
+func listResources(p *Profile, status string) ([]resource, error) {
+	var out struct {
+		Resources []resource `json:"resources"`
+	}
+	path := "/api/v1/resources"
+	if status != "" {
+		path += "?status=" + url.QueryEscape(status)
+	}
+	err := apiCall(p, http.MethodGet, path, nil, &out)
+	return out.Resources, err
+}
+
+// findResource matches target against resource IDs, names and hosts.
+func findResource(p *Profile, target string) (resource, error) {
+	list, err := listResources(p, "")
+	if err != nil {
+		return resource{}, err
+	}
+	var matches []resource
+	for _, r := range list {
+		if fmt.Sprint(r.ID) == target || r.Name == target || r.Host == target {
+			matches = append(matches, r)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return resource{}, errors.New("no resource named " + target)
+	case 1:
+		return matches[0], nil
+	default:
+		return resource{}, errors.New(target + " matches several resources, use the resource ID")
+	}
+}
+
+// splitTarget parses user@resource.
+func splitTarget(target string) (login, res string, err error) {
+	i := strings.LastIndex(target, "@")
+	if i <= 0 || i == len(target)-1 {
+		return "", "", errors.New("expected user@resource, got " + target)
+	}
+	return target[:i], target[i+1:], nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// parseForward parses -L [bind:]local_port:dest_host:dest_port.
+func parseForward(spec string) (listen, destHost, destPort string, err error) {
+	parts := strings.Split(spec, ":")
+	switch len(parts) {
+	case 3:
+		return "127.0.0.1:" + parts[0], parts[1], parts[2], nil
+	case 4:
+		return net.JoinHostPort(parts[0], parts[1]), parts[2], parts[3], nil
+	}
+	return "", "", "", errors.New("expected [bind:]local_port:dest_host:dest_port, got " + spec)
+}
+
+// runForward listens on listen and forwards every accepted connection to
+// destHost:destPort as seen from the resource, through /api/v1/ws/forward.
+// It runs until the listener fails.
+func runForward(p *Profile, login, target, listen, destHost, destPort string) error {
+	res, err := findResource(p, target)
+	if err != nil {
+		return err
+	}
+	port := res.Port
+	if port == 0 {
+		port = 22
+	}
+	query := url.Values{
+		"resource_id": {strconv.FormatInt(res.ID, 10)},
+		"login":       {login},
+		"dest_host":   {destHost},
+		"dest_port":   {destPort},
+		"port":        {strconv.Itoa(port)},
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	log.Printf("forwarding %s -> %s:%s via %s@%s", ln.Addr(), destHost, destPort, login, res.Name)
+
+	for {
+		local, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer local.Close()
+			ws, err := dialWS(p, "/api/v1/ws/forward", query)
+			if err != nil {
+				log.Printf("forward from %s failed: %v", local.RemoteAddr(), err)
+				return
+			}
+			defer ws.Close()
+			pipeLocal(ws, local)
+		}()
+	}
+}
+
+// pipeLocal copies between a local TCP connection and the forward
+// WebSocket until either side closes.
+func pipeLocal(ws *websocket.Conn, local net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() {
+		defer func() { done <- struct{}{} }()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := local.Read(buf)
+			if n > 0 {
+				if ws.WriteMessage(websocket.BinaryMessage, buf[:n]) != nil {
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					_ = ws.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				}
+				return
+			}
+		}
+	}()
+	go func() {
+		defer func() { done <- struct{}{} }()
+		for {
+			mt, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if mt == websocket.BinaryMessage {
+				if _, err := local.Write(data); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	<-done
+}
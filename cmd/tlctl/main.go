@@ -0,0 +1,310 @@
+// Command tlctl is the command-line client for the teleport_lite
+// controller: log in, list resources, open shells and forward ports from
+// your own terminal.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const usage = `usage: tlctl <command> [flags]
+
+commands:
+  login    --url <controller> --user <email> [--profile name]
+  logout   [--profile name]
+  profiles                       list profiles, * marks the current one
+  use      <profile>             switch the current profile
+  ls       [--labels k=v,...] [--status online,degraded,offline]
+                                 list resources
+  ssh      user@resource         open an interactive shell
+  forward  -L [bind:]port:host:port user@resource
+                                 forward a local port through a resource
+
+Every command accepts --profile to use a profile other than the current one.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "login":
+		err = cmdLogin(args)
+	case "logout":
+		err = cmdLogout(args)
+	case "profiles":
+		err = cmdProfiles(args)
+	case "use":
+		err = cmdUse(args)
+	case "ls":
+		err = cmdLs(args)
+	case "ssh":
+		err = cmdSSH(args)
+	case "forward":
+		err = cmdForward(args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func cmdLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	controller := fs.String("url", "", "controller URL, e.g. https://teleport.example.com")
+	email := fs.String("user", "", "email address")
+	name := fs.String("profile", "", "profile name (default: controller host)")
+	fs.Parse(args)
+
+	pf, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	// Re-login to an existing profile reuses its settings
+	if *name != "" {
+		if p, ok := pf.Profiles[*name]; ok {
+			if *controller == "" {
+				*controller = p.URL
+			}
+			if *email == "" {
+				*email = p.Email
+			}
+		}
+	}
+	if *controller == "" || *email == "" {
+		return fmt.Errorf("--url and --user are required")
+	}
+	u, err := url.Parse(*controller)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid controller URL %q", *controller)
+	}
+	if *name == "" {
+		*name = u.Host
+	}
+
+	password, err := readPassword("Password for " + *email + ": ")
+	if err != nil {
+		return err
+	}
+
+	p := &Profile{URL: strings.TrimRight(*controller, "/"), Email: *email}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := apiCall(p, http.MethodPost, "/api/v1/auth/login", map[string]string{
+		"email":    *email,
+		"password": password,
+	}, &out); err != nil {
+		return err
+	}
+	p.Token = out.Token
+	p.ExpiresAt = tokenExpiry(out.Token)
+
+	pf.Profiles[*name] = p
+	pf.Current = *name
+	if err := pf.save(); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in to %s as %s (profile %s)\n", p.URL, p.Email, *name)
+	return nil
+}
+
+func cmdLogout(args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ExitOnError)
+	name := fs.String("profile", "", "profile to log out of (default: current)")
+	fs.Parse(args)
+
+	pf, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	n, p, err := pf.get(*name)
+	if err != nil {
+		return err
+	}
+	p.Token = ""
+	p.ExpiresAt = time.Time{}
+	if err := pf.save(); err != nil {
+		return err
+	}
+	fmt.Println("Logged out of profile", n)
+	return nil
+}
+
+func cmdProfiles(args []string) error {
+	pf, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tPROFILE\tURL\tUSER\tSTATUS")
+	for _, name := range pf.names() {
+		p := pf.Profiles[name]
+		mark, status := "", "logged in"
+		if name == pf.Current {
+			mark = "*"
+		}
+		if _, err := pf.loggedIn(name); err != nil {
+			status = "logged out"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", mark, name, p.URL, p.Email, status)
+	}
+	return tw.Flush()
+}
+
+func cmdUse(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: tlctl use <profile>")
+	}
+	pf, err := loadProfiles()
+	if err != nil {
+		return err
+	}
+	if _, ok := pf.Profiles[args[0]]; !ok {
+		return fmt.Errorf("unknown profile %s", args[0])
+	}
+	pf.Current = args[0]
+	return pf.save()
+}
+
+func cmdLs(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	name := fs.String("profile", "", "profile to use")
+	labels := fs.String("labels", "", "only show resources matching k=v,k2=v2")
+	status := fs.String("status", "", "only show resources in these states: online,degraded,offline")
+	fs.Parse(args)
+
+	p, err := currentProfile(*name)
+	if err != nil {
+		return err
+	}
+	list, err := listResources(p, *status)
+	if err != nil {
+		return err
+	}
+	want := parseLabels(*labels)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tHOST\tTYPE\tSTATUS\tLABELS")
+	for _, r := range list {
+		if !hasLabels(r.Metadata.Labels, want) {
+			continue
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.Name, r.Host, r.Type, r.Status, formatLabels(r.Metadata.Labels))
+	}
+	return tw.Flush()
+}
+
+func cmdSSH(args []string) error {
+	fs := flag.NewFlagSet("ssh", flag.ExitOnError)
+	name := fs.String("profile", "", "profile to use")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: tlctl ssh [--profile name] user@resource")
+	}
+
+	p, err := currentProfile(*name)
+	if err != nil {
+		return err
+	}
+	login, target, err := splitTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	status, err := runSSH(p, login, target)
+	if err != nil {
+		return err
+	}
+	os.Exit(status)
+	return nil
+}
+
+func cmdForward(args []string) error {
+	fs := flag.NewFlagSet("forward", flag.ExitOnError)
+	name := fs.String("profile", "", "profile to use")
+	spec := fs.String("L", "", "[bind:]local_port:dest_host:dest_port")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *spec == "" {
+		return fmt.Errorf("usage: tlctl forward -L [bind:]port:host:port user@resource")
+	}
+
+	p, err := currentProfile(*name)
+	if err != nil {
+		return err
+	}
+	login, target, err := splitTarget(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	listen, destHost, destPort, err := parseForward(*spec)
+	if err != nil {
+		return err
+	}
+	return runForward(p, login, target, listen, destHost, destPort)
+}
+
+func currentProfile(name string) (*Profile, error) {
+	pf, err := loadProfiles()
+	if err != nil {
+		return nil, err
+	}
+	return pf.loggedIn(name)
+}
+
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func parseLabels(selector string) map[string]string {
+	out := map[string]string{}
+	for _, part := range strings.Split(selector, ",") {
+		if kv := strings.SplitN(strings.TrimSpace(part), "=", 2); len(kv) == 2 {
+			out[kv[0]] = kv[1]
+		}
+	}
+	return out
+}
+
+func hasLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := labels[k]; !ok || (v != "*" && got != v) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatLabels(labels map[string]string) string {
+	parts := make([]string, 0, len(labels))
+	for k, v := range labels {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
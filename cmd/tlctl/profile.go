@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Profile is one controller the client can log into.
+type Profile struct {
+	URL       string    `json:"url"`
+	Email     string    `json:"email"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// profileFile is stored at ~/.teleport_lite/profiles.json with 0600
+// permissions since it holds JWTs.
+type profileFile struct {
+	Current  string              `json:"current"`
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+func profilePath() (string, error) {
+	if p := os.Getenv("TLCTL_PROFILES"); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".teleport_lite", "profiles.json"), nil
+}
+
+func loadProfiles() (*profileFile, error) {
+	pf := &profileFile{Profiles: map[string]*Profile{}}
+	path, err := profilePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, pf); err != nil {
+		return nil, err
+	}
+	if pf.Profiles == nil {
+		pf.Profiles = map[string]*Profile{}
+	}
+	return pf, nil
+}
+
+func (pf *profileFile) save() error {
+	path, err := profilePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(pf, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so a crash never leaves a truncated file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// get returns the named profile, or the current one when name is empty.
+func (pf *profileFile) get(name string) (string, *Profile, error) {
+	if name == "" {
+		name = pf.Current
+	}
+	if name == "" {
+		return "", nil, errors.New("not logged in, run: tlctl login --url <controller> --user <email>")
+	}
+	p, ok := pf.Profiles[name]
+	if !ok {
+		return "", nil, errors.New("unknown profile " + name)
+	}
+	return name, p, nil
+}
+
+// loggedIn returns the profile to use for API calls, failing if its token
+// is missing or expired.
+func (pf *profileFile) loggedIn(name string) (*Profile, error) {
+	name, p, err := pf.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if p.Token == "" || (!p.ExpiresAt.IsZero() && time.Now().After(p.ExpiresAt)) {
+		return nil, errors.New("session for profile " + name + " expired, run: tlctl login --profile " + name)
+	}
+	return p, nil
+}
+
+func (pf *profileFile) names() []string {
+	out := make([]string, 0, len(pf.Profiles))
+	for name := range pf.Profiles {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package main
+
+import (
+	"time"
+
+	"golang.org/x/term"
+)
+
+// watchResize polls the console size, since Windows has no SIGWINCH.
+func watchResize(fd int, fn func(cols, rows int)) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		w, h, _ := term.GetSize(fd)
+		t := time.NewTicker(500 * time.Millisecond)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if nw, nh, err := term.GetSize(fd); err == nil && (nw != w || nh != h) {
+					w, h = nw, nh
+					fn(w, h)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
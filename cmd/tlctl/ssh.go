@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// controlMsg is a framed-protocol control message, see
+// internal/http/handlers/ws_protocol.go.
+type controlMsg struct {
+	Op      string `json:"op"`
+	Cols    int    `json:"cols,omitempty"`
+	Rows    int    `json:"rows,omitempty"`
+	Proto   string `json:"proto,omitempty"`
+	Status  *int   `json:"status,omitempty"`
+	Signal  string `json:"signal,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// wsConn serializes writes to a WebSocket shared by the stdin, resize
+// and keepalive goroutines.
+type wsConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *wsConn) send(mt int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.WriteMessage(mt, data)
+}
+
+func (c *wsConn) control(msg controlMsg) error {
+	b, _ := json.Marshal(msg)
+	return c.send(websocket.TextMessage, b)
+}
+
+// runSSH opens an interactive shell on login@target through /api/v1/ws/ssh
+// and returns the remote exit status.
+func runSSH(p *Profile, login, target string) (int, error) {
+	res, err := findResource(p, target)
+	if err != nil {
+		return 1, err
+	}
+	port := res.Port
+	if port == 0 {
+		port = 22
+	}
+
+	raw, err := dialWS(p, "/api/v1/ws/ssh", url.Values{
+		"host":        {res.Host},
+		"resource_id": {strconv.FormatInt(res.ID, 10)},
+		"port":        {strconv.Itoa(port)},
+		"user":        {login},
+	})
+	if err != nil {
+		return 1, err
+	}
+	conn := &wsConn{Conn: raw}
+	defer conn.Close()
+
+	fd := int(os.Stdin.Fd())
+	cols, rows := 120, 32
+	if term.IsTerminal(fd) {
+		if w, h, err := term.GetSize(fd); err == nil {
+			cols, rows = w, h
+		}
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return 1, err
+		}
+		defer term.Restore(fd, state)
+	}
+
+	if err := conn.control(controlMsg{Op: "auth", Cols: cols, Rows: rows, Proto: "framed"}); err != nil {
+		return 1, err
+	}
+
+	// Local terminal → remote
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				if conn.send(websocket.BinaryMessage, buf[:n]) != nil {
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					_ = conn.control(controlMsg{Op: "close"})
+				}
+				return
+			}
+		}
+	}()
+
+	stopResize := watchResize(fd, func(cols, rows int) {
+		_ = conn.control(controlMsg{Op: "resize", Cols: cols, Rows: rows})
+	})
+	defer stopResize()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	go func() {
+		for range keepalive.C {
+			if conn.control(controlMsg{Op: "ping"}) != nil {
+				return
+			}
+		}
+	}()
+
+	// Remote → local terminal
+	status := -1
+	for {
+		mt, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if mt == websocket.BinaryMessage {
+			os.Stdout.Write(data)
+			continue
+		}
+		var msg controlMsg
+		if json.Unmarshal(data, &msg) != nil {
+			// Errors before the session starts are plain text
+			os.Stderr.Write(data)
+			continue
+		}
+		switch msg.Op {
+		case "notice":
+			fmt.Fprintf(os.Stderr, "\r\n[%s]\r\n", msg.Message)
+		case "error":
+			fmt.Fprintf(os.Stderr, "\r\nerror: %s\r\n", msg.Message)
+		case "exit":
+			if msg.Status != nil {
+				status = *msg.Status
+			}
+			if msg.Signal != "" {
+				fmt.Fprintf(os.Stderr, "\r\n[killed by signal %s]\r\n", msg.Signal)
+			}
+		}
+	}
+	if status < 0 {
+		return 255, nil
+	}
+	return status, nil
+}
@@ -6,8 +6,10 @@ import (
 	"crypto/x509"
 	"encoding/json"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/user"
 	"path/filepath"
@@ -18,6 +20,7 @@ import (
 	"golang.org/x/crypto/ssh"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"teleport_lite/internal/health"
 	"teleport_lite/internal/models"
 )
 
@@ -41,6 +44,11 @@ func RunLocalAgent(gdb *gorm.DB) {
 	privateKeyPath := filepath.Join(keyDir, "id_rsa")
 	publicKeyPath := privateKeyPath + ".pub"
 	authKeysPath := filepath.Join(homeDir, ".ssh", "authorized_keys")
+	hostID, err := loadHostID(filepath.Join(keyDir, "host_id"))
+	if err != nil {
+		log.Printf("❌ Failed to load host ID: %v", err)
+		return
+	}
 
 	hostname, _ := os.Hostname()
 	osVersion := detectOS()
@@ -71,6 +79,7 @@ func RunLocalAgent(gdb *gorm.DB) {
 	resource := models.Resource{
 		OrgID:         1,
 		Name:          hostname,
+		HostID:        hostID,
 		Type:          "SSH",
 		Host:          ip,
 		Port:          22,
@@ -82,9 +91,16 @@ func RunLocalAgent(gdb *gorm.DB) {
 		Metadata:      datatypes.JSON(metaJSON),
 	}
 
-	// ✅ Save/update resource (exact same method as before)
-	if err := gdb.Where("host = ?", resource.Host).
-		Assign(resource).FirstOrCreate(&resource).Error; err != nil {
+	// ✅ Save/update resource, keyed on the host ID so a changed IP updates
+	// the existing record. Records from before host IDs match on the
+	// external ref.
+	var count int64
+	gdb.Model(&models.Resource{}).Where("org_id = ? AND host_id = ?", resource.OrgID, hostID).Count(&count)
+	key := gdb.Where("org_id = ? AND host_id = ?", resource.OrgID, hostID)
+	if count == 0 {
+		key = gdb.Where("org_id = ? AND external_ref = ? AND (host_id = '' OR host_id IS NULL)", resource.OrgID, resource.ExternalRef)
+	}
+	if err := key.Assign(resource).FirstOrCreate(&resource).Error; err != nil {
 		log.Printf("❌ Failed to register resource: %v", err)
 		return
 	}
@@ -92,24 +108,17 @@ func RunLocalAgent(gdb *gorm.DB) {
 	log.Printf("✅ Local controller registered as resource id=%d host=%s user=%s", resource.ID, resource.Host, currentUser.Username)
 
 	// ✅ Start heartbeat updater
-	go startHeartbeat(gdb, resource.Host)
+	go startHeartbeat(gdb, resource.ID)
 }
 
 // startHeartbeat keeps updating resource status every 60s
-func startHeartbeat(gdb *gorm.DB, host string) {
+func startHeartbeat(gdb *gorm.DB, resourceID int64) {
 	ticker := time.NewTicker(60 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		<-ticker.C
-		err := gdb.Model(&models.Resource{}).
-			Where("host = ?", host).
-			Updates(map[string]interface{}{
-				"last_heartbeat": time.Now(),
-				"status":         "online",
-				"updated_at":     time.Now(),
-			}).Error
-		if err != nil {
+		if err := health.Beat(gdb, resourceID); err != nil {
 			log.Printf("⚠️ Heartbeat update failed: %v", err)
 		}
 	}
@@ -190,7 +199,38 @@ func appendKeyIfMissing(authPath, pubKey string) {
 	log.Printf("🔐 Added controller public key to %s", authPath)
 }
 
-// Always return local IP (127.0.0.1)
+// loadHostID returns the controller host's stable ID kept at path,
+// creating a random UUID on first run.
+func loadHostID(path string) (string, error) {
+	if b, err := ioutil.ReadFile(path); err == nil {
+		if id := strings.TrimSpace(string(b)); id != "" {
+			return id, nil
+		}
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	id := fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	return id, ioutil.WriteFile(path, []byte(id+"\n"), 0600)
+}
+
+// getLocalIP returns the first non-loopback IPv4 address, falling back
+// to 127.0.0.1 on hosts without one.
 func getLocalIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "127.0.0.1"
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() && ipnet.IP.To4() != nil {
+			return ipnet.IP.String()
+		}
+	}
 	return "127.0.0.1"
 }
@@ -0,0 +1,55 @@
+package agentssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// account is a local user sessions run as.
+type account struct {
+	name, home, shell string
+	uid, gid          int
+	groups            []uint32
+}
+
+func lookupAccount(login string) (*account, error) {
+	u, err := user.Lookup(login)
+	if err != nil {
+		return nil, fmt.Errorf("unknown login %q", login)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("login %q has a non-numeric uid", login)
+	}
+	gid, _ := strconv.Atoi(u.Gid)
+	acct := &account{name: u.Username, home: u.HomeDir, shell: loginShell(u.Username), uid: uid, gid: gid}
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+				acct.groups = append(acct.groups, uint32(g))
+			}
+		}
+	}
+	return acct, nil
+}
+
+// loginShell reads name's shell from /etc/passwd, default /bin/sh.
+func loginShell(name string) string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return "/bin/sh"
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), ":")
+		if len(fields) == 7 && fields[0] == name && fields[6] != "" {
+			return fields[6]
+		}
+	}
+	return "/bin/sh"
+}
@@ -0,0 +1,241 @@
+// Package agentssh is the agent's own SSH server, which takes the place
+// of sshd on hosts running the agent with ssh_server enabled. It accepts
+// only certificates from the organization's host access CA, starts
+// shells, commands and SFTP as the requested local user and reports what
+// happens in sessions as Events.
+package agentssh
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"teleport_lite/internal/tunnel"
+)
+
+// Event types.
+const (
+	EventLogin    = "login"    // a connection authenticated
+	EventRejected = "rejected" // a connection failed to authenticate
+	EventShell    = "shell"
+	EventExec     = "exec"
+	EventExit     = "exit" // a shell, command or SFTP session ended
+	EventUpload   = "file_upload"
+	EventDownload = "file_download"
+	EventForward  = "port_forward"
+)
+
+// EventTypes are the event types agents may report.
+var EventTypes = map[string]bool{
+	EventLogin: true, EventRejected: true, EventShell: true, EventExec: true,
+	EventExit: true, EventUpload: true, EventDownload: true, EventForward: true,
+}
+
+// Event is something that happened on the agent's SSH server.
+type Event struct {
+	Type     string    `json:"type"`
+	Session  string    `json:"session,omitempty"` // connection ID shared by a connection's events
+	Login    string    `json:"login,omitempty"`
+	Remote   string    `json:"remote,omitempty"`
+	KeyID    string    `json:"key_id,omitempty"`
+	Command  string    `json:"command,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	Bytes    int64     `json:"bytes,omitempty"`
+	Target   string    `json:"target,omitempty"` // port forward destination
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+// keyIDExtension carries the login's key ID in the connection's
+// permissions.
+const keyIDExtension = "key-id@teleport-lite"
+
+// Server is the agent's SSH server.
+type Server struct {
+	HostKey ssh.Signer
+	// SFTPCommand starts the SFTP subsystem, normally the agent binary
+	// with the sftp-server command, which runs ServeSFTP.
+	SFTPCommand []string
+	// Events receives session events. It is called from connection
+	// goroutines and must not block.
+	Events func(Event)
+
+	mu     sync.RWMutex
+	userCA ssh.PublicKey
+}
+
+// SetUserCA sets the host access CA whose certificates are accepted.
+func (s *Server) SetUserCA(key ssh.PublicKey) {
+	s.mu.Lock()
+	s.userCA = key
+	s.mu.Unlock()
+}
+
+// UserCA returns the host access CA, nil until it is set.
+func (s *Server) UserCA() ssh.PublicKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.userCA
+}
+
+func (s *Server) emit(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	if s.Events != nil {
+		s.Events(e)
+	}
+}
+
+// config authenticates logins, which must use a host access CA
+// certificate.
+func (s *Server) config() *ssh.ServerConfig {
+	checker := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			ca := s.UserCA()
+			return ca != nil && bytes.Equal(auth.Marshal(), ca.Marshal())
+		},
+		UserKeyFallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return nil, errors.New("only controller certificates are accepted")
+		},
+	}
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			perms, err := checker.Authenticate(conn, key)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := lookupAccount(conn.User()); err != nil {
+				return nil, err
+			}
+			ext := map[string]string{keyIDExtension: key.(*ssh.Certificate).KeyId}
+			for k, v := range perms.Extensions {
+				ext[k] = v
+			}
+			return &ssh.Permissions{CriticalOptions: perms.CriticalOptions, Extensions: ext}, nil
+		},
+		ServerVersion: "SSH-2.0-TeleportLiteAgent",
+	}
+	cfg.AddHostKey(s.HostKey)
+	return cfg
+}
+
+// Serve accepts direct connections on l until it fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(nc)
+	}
+}
+
+// conn is an authenticated connection.
+type conn struct {
+	*ssh.ServerConn
+	srv     *Server
+	id      string
+	keyID   string
+	forward bool
+	pty     bool
+}
+
+// event fills in the connection's details.
+func (c *conn) event(e Event) Event {
+	e.Session, e.Login, e.Remote, e.KeyID = c.id, c.User(), c.RemoteAddr().String(), c.keyID
+	return e
+}
+
+// ServeConn runs one SSH connection, direct or through the agent's
+// reverse tunnel.
+func (s *Server) ServeConn(nc net.Conn) {
+	defer nc.Close()
+	_ = nc.SetDeadline(time.Now().Add(30 * time.Second))
+	sc, chans, reqs, err := ssh.NewServerConn(nc, s.config())
+	if err != nil {
+		var authErr *ssh.ServerAuthError
+		if errors.As(err, &authErr) {
+			var reasons []string
+			for _, e := range authErr.Errors {
+				if !errors.Is(e, ssh.ErrNoAuth) {
+					reasons = append(reasons, e.Error())
+				}
+			}
+			s.emit(Event{Type: EventRejected, Remote: nc.RemoteAddr().String(), Error: strings.Join(reasons, "; ")})
+		}
+		return
+	}
+	_ = nc.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(reqs)
+
+	_, forward := sc.Permissions.Extensions["permit-port-forwarding"]
+	_, pty := sc.Permissions.Extensions["permit-pty"]
+	c := &conn{
+		ServerConn: sc,
+		srv:        s,
+		id:         hex.EncodeToString(sc.SessionID()[:8]),
+		keyID:      sc.Permissions.Extensions[keyIDExtension],
+		forward:    forward,
+		pty:        pty,
+	}
+	s.emit(c.event(Event{Type: EventLogin}))
+
+	for nch := range chans {
+		switch nch.ChannelType() {
+		case "session":
+			ch, reqs, err := nch.Accept()
+			if err != nil {
+				continue
+			}
+			go c.serveSession(ch, reqs)
+		case "direct-tcpip":
+			go c.serveForward(nch)
+		default:
+			nch.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// serveForward connects a direct-tcpip channel to its destination.
+func (c *conn) serveForward(nch ssh.NewChannel) {
+	if !c.forward {
+		nch.Reject(ssh.Prohibited, "port forwarding not permitted")
+		return
+	}
+	var dest tunnel.DirectTCPIP
+	if err := ssh.Unmarshal(nch.ExtraData(), &dest); err != nil {
+		nch.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+		return
+	}
+	target := net.JoinHostPort(dest.DestHost, strconv.Itoa(int(dest.DestPort)))
+	nc, err := net.DialTimeout("tcp", target, 10*time.Second)
+	if err != nil {
+		c.srv.emit(c.event(Event{Type: EventForward, Target: target, Error: err.Error()}))
+		nch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nch.Accept()
+	if err != nil {
+		nc.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	c.srv.emit(c.event(Event{Type: EventForward, Target: target}))
+	tunnel.Join(ch, nc)
+}
+
+// logf logs a connection problem that isn't reported as an event.
+func (c *conn) logf(format string, args ...interface{}) {
+	log.Printf("⚠️ ssh server: %s@%s: %s", c.User(), c.RemoteAddr(), fmt.Sprintf(format, args...))
+}
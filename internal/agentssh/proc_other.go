@@ -0,0 +1,14 @@
+//go:build !unix
+
+package agentssh
+
+import (
+	"errors"
+	"os/exec"
+)
+
+func setCredential(cmd *exec.Cmd, acct *account) error {
+	return errors.New("the agent's SSH server needs a Unix host")
+}
+
+func setControllingTTY(cmd *exec.Cmd) {}
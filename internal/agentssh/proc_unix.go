@@ -0,0 +1,34 @@
+//go:build unix
+
+package agentssh
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setCredential runs cmd as acct in a new session. Only root can start
+// processes as another user.
+func setCredential(cmd *exec.Cmd, acct *account) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if acct.uid == os.Getuid() {
+		return nil
+	}
+	if os.Getuid() != 0 {
+		return fmt.Errorf("the agent must run as root to start sessions as %s", acct.name)
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{
+		Uid:    uint32(acct.uid),
+		Gid:    uint32(acct.gid),
+		Groups: acct.groups,
+	}
+	return nil
+}
+
+// setControllingTTY makes cmd's stdin its controlling terminal.
+func setControllingTTY(cmd *exec.Cmd) {
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+}
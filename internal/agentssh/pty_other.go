@@ -0,0 +1,14 @@
+//go:build !linux
+
+package agentssh
+
+import (
+	"errors"
+	"os"
+)
+
+func openPTY() (ptmx, tty *os.File, err error) {
+	return nil, nil, errors.New("terminals are only supported on Linux")
+}
+
+func setWinsize(f *os.File, cols, rows uint32) error { return nil }
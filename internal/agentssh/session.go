@@ -0,0 +1,290 @@
+package agentssh
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultPath is the PATH sessions start with.
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Request payloads, RFC 4254 6.
+type ptyRequest struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+type windowChange struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+type envRequest struct {
+	Name  string
+	Value string
+}
+
+type execRequest struct {
+	Command string
+}
+
+type subsystemRequest struct {
+	Name string
+}
+
+type exitStatus struct {
+	Status uint32
+}
+
+// session is a session channel: at most one shell, command or subsystem.
+type session struct {
+	c   *conn
+	ch  ssh.Channel
+	env []string
+
+	mu      sync.Mutex
+	pty     *ptyRequest
+	ptmx    *os.File // set while a PTY session runs
+	started bool
+}
+
+func (c *conn) serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	s := &session{c: c, ch: ch}
+	for req := range reqs {
+		ok := false
+		switch req.Type {
+		case "pty-req":
+			var p ptyRequest
+			if c.pty && ssh.Unmarshal(req.Payload, &p) == nil {
+				s.mu.Lock()
+				s.pty = &p
+				s.mu.Unlock()
+				ok = true
+			}
+		case "window-change":
+			var w windowChange
+			if ssh.Unmarshal(req.Payload, &w) == nil {
+				s.mu.Lock()
+				if s.ptmx != nil {
+					_ = setWinsize(s.ptmx, w.Columns, w.Rows)
+				}
+				s.mu.Unlock()
+				ok = true
+			}
+		case "env":
+			var e envRequest
+			if ssh.Unmarshal(req.Payload, &e) == nil && acceptEnv(e.Name) {
+				s.env = append(s.env, e.Name+"="+e.Value)
+				ok = true
+			}
+		case "shell", "exec", "subsystem":
+			ok = s.start(req)
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+}
+
+// acceptEnv lists the client variables passed on, like sshd's default
+// AcceptEnv.
+func acceptEnv(name string) bool {
+	return name == "LANG" || strings.HasPrefix(name, "LC_")
+}
+
+// start runs the request's shell, command or subsystem in the background.
+// It reports whether the request is accepted.
+func (s *session) start(req *ssh.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return false
+	}
+
+	acct, err := lookupAccount(s.c.User())
+	if err != nil {
+		s.c.logf("%v", err)
+		return false
+	}
+	var cmd *exec.Cmd
+	ev := Event{Type: EventShell}
+	sftp := false
+	switch req.Type {
+	case "shell":
+		cmd = exec.Command(acct.shell)
+		cmd.Args[0] = "-" + filepath.Base(acct.shell) // login shell
+	case "exec":
+		var r execRequest
+		if ssh.Unmarshal(req.Payload, &r) != nil {
+			return false
+		}
+		cmd = exec.Command(acct.shell, "-c", r.Command)
+		ev = Event{Type: EventExec, Command: r.Command}
+	case "subsystem":
+		var r subsystemRequest
+		if ssh.Unmarshal(req.Payload, &r) != nil || r.Name != "sftp" || len(s.c.srv.SFTPCommand) == 0 {
+			return false
+		}
+		cmd = exec.Command(s.c.srv.SFTPCommand[0], s.c.srv.SFTPCommand[1:]...)
+		ev = Event{Type: EventExec, Command: "sftp"}
+		sftp = true
+	}
+
+	cmd.Env = append([]string{
+		"HOME=" + acct.home,
+		"USER=" + acct.name,
+		"LOGNAME=" + acct.name,
+		"SHELL=" + acct.shell,
+		"PATH=" + defaultPath,
+	}, s.env...)
+	if st, err := os.Stat(acct.home); err == nil && st.IsDir() {
+		cmd.Dir = acct.home
+	} else {
+		cmd.Dir = "/"
+	}
+	if err := setCredential(cmd, acct); err != nil {
+		s.c.logf("%v", err)
+		return false
+	}
+
+	var wait func() int
+	if s.pty != nil && !sftp {
+		cmd.Env = append(cmd.Env, "TERM="+s.pty.Term)
+		wait, err = s.startPTY(cmd, acct)
+	} else {
+		wait, err = s.startPiped(cmd, sftp)
+	}
+	if err != nil {
+		s.c.logf("start %s: %v", req.Type, err)
+		return false
+	}
+	s.started = true
+	s.c.srv.emit(s.c.event(ev))
+
+	go func() {
+		code := wait()
+		s.c.srv.emit(s.c.event(Event{Type: EventExit, Command: ev.Command, ExitCode: &code}))
+		s.ch.SendRequest("exit-status", false, ssh.Marshal(exitStatus{Status: uint32(code)}))
+		s.ch.Close()
+	}()
+	return true
+}
+
+// startPTY runs cmd on a new terminal owned by acct.
+func (s *session) startPTY(cmd *exec.Cmd, acct *account) (func() int, error) {
+	ptmx, tty, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Chown(tty.Name(), acct.uid, -1)
+	_ = setWinsize(ptmx, s.pty.Columns, s.pty.Rows)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	setControllingTTY(cmd)
+	err = cmd.Start()
+	tty.Close()
+	if err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+	s.ptmx = ptmx
+
+	go io.Copy(ptmx, s.ch)
+	output := make(chan struct{})
+	go func() {
+		io.Copy(s.ch, ptmx)
+		close(output)
+	}()
+	return func() int {
+		code := exitCode(cmd.Wait())
+		// Reading the terminal ends with EIO once every process holding
+		// it has exited
+		<-output
+		s.mu.Lock()
+		s.ptmx = nil
+		s.mu.Unlock()
+		ptmx.Close()
+		return code
+	}, nil
+}
+
+// startPiped runs cmd with its standard streams on the channel. For SFTP
+// the subsystem's stderr carries transfer events rather than output.
+func (s *session) startPiped(cmd *exec.Cmd, sftp bool) (func() int, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = s.ch
+	var events io.ReadCloser
+	if sftp {
+		if events, err = cmd.StderrPipe(); err != nil {
+			return nil, err
+		}
+	} else {
+		cmd.Stderr = s.ch.Stderr()
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		io.Copy(stdin, s.ch)
+		stdin.Close()
+	}()
+	done := make(chan struct{})
+	if sftp {
+		go func() {
+			s.relayEvents(events)
+			close(done)
+		}()
+	} else {
+		close(done)
+	}
+	return func() int {
+		<-done
+		code := exitCode(cmd.Wait())
+		s.ch.CloseWrite()
+		return code
+	}, nil
+}
+
+// relayEvents reports the JSON events the SFTP subsystem writes, one per
+// line, as this connection's.
+func (s *session) relayEvents(r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil || !EventTypes[e.Type] {
+			s.c.logf("sftp: %s", sc.Text())
+			continue
+		}
+		s.c.srv.emit(s.c.event(e))
+	}
+}
+
+// exitCode is the status reported for a process that ended with err.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exitErr) && exitErr.ExitCode() >= 0:
+		return exitErr.ExitCode()
+	}
+	return 255
+}
@@ -0,0 +1,217 @@
+package agentssh
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// ServeSFTP serves SFTP on in and out with the permissions of the current
+// process, writing a JSON Event per line to events for every file
+// uploaded or downloaded. The SSH server runs it in a child process as
+// the login's user.
+func ServeSFTP(in io.Reader, out io.WriteCloser, events io.Writer) error {
+	fs := &localFS{events: json.NewEncoder(events)}
+	var opts []sftp.RequestServerOption
+	if home, err := os.UserHomeDir(); err == nil {
+		opts = append(opts, sftp.WithStartDirectory(home))
+	}
+	srv := sftp.NewRequestServer(stdio{in, out}, sftp.Handlers{FileGet: fs, FilePut: fs, FileCmd: fs, FileList: fs}, opts...)
+	defer srv.Close()
+	if err := srv.Serve(); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+type stdio struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// localFS serves the local file system.
+type localFS struct {
+	mu     sync.Mutex
+	events *json.Encoder
+}
+
+func (fs *localFS) emit(e Event) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	_ = fs.events.Encode(e)
+}
+
+func (fs *localFS) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	f, err := os.Open(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	return &transfer{File: f, fs: fs}, nil
+}
+
+func (fs *localFS) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return fs.open(r)
+}
+
+func (fs *localFS) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	return fs.open(r)
+}
+
+func (fs *localFS) open(r *sftp.Request) (*transfer, error) {
+	pflags := r.Pflags()
+	flags := os.O_WRONLY
+	if pflags.Read {
+		flags = os.O_RDWR
+	}
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(r.Filepath, flags, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &transfer{File: f, fs: fs, write: true}, nil
+}
+
+func (fs *localFS) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		return setstat(r)
+	case "Rename":
+		// SFTP renames don't replace an existing file
+		if _, err := os.Lstat(r.Target); err == nil {
+			return os.ErrExist
+		}
+		return os.Rename(r.Filepath, r.Target)
+	case "Rmdir", "Remove":
+		return os.Remove(r.Filepath)
+	case "Mkdir":
+		return os.Mkdir(r.Filepath, 0777)
+	case "Link":
+		return os.Link(r.Filepath, r.Target)
+	case "Symlink":
+		// Filepath is the link's target and Target the link
+		return os.Symlink(r.Filepath, r.Target)
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *localFS) PosixRename(r *sftp.Request) error {
+	return os.Rename(r.Filepath, r.Target)
+}
+
+func setstat(r *sftp.Request) error {
+	flags, attrs := r.AttrFlags(), r.Attributes()
+	if flags.Size {
+		if err := os.Truncate(r.Filepath, int64(attrs.Size)); err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := os.Chmod(r.Filepath, attrs.FileMode().Perm()); err != nil {
+			return err
+		}
+	}
+	if flags.UidGid {
+		if err := os.Chown(r.Filepath, int(attrs.UID), int(attrs.GID)); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		if err := os.Chtimes(r.Filepath, time.Unix(int64(attrs.Atime), 0), time.Unix(int64(attrs.Mtime), 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *localFS) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		entries, err := os.ReadDir(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		infos := make(listerAt, 0, len(entries))
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil {
+				infos = append(infos, info)
+			}
+		}
+		return infos, nil
+	case "Stat":
+		info, err := os.Stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{info}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+func (fs *localFS) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	info, err := os.Lstat(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	return listerAt{info}, nil
+}
+
+func (fs *localFS) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(out []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(out, l[offset:])
+	if n < len(out) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// transfer is an open file that reports the bytes moved when closed.
+type transfer struct {
+	*os.File
+	fs            *localFS
+	write         bool
+	read, written atomic.Int64
+}
+
+func (t *transfer) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.File.ReadAt(p, off)
+	t.read.Add(int64(n))
+	return n, err
+}
+
+func (t *transfer) WriteAt(p []byte, off int64) (int, error) {
+	n, err := t.File.WriteAt(p, off)
+	t.written.Add(int64(n))
+	return n, err
+}
+
+func (t *transfer) Close() error {
+	err := t.File.Close()
+	switch {
+	case t.write:
+		t.fs.emit(Event{Type: EventUpload, Path: t.Name(), Bytes: t.written.Load(), At: time.Now()})
+	case t.read.Load() > 0:
+		t.fs.emit(Event{Type: EventDownload, Path: t.Name(), Bytes: t.read.Load(), At: time.Now()})
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+// Package agentupdate is the contract between the controller and agents
+// for self-updates. The controller offers a target version in heartbeat
+// responses; each release build comes with a manifest of its version,
+// platform and SHA-256, signed offline with an ed25519 key whose public
+// half is pinned in the agent config, so a controller can only offer
+// builds the release key signed, for the platform and version they were
+// signed as.
+package agentupdate
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Offer tells an agent to update, sent in the heartbeat response.
+type Offer struct {
+	Version   string `json:"version"`
+	URL       string `json:"url"`       // path on the controller, agent token required
+	Manifest  string `json:"manifest"`  // the signed Manifest, JSON as signed
+	Signature string `json:"signature"` // base64 ed25519 signature of Manifest
+}
+
+// Manifest describes a release build. The release key signs it rather
+// than the binary so a signature can't be replayed for another version
+// or platform.
+type Manifest struct {
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	SHA256  string `json:"sha256"` // hex
+}
+
+// NewManifest describes binary as version for goos/goarch.
+func NewManifest(version, goos, goarch string, binary []byte) Manifest {
+	sum := sha256.Sum256(binary)
+	return Manifest{Version: version, OS: goos, Arch: goarch, SHA256: hex.EncodeToString(sum[:])}
+}
+
+// Check reports whether binary is the build m describes for version on
+// goos/goarch.
+func (m Manifest) Check(version, goos, goarch string, binary []byte) error {
+	if m.Version != version {
+		return fmt.Errorf("manifest is for version %q, offered as %q", m.Version, version)
+	}
+	if m.OS != goos || m.Arch != goarch {
+		return fmt.Errorf("manifest is for %s/%s, agent runs on %s/%s", m.OS, m.Arch, goos, goarch)
+	}
+	sum := sha256.Sum256(binary)
+	if !strings.EqualFold(m.SHA256, hex.EncodeToString(sum[:])) {
+		return errors.New("download does not match the manifest's SHA-256")
+	}
+	return nil
+}
+
+// Update states reported by agents.
+const (
+	StatePending    = "pending"     // swapped in, waiting for the new binary to check in
+	StateUpdated    = "updated"     // the new binary is running
+	StateFailed     = "failed"      // download, verification or self-test failed
+	StateRolledBack = "rolled_back" // the new binary did not come up, the old one was restored
+)
+
+// Status is the agent's latest update attempt, sent with every heartbeat.
+type Status struct {
+	State    string    `json:"state"`
+	From     string    `json:"from,omitempty"`
+	To       string    `json:"to"`
+	Error    string    `json:"error,omitempty"`
+	Attempts int       `json:"attempts,omitempty"` // starts of the new binary before it checked in
+	At       time.Time `json:"at"`
+}
+
+var versionRE = regexp.MustCompile(`^[0-9A-Za-z][0-9A-Za-z.+_-]{0,49}$`)
+
+// ValidVersion reports whether v is usable as a version, which is also a
+// directory name in the release store.
+func ValidVersion(v string) bool {
+	return versionRE.MatchString(v) && !strings.Contains(v, "..")
+}
+
+// BinaryName is the file name of the agent build for goos and goarch.
+func BinaryName(goos, goarch string) string {
+	return "teleport-agent-" + goos + "-" + goarch
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("update public key must be a base64 ed25519 public key")
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// Verify checks that sig, base64 encoded, is pub's signature of manifest
+// and decodes it.
+func Verify(pub ed25519.PublicKey, manifest []byte, sig string) (Manifest, error) {
+	var m Manifest
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sig))
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return m, errors.New("malformed signature")
+	}
+	if !ed25519.Verify(pub, manifest, raw) {
+		return m, errors.New("signature does not match the release key")
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return m, fmt.Errorf("malformed manifest: %v", err)
+	}
+	return m, nil
+}
+
+// Older reports whether version a is older than b, comparing dotted
+// numeric versions such as "1.4.0" (a leading "v" is ignored). Versions
+// that aren't numeric, like "dev", are never older or newer.
+func Older(a, b string) bool {
+	pa, oka := versionParts(a)
+	pb, okb := versionParts(b)
+	if !oka || !okb {
+		return false
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x < y
+		}
+	}
+	return false
+}
+
+// versionParts splits a dotted numeric version, dropping any pre-release
+// or build suffix after "-" or "+".
+func versionParts(v string) ([]int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, f := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+)
+
+// agentTokenPrefix starts every agent token.
+const agentTokenPrefix = "tla_"
+
+// IssueAgentCredential creates a credential for resource and returns it
+// with the token, which is not stored and can't be shown again.
+func IssueAgentCredential(db *gorm.DB, resource models.Resource) (*models.AgentCredential, string, error) {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	token := agentTokenPrefix + hex.EncodeToString(b)
+	cred := models.AgentCredential{
+		OrgID:      resource.OrgID,
+		ResourceID: resource.ID,
+		Prefix:     token[:len(agentTokenPrefix)+8],
+		Hash:       HashAPIKey(token),
+	}
+	if err := db.Create(&cred).Error; err != nil {
+		return nil, "", err
+	}
+	return &cred, token, nil
+}
+
+// LookupAgentCredential returns the unrevoked credential matching token.
+// The first use of a credential revokes the ones it replaced, so a
+// rotation completes once the agent has switched over.
+func LookupAgentCredential(db *gorm.DB, token string) (*models.AgentCredential, error) {
+	if !strings.HasPrefix(token, agentTokenPrefix) {
+		return nil, errors.New("not an agent token")
+	}
+	var cred models.AgentCredential
+	if err := db.Where("hash = ? AND revoked_at IS NULL", HashAPIKey(token)).First(&cred).Error; err != nil {
+		return nil, errors.New("unknown or revoked agent token")
+	}
+	now := time.Now()
+	if cred.LastUsedAt == nil {
+		db.Model(&models.AgentCredential{}).
+			Where("resource_id = ? AND id <> ? AND revoked_at IS NULL", cred.ResourceID, cred.ID).
+			Update("revoked_at", now)
+	}
+	db.Model(&cred).Update("last_used_at", now)
+	return &cred, nil
+}
+
+// Agent authenticates agent calls by their bearer token and stores the
+// credential in the context as "agent".
+func Agent(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing agent token"})
+			return
+		}
+		cred, err := LookupAgentCredential(db, token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set("agent", cred)
+		c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+)
+
+// apiKeyPrefix starts every API key so they are easy to recognize in
+// config files and secret scanners.
+const apiKeyPrefix = "tlk_"
+
+// NewAPIKey returns a new random API key and the short prefix shown to
+// identify it.
+func NewAPIKey() (key, prefix string) {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	key = apiKeyPrefix + hex.EncodeToString(b)
+	return key, key[:len(apiKeyPrefix)+8]
+}
+
+// HashAPIKey returns the hex SHA-256 stored for key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// LookupAPIKey returns the valid API key matching key and records its use.
+func LookupAPIKey(db *gorm.DB, key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, errors.New("not an API key")
+	}
+	var k models.APIKey
+	if err := db.Where("hash = ?", HashAPIKey(key)).First(&k).Error; err != nil {
+		return nil, errors.New("unknown API key")
+	}
+	now := time.Now()
+	if !k.Valid(now) {
+		return nil, errors.New("API key expired")
+	}
+	db.Model(&k).Update("last_used_at", now)
+	return &k, nil
+}
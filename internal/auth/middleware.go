@@ -8,6 +8,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
 
+	"teleport_lite/internal/locks"
 	"teleport_lite/internal/models"
 )
 
@@ -101,6 +102,30 @@ func JWT(db *gorm.DB, secret string) gin.HandlerFunc {
 			return
 		}
 
+		// Refuse users that are locked directly or through one of their
+		// roles; if the locks can't be read, fail closed
+		roleIDs, err := locks.RoleIDs(db, user.OrgID, user.ID)
+		var lock *models.Lock
+		if err == nil {
+			lock, err = locks.ForUser(db, user.OrgID, user.ID, roleIDs)
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "unable to check account locks"})
+			c.Abort()
+			return
+		}
+		if lock != nil {
+			accept := c.GetHeader("Accept")
+			if strings.Contains(accept, "text/html") && c.Request.Method == "GET" {
+				c.Redirect(http.StatusSeeOther, "/login")
+				c.Abort()
+				return
+			}
+			c.JSON(http.StatusForbidden, gin.H{"error": "account locked", "message": lock.Message})
+			c.Abort()
+			return
+		}
+
 		// Set claims in context and proceed
 		c.Set("claims", claims)
 		c.Next()
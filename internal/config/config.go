@@ -3,6 +3,8 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +13,24 @@ type Config struct {
 	DSN       string
 	JWTSecret string
 	AppPort   string
+
+	// SFTPMaxBytes caps a single file upload or download, default 1 GiB.
+	SFTPMaxBytes int64
+
+	// SSHProxyAddr is where the OpenSSH-compatible proxy listens, default
+	// ":3023". "off" disables it.
+	SSHProxyAddr string
+
+	// A resource without a heartbeat for ResourceDegradedAfter is degraded
+	// and for ResourceOfflineAfter offline, defaults 3m and 10m.
+	ResourceDegradedAfter time.Duration
+	ResourceOfflineAfter  time.Duration
+
+	// AgentReleasesDir holds signed agent builds offered as updates, laid
+	// out as <version>/teleport-agent-<os>-<arch> with the .manifest and
+	// .sig written by agent-release next to each.
+	// Default "internal/shared/releases".
+	AgentReleasesDir string
 }
 
 func Load() Config {
@@ -25,6 +45,9 @@ func Load() Config {
 		DSN:       os.Getenv("MYSQL_DSN"),
 		JWTSecret: os.Getenv("JWT_SECRET"),
 		AppPort:   os.Getenv("APP_PORT"),
+
+		SSHProxyAddr:     os.Getenv("SSH_PROXY_ADDR"),
+		AgentReleasesDir: os.Getenv("AGENT_RELEASES_DIR"),
 	}
 
 	if cfg.DSN == "" {
@@ -36,6 +59,34 @@ func Load() Config {
 	if cfg.AppPort == "" {
 		cfg.AppPort = "8080"
 	}
+	cfg.SFTPMaxBytes, _ = strconv.ParseInt(os.Getenv("SFTP_MAX_BYTES"), 10, 64)
+	if cfg.SFTPMaxBytes <= 0 {
+		cfg.SFTPMaxBytes = 1 << 30
+	}
+	if cfg.SSHProxyAddr == "" {
+		cfg.SSHProxyAddr = ":3023"
+	}
+	if cfg.AgentReleasesDir == "" {
+		cfg.AgentReleasesDir = "internal/shared/releases"
+	}
+	cfg.ResourceDegradedAfter = duration("RESOURCE_DEGRADED_AFTER", 3*time.Minute)
+	cfg.ResourceOfflineAfter = duration("RESOURCE_OFFLINE_AFTER", 10*time.Minute)
+	if cfg.ResourceOfflineAfter < cfg.ResourceDegradedAfter {
+		log.Fatal("❌ RESOURCE_OFFLINE_AFTER must not be shorter than RESOURCE_DEGRADED_AFTER")
+	}
 
 	return cfg
 }
+
+// duration parses env var key as a Go duration such as "90s" or "5m".
+func duration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Fatalf("❌ invalid %s %q: want a duration like 5m", key, v)
+	}
+	return d
+}
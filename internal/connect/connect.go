@@ -0,0 +1,132 @@
+// Package connect opens the controller's SSH connections to resources.
+// Terminals, file transfers, command execution, port forwards and the SSH
+// proxy all dial through here.
+package connect
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+	"teleport_lite/internal/sshca"
+)
+
+// ErrLoginNotAllowed is returned by Authorize when the user may not log
+// into the resource as the requested login.
+var ErrLoginNotAllowed = errors.New("login not allowed on this resource")
+
+// Access is a login a user is allowed on a resource. It can only be
+// obtained from Authorize, so the controller never issues credentials for
+// a login nobody checked.
+type Access struct {
+	res   models.Resource
+	login string
+}
+
+// Authorize checks with ev that user may log into res as login.
+func Authorize(ev *rbac.Evaluator, user models.User, res models.Resource, login string) (Access, error) {
+	if ok, _ := ev.Allowed(user, res.ID, login); !ok {
+		return Access{}, ErrLoginNotAllowed
+	}
+	return Access{res: res, login: login}, nil
+}
+
+// Signer returns the credential the controller logs in with for a: the
+// resource's private key stored in the DB, or for AuthCA resources a
+// fresh host access certificate.
+func Signer(a Access) (ssh.Signer, error) {
+	res := a.res
+	if a.login == "" {
+		return nil, ErrLoginNotAllowed
+	}
+	if res.AuthMethod == models.AuthCA {
+		if caDB == nil {
+			return nil, errors.New("❌ host access CA is not configured")
+		}
+		return sshca.HostAccessSigner(caDB, res.OrgID, a.login)
+	}
+	if res.PrivateKey == "" {
+		return nil, errors.New("❌ No private key found in DB for host " + res.Host)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(res.PrivateKey))
+	if err != nil {
+		return nil, errors.New("❌ Invalid private key in DB: " + err.Error())
+	}
+	return signer, nil
+}
+
+// caDB holds the host access CAs, see UseCertAuthority.
+var caDB *gorm.DB
+
+// UseCertAuthority lets Signer issue host access certificates from db.
+func UseCertAuthority(db *gorm.DB) {
+	caDB = db
+}
+
+// hostKeyCallback checks the host key pinned on res, if any.
+func hostKeyCallback(res models.Resource) (ssh.HostKeyCallback, error) {
+	if res.HostKey == "" {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(res.HostKey))
+	if err != nil {
+		return nil, errors.New("❌ Invalid pinned host key: " + err.Error())
+	}
+	return ssh.FixedHostKey(key), nil
+}
+
+// tunnels routes tunnel-connected resources, see UseTunnels.
+var tunnels *Tunnels
+
+// UseTunnels makes Dial reach tunnel-connected resources through t.
+func UseTunnels(t *Tunnels) {
+	tunnels = t
+}
+
+// Dial opens an SSH connection for a, through the agent's reverse tunnel
+// when the resource is tunnel-connected. Resources served by the agent's
+// own SSH server are always dialed on its port.
+func Dial(a Access, port string) (*ssh.Client, error) {
+	res, login := a.res, a.login
+	if res.SSHServer {
+		port = strconv.Itoa(res.Port)
+	}
+	signer, err := Signer(a)
+	if err != nil {
+		return nil, err
+	}
+	hostKey, err := hostKeyCallback(res)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ssh.ClientConfig{
+		User: login,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback: hostKey,
+		Timeout:         10 * time.Second,
+	}
+	if !res.Tunnel {
+		return ssh.Dial("tcp", res.Host+":"+port, cfg)
+	}
+
+	if tunnels == nil {
+		return nil, ErrTunnelDown
+	}
+	nc, err := tunnels.dial(res.ID, port)
+	if err != nil {
+		return nil, err
+	}
+	conn, chans, reqs, err := ssh.NewClientConn(nc, res.Host+":"+port, cfg)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return ssh.NewClient(conn, chans, reqs), nil
+}
@@ -0,0 +1,162 @@
+package connect
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/sshca"
+	"teleport_lite/internal/tunnel"
+)
+
+// tunnelKeepalive is how often the controller checks a tunnel is still
+// alive.
+const tunnelKeepalive = 30 * time.Second
+
+// ErrTunnelDown is returned when a resource's agent has no open tunnel.
+var ErrTunnelDown = errors.New("agent tunnel is not connected")
+
+// Tunnels accepts agent tunnels and dials resources through them.
+type Tunnels struct {
+	db      *gorm.DB
+	hostKey ssh.Signer
+
+	mu     sync.Mutex
+	agents map[int64]*ssh.ServerConn
+}
+
+// NewTunnels returns a tunnel server presenting the proxy host key, which
+// agents pin on first connect.
+func NewTunnels(db *gorm.DB) (*Tunnels, error) {
+	hostKey, err := sshca.ProxyHostKey(db)
+	if err != nil {
+		return nil, err
+	}
+	return &Tunnels{db: db, hostKey: hostKey, agents: map[int64]*ssh.ServerConn{}}, nil
+}
+
+// config accepts the agent key resourceID registered with, if the
+// resource is tunnel-connected.
+func (s *Tunnels) config(resourceID int64) *ssh.ServerConfig {
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			var res models.Resource
+			if err := s.db.First(&res, resourceID).Error; err != nil || !res.Tunnel {
+				return nil, errors.New("resource is not tunnel-connected")
+			}
+			registered, _, _, _, err := ssh.ParseAuthorizedKey([]byte(res.PublicKey))
+			if err != nil || !bytes.Equal(registered.Marshal(), key.Marshal()) {
+				return nil, errors.New("unknown agent key")
+			}
+			return nil, nil
+		},
+		ServerVersion: "SSH-2.0-TeleportLiteTunnel",
+	}
+	cfg.AddHostKey(s.hostKey)
+	return cfg
+}
+
+// Serve runs the tunnel of resourceID's agent over nc until it drops. A
+// newer tunnel from the same resource replaces an older one.
+func (s *Tunnels) Serve(nc net.Conn, resourceID int64) error {
+	defer nc.Close()
+	_ = nc.SetDeadline(time.Now().Add(30 * time.Second))
+	sc, chans, reqs, err := ssh.NewServerConn(nc, s.config(resourceID))
+	if err != nil {
+		return err
+	}
+	_ = nc.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		for nch := range chans {
+			nch.Reject(ssh.Prohibited, "agents may not open channels")
+		}
+	}()
+
+	s.mu.Lock()
+	if old := s.agents[resourceID]; old != nil {
+		old.Close()
+	}
+	s.agents[resourceID] = sc
+	s.mu.Unlock()
+	log.Printf("🔌 Agent tunnel up for resource %d from %s", resourceID, sc.RemoteAddr())
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(tunnelKeepalive)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if _, _, err := sc.SendRequest("keepalive@teleport-lite", true, nil); err != nil {
+					sc.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	err = sc.Wait()
+	close(done)
+
+	s.mu.Lock()
+	if s.agents[resourceID] == sc {
+		delete(s.agents, resourceID)
+	}
+	s.mu.Unlock()
+	log.Printf("🔌 Agent tunnel down for resource %d: %v", resourceID, err)
+	return nil
+}
+
+// Connected reports whether resourceID has an open tunnel.
+func (s *Tunnels) Connected(resourceID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.agents[resourceID] != nil
+}
+
+// dial opens a connection to port on the resource's loopback interface
+// through its agent's tunnel.
+func (s *Tunnels) dial(resourceID int64, port string) (net.Conn, error) {
+	s.mu.Lock()
+	sc := s.agents[resourceID]
+	s.mu.Unlock()
+	if sc == nil {
+		return nil, ErrTunnelDown
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, errors.New("invalid port " + port)
+	}
+	ch, reqs, err := sc.OpenChannel("direct-tcpip", ssh.Marshal(tunnel.DirectTCPIP{
+		DestHost: "127.0.0.1",
+		DestPort: uint32(p),
+		OrigHost: "127.0.0.1",
+	}))
+	if err != nil {
+		return nil, err
+	}
+	go ssh.DiscardRequests(reqs)
+	return tunnel.ChanConn(ch, sc.LocalAddr(), sc.RemoteAddr()), nil
+}
+
+// Disconnect closes resourceID's tunnel, if any, e.g. after its agent
+// credentials were revoked.
+func (s *Tunnels) Disconnect(resourceID int64) {
+	s.mu.Lock()
+	sc := s.agents[resourceID]
+	s.mu.Unlock()
+	if sc != nil {
+		sc.Close()
+	}
+}
@@ -0,0 +1,191 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+)
+
+// MaxConcurrency caps the probes in flight of a single job.
+const MaxConcurrency = 256
+
+// progressInterval is how often a running job's counters are saved.
+const progressInterval = time.Second
+
+// ErrJobRunning is returned when an organization already has a running
+// job.
+var ErrJobRunning = errors.New("a discovery job is already running for this organization")
+
+// Jobs runs discovery jobs in the background, one per organization at a
+// time.
+type Jobs struct {
+	db *gorm.DB
+
+	mu      sync.Mutex
+	running map[int64]context.CancelFunc // by job ID
+	orgs    map[int64]int64              // org ID -> running job ID
+}
+
+// NewJobs returns a job runner. Jobs left running by a previous process
+// are marked failed.
+func NewJobs(db *gorm.DB) *Jobs {
+	now := time.Now()
+	db.Model(&models.DiscoveryJob{}).Where("status = ?", models.DiscoveryRunning).
+		Updates(map[string]interface{}{"status": models.DiscoveryFailed, "error": "interrupted by a controller restart", "finished_at": &now})
+	return &Jobs{db: db, running: map[int64]context.CancelFunc{}, orgs: map[int64]int64{}}
+}
+
+// ParsePorts parses a comma separated port list.
+func ParsePorts(s string) ([]int, error) {
+	var ports []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		p, err := strconv.Atoi(part)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, errors.New("invalid port " + part)
+		}
+		if !seen[p] {
+			seen[p] = true
+			ports = append(ports, p)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no ports given")
+	}
+	return ports, nil
+}
+
+// Start validates job, saves it and scans in the background.
+func (j *Jobs) Start(job *models.DiscoveryJob) error {
+	hosts, err := Hosts(job.CIDR)
+	if err != nil {
+		return err
+	}
+	ports, err := ParsePorts(job.Ports)
+	if err != nil {
+		return err
+	}
+	if len(hosts)*len(ports) > MaxProbes {
+		return errors.New("too many addresses and ports, the limit is " + strconv.Itoa(MaxProbes) + " probes")
+	}
+	if job.Concurrency <= 0 {
+		job.Concurrency = 32
+	}
+	if job.Concurrency > MaxConcurrency {
+		job.Concurrency = MaxConcurrency
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, busy := j.orgs[job.OrgID]; busy {
+		return ErrJobRunning
+	}
+	job.Status = models.DiscoveryRunning
+	job.Total = len(hosts) * len(ports)
+	if err := j.db.Create(job).Error; err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j.running[job.ID] = cancel
+	j.orgs[job.OrgID] = job.ID
+	go j.run(ctx, *job, hosts, ports)
+	return nil
+}
+
+// Cancel stops a running job. It reports false if the job isn't running.
+func (j *Jobs) Cancel(jobID int64) bool {
+	j.mu.Lock()
+	cancel, ok := j.running[jobID]
+	j.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+func (j *Jobs) run(ctx context.Context, job models.DiscoveryJob, hosts []string, ports []int) {
+	var scanned, found atomic.Int64
+	save := func() {
+		j.db.Model(&models.DiscoveryJob{}).Where("id = ?", job.ID).
+			Updates(map[string]interface{}{"scanned": scanned.Load(), "found": found.Load()})
+	}
+	stop := make(chan struct{})
+	go func() {
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				save()
+			}
+		}
+	}()
+
+	Scanner{Concurrency: job.Concurrency}.Scan(ctx, hosts, ports,
+		func(hit Hit) {
+			if err := j.propose(job, hit); err != nil {
+				log.Printf("⚠️ Discovery job %d: %v", job.ID, err)
+				return
+			}
+			found.Add(1)
+		},
+		func(done int) { scanned.Store(int64(done)) },
+	)
+	close(stop)
+
+	status := models.DiscoveryDone
+	if ctx.Err() != nil {
+		status = models.DiscoveryCancelled
+	}
+	now := time.Now()
+	j.db.Model(&models.DiscoveryJob{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"scanned":     scanned.Load(),
+		"found":       found.Load(),
+		"status":      status,
+		"finished_at": &now,
+	})
+
+	j.mu.Lock()
+	delete(j.running, job.ID)
+	delete(j.orgs, job.OrgID)
+	j.mu.Unlock()
+	log.Printf("🔎 Discovery job %d %s: %d SSH servers in %s", job.ID, status, found.Load(), job.CIDR)
+}
+
+// propose records hit as a candidate, marked existing when the host is
+// already a resource of the organization.
+func (j *Jobs) propose(job models.DiscoveryJob, hit Hit) error {
+	cand := models.DiscoveryCandidate{
+		JobID:       job.ID,
+		OrgID:       job.OrgID,
+		Host:        hit.Host,
+		Port:        hit.Port,
+		Banner:      hit.Banner,
+		HostKey:     hit.HostKey,
+		Fingerprint: hit.Fingerprint,
+		Status:      models.CandidateProposed,
+	}
+	var res models.Resource
+	if err := j.db.Where("org_id = ? AND host = ? AND port = ?", job.OrgID, hit.Host, hit.Port).First(&res).Error; err == nil {
+		cand.Status = models.CandidateExisting
+		cand.ResourceID = &res.ID
+	}
+	if len(cand.Banner) > 255 {
+		cand.Banner = cand.Banner[:255]
+	}
+	return j.db.Create(&cand).Error
+}
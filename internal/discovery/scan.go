@@ -0,0 +1,180 @@
+// Package discovery finds SSH hosts that can't run an agent. A job scans
+// a CIDR range on a list of ports with bounded concurrency, records the
+// SSH banner and host key of every responding host as a candidate, and
+// admins accept candidates as resources.
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// MaxProbes caps the addresses times ports of a single job.
+const MaxProbes = 65536
+
+// Hit is an SSH server found by a scan.
+type Hit struct {
+	Host        string
+	Port        int
+	Banner      string // e.g. "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13"
+	HostKey     string // authorized_keys format
+	Fingerprint string // SHA256
+}
+
+// Hosts expands cidr into its host addresses. For IPv4 prefixes shorter
+// than /31 the network and broadcast addresses are left out.
+func Hosts(cidr string) ([]string, error) {
+	prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %q", cidr)
+	}
+	prefix = prefix.Masked()
+	bits := prefix.Addr().BitLen() - prefix.Bits()
+	if bits > 16 {
+		return nil, fmt.Errorf("%s is too large, the limit is %d addresses", cidr, MaxProbes)
+	}
+
+	var hosts []string
+	for a := prefix.Addr(); prefix.Contains(a); a = a.Next() {
+		hosts = append(hosts, a.String())
+	}
+	if prefix.Addr().Is4() && bits >= 2 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
+
+// Scanner probes addresses for SSH servers.
+type Scanner struct {
+	Concurrency int           // probes in flight, default 32
+	Timeout     time.Duration // per probe, default 3s
+}
+
+// Scan probes every host on every port until done or ctx is cancelled.
+// found is called for each SSH server and progress after each probe with
+// the number finished; both may be called from several goroutines.
+func (s Scanner) Scan(ctx context.Context, hosts []string, ports []int, found func(Hit), progress func(done int)) {
+	workers := s.Concurrency
+	if workers <= 0 {
+		workers = 32
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+
+	type probe struct {
+		host string
+		port int
+	}
+	probes := make(chan probe)
+	var mu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range probes {
+				if hit, err := Probe(ctx, p.host, p.port, timeout); err == nil {
+					found(hit)
+				}
+				mu.Lock()
+				done++
+				n := done
+				mu.Unlock()
+				progress(n)
+			}
+		}()
+	}
+
+feed:
+	for _, h := range hosts {
+		for _, port := range ports {
+			select {
+			case probes <- probe{h, port}:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+	}
+	close(probes)
+	wg.Wait()
+}
+
+// errKeyCaptured stops the handshake once the host key is known; the
+// scanner never authenticates.
+var errKeyCaptured = errors.New("host key captured")
+
+// Probe connects to host:port and, if an SSH server answers, returns its
+// banner and host key.
+func Probe(ctx context.Context, host string, port int, timeout time.Duration) (Hit, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	d := net.Dialer{Timeout: timeout}
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return Hit{}, err
+	}
+	defer nc.Close()
+	_ = nc.SetDeadline(time.Now().Add(timeout))
+
+	rec := &recordingConn{Conn: nc}
+	var key ssh.PublicKey
+	_, _, _, err = ssh.NewClientConn(rec, addr, &ssh.ClientConfig{
+		User: "discovery",
+		HostKeyCallback: func(_ string, _ net.Addr, k ssh.PublicKey) error {
+			key = k
+			return errKeyCaptured
+		},
+	})
+	banner := rec.banner()
+	if banner == "" {
+		if err == nil {
+			err = errors.New("no SSH banner")
+		}
+		return Hit{}, err
+	}
+	hit := Hit{Host: host, Port: port, Banner: banner}
+	if key != nil {
+		hit.HostKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		hit.Fingerprint = ssh.FingerprintSHA256(key)
+	}
+	return hit, nil
+}
+
+// recordingConn keeps the first bytes read so the server's version line
+// can be recovered after the handshake is aborted.
+type recordingConn struct {
+	net.Conn
+	head []byte
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if len(c.head) < 512 {
+		c.head = append(c.head, p[:n]...)
+	}
+	return n, err
+}
+
+// banner returns the SSH version line, skipping any lines the server
+// sends before it (RFC 4253 4.2).
+func (c *recordingConn) banner() string {
+	for _, line := range bytes.Split(c.head, []byte("\n")) {
+		if s := strings.TrimSpace(string(line)); strings.HasPrefix(s, "SSH-") {
+			return s
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+// Package health tracks whether resources are alive. Agents heartbeat
+// through Beat; the Monitor moves resources whose heartbeats stop to
+// degraded and then offline. Every state change is audited.
+package health
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+)
+
+// State returns the state a resource is in given the time since its last
+// heartbeat.
+func State(age, degradedAfter, offlineAfter time.Duration) string {
+	switch {
+	case age >= offlineAfter:
+		return models.ResourceOffline
+	case age >= degradedAfter:
+		return models.ResourceDegraded
+	default:
+		return models.ResourceOnline
+	}
+}
+
+// Beat records a heartbeat for resourceID, bringing it back online.
+func Beat(db *gorm.DB, resourceID int64) error {
+	var res models.Resource
+	if err := db.First(&res, resourceID).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := db.Model(&res).Updates(map[string]interface{}{
+		"last_heartbeat": now,
+		"status":         models.ResourceOnline,
+		"updated_at":     now,
+	}).Error; err != nil {
+		return err
+	}
+	if res.Status != models.ResourceOnline {
+		recordTransition(db, res, models.ResourceOnline, "heartbeat")
+	}
+	return nil
+}
+
+// Monitor periodically re-evaluates every resource's state.
+type Monitor struct {
+	DB            *gorm.DB
+	DegradedAfter time.Duration
+	OfflineAfter  time.Duration
+	Interval      time.Duration
+}
+
+// Run checks resources every Interval. It never returns.
+func (m *Monitor) Run() {
+	t := time.NewTicker(m.Interval)
+	defer t.Stop()
+	for range t.C {
+		if err := m.check(time.Now()); err != nil {
+			log.Printf("⚠️ Health check failed: %v", err)
+		}
+	}
+}
+
+func (m *Monitor) check(now time.Time) error {
+	var resources []models.Resource
+	// Resources that never heartbeat (added without an agent) are left alone
+	if err := m.DB.Where("last_heartbeat > ?", time.Time{}).Find(&resources).Error; err != nil {
+		return err
+	}
+	for _, res := range resources {
+		state := State(now.Sub(res.LastHeartbeat), m.DegradedAfter, m.OfflineAfter)
+		if state == res.Status || state == models.ResourceOnline {
+			// Only heartbeats bring a resource back online
+			continue
+		}
+		q := m.DB.Model(&models.Resource{}).
+			Where("id = ? AND status = ?", res.ID, res.Status).
+			Update("status", state)
+		if q.Error != nil {
+			return q.Error
+		}
+		if q.RowsAffected == 1 {
+			recordTransition(m.DB, res, state, "no heartbeat for "+now.Sub(res.LastHeartbeat).Truncate(time.Second).String())
+		}
+	}
+	return nil
+}
+
+// recordTransition writes the resource.status_change audit entry.
+func recordTransition(db *gorm.DB, res models.Resource, to, reason string) {
+	metaJSON, _ := json.Marshal(map[string]interface{}{
+		"name":           res.Name,
+		"host":           res.Host,
+		"from":           res.Status,
+		"to":             to,
+		"reason":         reason,
+		"last_heartbeat": res.LastHeartbeat,
+	})
+	_ = db.Create(&models.AuditLog{
+		OrgID:         res.OrgID,
+		Action:        "resource.status_change",
+		ResourceType:  "resource",
+		ResourceID:    res.ID,
+		Metadata:      datatypes.JSON(metaJSON),
+		InitiatorName: "health monitor",
+		CreatedAt:     time.Now(),
+	}).Error
+	log.Printf("🩺 Resource %s (%d): %s → %s (%s)", res.Name, res.ID, res.Status, to, reason)
+}
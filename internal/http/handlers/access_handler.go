@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+)
+
+// ExplainAccess answers "what can user Y do?". It returns the effective
+// permissions and reachable resource logins of a user (defaults to the
+// caller) along with the role, rule or grant behind each entry.
+// Optional query: user_id, resource_id, login.
+func ExplainAccess(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claimsI, ok := c.Get("claims")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		cl := claimsI.(*auth.Claims)
+
+		userID := int64(cl.UserID)
+		if v := c.Query("user_id"); v != "" {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+				return
+			}
+			userID = parsed
+		}
+
+		var user models.User
+		if err := db.Where("id = ? AND org_id = ?", userID, cl.OrgID).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+
+		ev, err := rbac.NewEvaluator(db, cl.OrgID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		exp := ev.Explain(user)
+
+		resourceID, _ := strconv.ParseInt(c.Query("resource_id"), 10, 64)
+		login := strings.TrimSpace(c.Query("login"))
+		if resourceID > 0 || login != "" {
+			filtered := []rbac.ResourceAccess{}
+			for _, ra := range exp.Resources {
+				if resourceID > 0 && ra.ResourceID != resourceID {
+					continue
+				}
+				if login != "" {
+					var logins []rbac.LoginGrant
+					for _, lg := range ra.Logins {
+						if lg.Login == login {
+							logins = append(logins, lg)
+						}
+					}
+					if len(logins) == 0 {
+						continue
+					}
+					ra.Logins = logins
+				}
+				filtered = append(filtered, ra)
+			}
+			exp.Resources = filtered
+		}
+
+		resp := gin.H{"explanation": exp}
+		if resourceID > 0 && login != "" {
+			allowed, grants := ev.Allowed(user, resourceID, login)
+			resp["allowed"] = allowed
+			resp["grants"] = grants
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// AccessMatrix answers "who can SSH to host X as root?". It lists every
+// reachable (user, resource, login) triple in the caller's organization.
+// Optional query: user_id, resource_id, host, login.
+func AccessMatrix(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claimsI, ok := c.Get("claims")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		cl := claimsI.(*auth.Claims)
+
+		query := db.Where("org_id = ?", cl.OrgID).Order("id")
+		if v := c.Query("user_id"); v != "" {
+			query = query.Where("id = ?", v)
+		}
+		var users []models.User
+		if err := query.Find(&users).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ev, err := rbac.NewEvaluator(db, cl.OrgID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		resourceID, _ := strconv.ParseInt(c.Query("resource_id"), 10, 64)
+		host := strings.TrimSpace(c.Query("host"))
+		login := strings.TrimSpace(c.Query("login"))
+
+		rows := []rbac.MatrixRow{}
+		for _, row := range ev.Matrix(users) {
+			if resourceID > 0 && row.ResourceID != resourceID {
+				continue
+			}
+			if host != "" && row.Host != host {
+				continue
+			}
+			if login != "" && row.Login != login {
+				continue
+			}
+			rows = append(rows, row)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"rows": rows})
+	}
+}
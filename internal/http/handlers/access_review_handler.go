@@ -0,0 +1,459 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+)
+
+// CreateAccessReview opens a certification campaign. It snapshots every
+// user_roles row and UserResourceAccess grant in the caller's organization
+// and spreads the resulting items across the given reviewers.
+// Expects JSON: { "name": "Q3 review", "due_in_days": 14, "reviewer_ids": [1,2] }
+func CreateAccessReview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var req struct {
+			Name        string  `json:"name" binding:"required"`
+			Description string  `json:"description"`
+			DueInDays   int     `json:"due_in_days"`
+			ReviewerIDs []int64 `json:"reviewer_ids" binding:"required,min=1"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		seen := map[int64]bool{}
+		reviewerIDs := req.ReviewerIDs[:0]
+		for _, id := range req.ReviewerIDs {
+			if !seen[id] {
+				seen[id] = true
+				reviewerIDs = append(reviewerIDs, id)
+			}
+		}
+		req.ReviewerIDs = reviewerIDs
+
+		var reviewers []models.User
+		if err := db.Where("id IN ? AND org_id = ? AND status = ?", req.ReviewerIDs, cl.OrgID, models.UserActive).
+			Order("id").Find(&reviewers).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(reviewers) != len(req.ReviewerIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reviewers must be active users in this organization"})
+			return
+		}
+
+		var roleGrants []struct {
+			UserID   int64
+			Email    string
+			RoleID   int64
+			RoleName string
+		}
+		if err := db.Table("user_roles ur").
+			Select("ur.user_id AS user_id, u.email AS email, ur.role_id AS role_id, r.name AS role_name").
+			Joins("JOIN users u ON u.id = ur.user_id").
+			Joins("JOIN roles r ON r.id = ur.role_id").
+			Where("ur.org_id = ?", cl.OrgID).
+			Order("ur.user_id, ur.role_id").
+			Scan(&roleGrants).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var accessGrants []struct {
+			ID           uint64
+			UserID       int64
+			Email        string
+			ResourceID   uint64
+			ResourceName string
+			ConnectUser  string
+		}
+		if err := db.Table("user_resource_accesses a").
+			Select("a.id AS id, a.user_id AS user_id, u.email AS email, a.resource_id AS resource_id, r.name AS resource_name, a.connect_user AS connect_user").
+			Joins("JOIN users u ON u.id = a.user_id").
+			Joins("LEFT JOIN resources r ON r.id = a.resource_id").
+			Where("a.org_id = ?", cl.OrgID).
+			Order("a.user_id, a.id").
+			Scan(&accessGrants).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Round-robin assignment, never giving a reviewer their own access
+		// to certify; selfReview names a subject nobody else can review.
+		next := 0
+		selfReview := ""
+		pickReviewer := func(subject int64, email string) int64 {
+			for i := 0; i < len(reviewers); i++ {
+				r := reviewers[(next+i)%len(reviewers)]
+				if r.ID != subject {
+					next = (next + i + 1) % len(reviewers)
+					return r.ID
+				}
+			}
+			selfReview = email
+			return 0
+		}
+
+		campaign := models.AccessReviewCampaign{
+			OrgID:       int64(cl.OrgID),
+			Name:        req.Name,
+			Description: req.Description,
+			Status:      models.ReviewOpen,
+			CreatedBy:   int64(cl.UserID),
+		}
+		if req.DueInDays > 0 {
+			due := time.Now().AddDate(0, 0, req.DueInDays)
+			campaign.DueAt = &due
+		}
+
+		for _, g := range roleGrants {
+			campaign.Items = append(campaign.Items, models.AccessReviewItem{
+				OrgID:      int64(cl.OrgID),
+				Kind:       models.ReviewItemRole,
+				UserID:     g.UserID,
+				UserEmail:  g.Email,
+				RoleID:     g.RoleID,
+				RoleName:   g.RoleName,
+				ReviewerID: pickReviewer(g.UserID, g.Email),
+				Decision:   models.ReviewPending,
+			})
+		}
+		for _, g := range accessGrants {
+			campaign.Items = append(campaign.Items, models.AccessReviewItem{
+				OrgID:        int64(cl.OrgID),
+				Kind:         models.ReviewItemResourceAccess,
+				UserID:       g.UserID,
+				UserEmail:    g.Email,
+				AccessID:     g.ID,
+				ResourceID:   g.ResourceID,
+				ResourceName: g.ResourceName,
+				ConnectUser:  g.ConnectUser,
+				ReviewerID:   pickReviewer(g.UserID, g.Email),
+				Decision:     models.ReviewPending,
+			})
+		}
+		if selfReview != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": selfReview + " would review their own access, add another reviewer"})
+			return
+		}
+
+		if err := db.Create(&campaign).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "access_review.create", "access_review", campaign.ID, map[string]interface{}{
+			"name":         campaign.Name,
+			"items":        len(campaign.Items),
+			"reviewer_ids": req.ReviewerIDs,
+		})
+
+		c.JSON(http.StatusCreated, gin.H{
+			"campaign": campaign.ID,
+			"items":    len(campaign.Items),
+		})
+	}
+}
+
+// ListAccessReviews returns campaigns of the caller's organization with
+// per-decision item counts.
+func ListAccessReviews(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var campaigns []models.AccessReviewCampaign
+		if err := db.Where("org_id = ?", cl.OrgID).Order("id DESC").Find(&campaigns).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var counts []struct {
+			CampaignID int64
+			Decision   string
+			N          int64
+		}
+		if err := db.Model(&models.AccessReviewItem{}).
+			Select("campaign_id, decision, COUNT(*) AS n").
+			Where("org_id = ?", cl.OrgID).
+			Group("campaign_id, decision").
+			Scan(&counts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		byCampaign := map[int64]map[string]int64{}
+		for _, row := range counts {
+			if byCampaign[row.CampaignID] == nil {
+				byCampaign[row.CampaignID] = map[string]int64{}
+			}
+			byCampaign[row.CampaignID][row.Decision] = row.N
+		}
+
+		out := make([]gin.H, 0, len(campaigns))
+		for _, cp := range campaigns {
+			out = append(out, gin.H{
+				"campaign": cp,
+				"counts":   byCampaign[cp.ID],
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"campaigns": out})
+	}
+}
+
+// GetAccessReview returns a campaign and all of its items.
+func GetAccessReview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var campaign models.AccessReviewCampaign
+		if err := db.Preload("Items", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+			Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).
+			First(&campaign).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "campaign not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"campaign": campaign})
+	}
+}
+
+// ListMyReviewItems returns the pending and decided items assigned to the
+// caller in open campaigns.
+func ListMyReviewItems(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var items []models.AccessReviewItem
+		if err := db.Table("access_review_items i").
+			Select("i.*").
+			Joins("JOIN access_review_campaigns cp ON cp.id = i.campaign_id").
+			Where("i.reviewer_id = ? AND i.org_id = ? AND cp.status = ?", cl.UserID, cl.OrgID, models.ReviewOpen).
+			Order("i.campaign_id, i.id").
+			Find(&items).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
+
+// DecideAccessReviewItem records a keep/revoke decision. Only the assigned
+// reviewer, or a user holding reviews:write, may decide an item.
+// Expects JSON: { "decision": "keep" | "revoke", "comment": "..." }
+func DecideAccessReviewItem(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var req struct {
+			Decision string `json:"decision" binding:"required,oneof=keep revoke"`
+			Comment  string `json:"comment"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var campaign models.AccessReviewCampaign
+		if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&campaign).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "campaign not found"})
+			return
+		}
+		if campaign.Status != models.ReviewOpen {
+			c.JSON(http.StatusConflict, gin.H{"error": "campaign is closed"})
+			return
+		}
+
+		var item models.AccessReviewItem
+		if err := db.Where("id = ? AND campaign_id = ?", c.Param("item_id"), campaign.ID).First(&item).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+			return
+		}
+
+		if item.ReviewerID != int64(cl.UserID) {
+			chk := rbac.Checker{DB: db}
+			if ok, err := chk.Can(c, cl.UserID, cl.OrgID, "reviews:write"); err != nil || !ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": "item is assigned to another reviewer"})
+				return
+			}
+		}
+
+		now := time.Now()
+		if err := db.Model(&item).Updates(map[string]interface{}{
+			"decision":   req.Decision,
+			"comment":    req.Comment,
+			"decided_at": now,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "access_review.decide", "access_review", campaign.ID, map[string]interface{}{
+			"item_id":  item.ID,
+			"kind":     item.Kind,
+			"user_id":  item.UserID,
+			"decision": req.Decision,
+			"comment":  req.Comment,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "decision recorded"})
+	}
+}
+
+// CloseAccessReview closes a campaign and applies every revoke decision.
+// Items still pending are left untouched.
+func CloseAccessReview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var campaign models.AccessReviewCampaign
+		if err := db.Preload("Items").Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&campaign).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "campaign not found"})
+			return
+		}
+		if campaign.Status != models.ReviewOpen {
+			c.JSON(http.StatusConflict, gin.H{"error": "campaign is already closed"})
+			return
+		}
+
+		now := time.Now()
+		var revoked []models.AccessReviewItem
+		pending := 0
+
+		tx := db.Begin()
+		if tx.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": tx.Error.Error()})
+			return
+		}
+		for _, item := range campaign.Items {
+			if item.Decision == models.ReviewPending {
+				pending++
+				continue
+			}
+			if item.Decision != models.ReviewRevoke || item.AppliedAt != nil {
+				continue
+			}
+
+			var err error
+			switch item.Kind {
+			case models.ReviewItemRole:
+				err = tx.Exec("DELETE FROM user_roles WHERE user_id = ? AND role_id = ? AND org_id = ?",
+					item.UserID, item.RoleID, campaign.OrgID).Error
+			case models.ReviewItemResourceAccess:
+				err = tx.Exec("DELETE FROM user_resource_accesses WHERE id = ? AND user_id = ? AND org_id = ?",
+					item.AccessID, item.UserID, campaign.OrgID).Error
+			}
+			if err == nil {
+				err = tx.Model(&models.AccessReviewItem{}).Where("id = ?", item.ID).Update("applied_at", now).Error
+			}
+			if err != nil {
+				tx.Rollback()
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			revoked = append(revoked, item)
+		}
+
+		if err := tx.Model(&campaign).Updates(map[string]interface{}{
+			"status":    models.ReviewClosed,
+			"closed_by": cl.UserID,
+			"closed_at": now,
+		}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tx.Commit().Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, item := range revoked {
+			recordAudit(db, c, "access_review.revoke", item.Kind, item.UserID, map[string]interface{}{
+				"campaign_id":  campaign.ID,
+				"item_id":      item.ID,
+				"role_id":      item.RoleID,
+				"role_name":    item.RoleName,
+				"access_id":    item.AccessID,
+				"resource_id":  item.ResourceID,
+				"connect_user": item.ConnectUser,
+			})
+		}
+		recordAudit(db, c, "access_review.close", "access_review", campaign.ID, map[string]interface{}{
+			"revoked": len(revoked),
+			"pending": pending,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "campaign closed",
+			"revoked": len(revoked),
+			"pending": pending,
+		})
+	}
+}
+
+// ExportAccessReview downloads a campaign's items as JSON (default) or CSV
+// (?format=csv).
+func ExportAccessReview(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var campaign models.AccessReviewCampaign
+		if err := db.Preload("Items", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+			Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).
+			First(&campaign).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "campaign not found"})
+			return
+		}
+
+		format := c.DefaultQuery("format", "json")
+		recordAudit(db, c, "access_review.export", "access_review", campaign.ID, map[string]interface{}{"format": format})
+
+		if format != "csv" {
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=access-review-%d.json", campaign.ID))
+			c.JSON(http.StatusOK, gin.H{"campaign": campaign})
+			return
+		}
+
+		c.Header("Content-Type", "text/csv")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=access-review-%d.csv", campaign.ID))
+		w := csv.NewWriter(c.Writer)
+		_ = w.Write([]string{"item_id", "kind", "user_id", "user_email", "role", "resource_id", "resource", "connect_user",
+			"reviewer_id", "decision", "comment", "decided_at", "applied_at"})
+		for _, it := range campaign.Items {
+			_ = w.Write([]string{
+				strconv.FormatInt(it.ID, 10),
+				it.Kind,
+				strconv.FormatInt(it.UserID, 10),
+				it.UserEmail,
+				it.RoleName,
+				strconv.FormatUint(it.ResourceID, 10),
+				it.ResourceName,
+				it.ConnectUser,
+				strconv.FormatInt(it.ReviewerID, 10),
+				it.Decision,
+				it.Comment,
+				formatTimePtr(it.DecidedAt),
+				formatTimePtr(it.AppliedAt),
+			})
+		}
+		w.Flush()
+	}
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
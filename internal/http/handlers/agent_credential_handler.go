@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/connect"
+	"teleport_lite/internal/models"
+)
+
+// orgResource loads the resource in the path if it belongs to the
+// caller's organization, responding 404 otherwise.
+func orgResource(db *gorm.DB, c *gin.Context) (models.Resource, bool) {
+	cl := c.MustGet("claims").(*auth.Claims)
+	var res models.Resource
+	if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&res).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+		return res, false
+	}
+	return res, true
+}
+
+// ListAgentCredentials returns the agent credentials issued for a
+// resource, newest first. Tokens are never returned.
+func ListAgentCredentials(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		var creds []models.AgentCredential
+		if err := db.Where("resource_id = ?", res.ID).Order("id DESC").Find(&creds).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"credentials": creds})
+	}
+}
+
+// RotateAgentCredential asks the resource's agent to switch to a new
+// token. It receives it on its next heartbeat and the old token stops
+// working once the new one is used.
+func RotateAgentCredential(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		q := db.Model(&models.AgentCredential{}).
+			Where("resource_id = ? AND revoked_at IS NULL", res.ID).
+			Update("rotate_requested", true)
+		if q.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": q.Error.Error()})
+			return
+		}
+		if q.RowsAffected == 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "resource has no active agent credential, re-register the agent"})
+			return
+		}
+
+		recordAudit(db, c, "agent.credential_rotate", "resource", res.ID, map[string]interface{}{
+			"name": res.Name,
+			"host": res.Host,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "rotation requested, the agent picks it up on its next heartbeat"})
+	}
+}
+
+// adoptionWindow is how long an adoption allowance lasts.
+const adoptionWindow = time.Hour
+
+// AllowAgentAdoption lets the next agent registering over the resource
+// within adoptionWindow take it without its agent token, e.g. for a
+// resource an admin created or whose agent credentials were revoked.
+func AllowAgentAdoption(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		until := time.Now().Add(adoptionWindow)
+		if err := db.Model(&res).Update("adoptable_until", &until).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "agent.adoption_allow", "resource", res.ID, map[string]interface{}{
+			"name":  res.Name,
+			"host":  res.Host,
+			"until": until,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "the next agent to register as this host may take it over", "adoptable_until": until})
+	}
+}
+
+// RevokeAgentCredentials revokes every credential of the resource's agent
+// and closes its tunnel. The agent has to register again, once an admin
+// allows the resource to be adopted.
+func RevokeAgentCredentials(db *gorm.DB, tunnels *connect.Tunnels) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		q := db.Model(&models.AgentCredential{}).
+			Where("resource_id = ? AND revoked_at IS NULL", res.ID).
+			Update("revoked_at", time.Now())
+		if q.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": q.Error.Error()})
+			return
+		}
+		tunnels.Disconnect(res.ID)
+
+		recordAudit(db, c, "agent.credential_revoke", "resource", res.ID, map[string]interface{}{
+			"name":    res.Name,
+			"host":    res.Host,
+			"revoked": q.RowsAffected,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "agent credentials revoked", "revoked": q.RowsAffected})
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -9,56 +10,57 @@ import (
 	"strings"
 	"time"
 
+	"teleport_lite/internal/agentupdate"
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/connect"
+	"teleport_lite/internal/health"
+	"teleport_lite/internal/inventory"
 	"teleport_lite/internal/models"
+	"teleport_lite/internal/tunnel"
 
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
 // RegisterAgent registers a remote agent in the database
-// and automatically adds its public key to authorized_keys
+// and automatically adds its public key to authorized_keys.
+// The response carries the agent token for all later agent calls.
 func RegisterAgent(gdb *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Require a registration token. If AGENT_REG_TOKEN env var is set
-		// the request must include that value. Otherwise the token must
-		// match an entry in the RegistrationToken table.
+		// the request must include that value.
 		token := c.GetHeader("X-Registration-Token")
 		if token == "" {
 			token = c.Query("token")
 		}
 		expected := os.Getenv("AGENT_REG_TOKEN")
-		var matchedToken models.RegistrationToken
-		var foundToken bool
 		if expected != "" {
 			if token == "" || token != expected {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid registration token"})
 				return
 			}
-		} else {
-			if token == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "registration token required"})
-				return
-			}
-			// Look up token in DB
-			if err := gdb.Where("token = ? AND used = false", token).First(&matchedToken).Error; err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or used registration token"})
-				return
-			}
-			// Check expiry
-			if matchedToken.ExpiresAt != nil && matchedToken.ExpiresAt.Before(time.Now()) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "registration token expired"})
-				return
-			}
-			foundToken = true
+		} else if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "registration token required"})
+			return
 		}
 		var req struct {
-			Hostname   string `json:"hostname"`
-			IP         string `json:"ip"`
-			OS         string `json:"os"`
-			PublicKey  string `json:"public_key"`
-			PrivateKey string `json:"private_key"`
-			Role       string `json:"role"`
+			Hostname   string            `json:"hostname"`
+			IP         string            `json:"ip"`
+			OS         string            `json:"os"`
+			PublicKey  string            `json:"public_key"`
+			PrivateKey string            `json:"private_key"`
+			Role       string            `json:"role"`
+			Type       string            `json:"type"`   // resource type, default SSH
+			Tunnel     bool              `json:"tunnel"` // reached through the agent's reverse tunnel
+			Labels     map[string]string `json:"labels"`
+			HostID     string            `json:"host_id"` // stable UUID from the agent's data dir
+			// SSHServer is set when the agent runs its own SSH server
+			SSHServer *struct {
+				Port    int    `json:"port"`
+				HostKey string `json:"host_key"`
+			} `json:"ssh_server"`
 		}
 
 		// ✅ Parse incoming JSON
@@ -66,6 +68,45 @@ func RegisterAgent(gdb *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 			return
 		}
+		if req.Type == "" {
+			req.Type = "SSH"
+		}
+		if req.SSHServer != nil {
+			if req.SSHServer.Port < 1 || req.SSHServer.Port > 65535 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ssh_server port"})
+				return
+			}
+			if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.SSHServer.HostKey)); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ssh_server host_key"})
+				return
+			}
+		}
+
+		// Without AGENT_REG_TOKEN the token must be an active
+		// RegistrationToken, which decides the organization and default
+		// labels. Its use is only taken once the registration is saved.
+		orgID := int64(1)
+		var matchedToken models.RegistrationToken
+		if expected == "" {
+			var status int
+			var msg string
+			matchedToken, status, msg = checkRegistrationToken(gdb, c, token, req.Type)
+			if status != http.StatusOK {
+				c.JSON(status, gin.H{"error": msg})
+				return
+			}
+			orgID = matchedToken.OrgID
+			// The token's labels win, so an agent can't label itself into
+			// the scope of rules and update targets it wasn't issued for
+			labels := map[string]string{}
+			for k, v := range req.Labels {
+				labels[k] = v
+			}
+			for k, v := range matchedToken.LabelMap() {
+				labels[k] = v
+			}
+			req.Labels = labels
+		}
 
 		// ✅ Build metadata
 		meta := map[string]interface{}{
@@ -73,14 +114,18 @@ func RegisterAgent(gdb *gorm.DB) gin.HandlerFunc {
 			"os":       req.OS,
 			"role":     req.Role,
 		}
+		if len(req.Labels) > 0 {
+			meta["labels"] = req.Labels
+		}
 
 		metaJSON, _ := json.Marshal(meta)
 
 		// ✅ Prepare resource struct
 		resource := models.Resource{
-			OrgID:         1,
+			OrgID:         orgID,
 			Name:          req.Hostname,
-			Type:          "SSH",
+			Type:          req.Type,
+			HostID:        req.HostID,
 			Host:          req.IP,
 			Port:          22,
 			ExternalRef:   "Remote Agent",
@@ -89,14 +134,99 @@ func RegisterAgent(gdb *gorm.DB) gin.HandlerFunc {
 			Status:        "online",
 			LastHeartbeat: time.Now(),
 			Metadata:      datatypes.JSON(metaJSON),
+			Tunnel:        req.Tunnel,
+		}
+
+		// ✅ Find the agent's resource by its host ID. Agents without one
+		// are matched by IP, but only to resources an agent created or an
+		// admin allowed to be adopted.
+		var existing models.Resource
+		found := false
+		if req.HostID != "" {
+			found = gdb.Where("org_id = ? AND host_id = ?", resource.OrgID, req.HostID).First(&existing).Error == nil
+		}
+		if !found {
+			q := gdb.Where("org_id = ? AND host = ?", resource.OrgID, req.IP).
+				Where("external_ref = ? OR adoptable_until > ?", resource.ExternalRef, time.Now())
+			if req.HostID != "" {
+				q = q.Where("host_id = '' OR host_id IS NULL")
+			}
+			found = q.First(&existing).Error == nil
+		}
+		// Only the agent holding the resource may re-register it, unless an
+		// admin allowed it to be adopted; a registration token alone would
+		// let anyone take it over
+		authenticated := false
+		if found {
+			var allowed bool
+			if allowed, authenticated = presentsAgentCredential(gdb, c, existing); !allowed {
+				auditRegisterConflict(gdb, c, existing, req.Hostname, req.IP)
+				c.JSON(http.StatusConflict, gin.H{"error": "host is already registered: send its agent token as a Bearer token, or have an admin allow the resource to be adopted"})
+				return
+			}
+		}
+
+		// The agent's SSH server only accepts host access certificates, and
+		// its host key is pinned; without it the host's sshd is used again
+		sshServer := map[string]interface{}{"ssh_server": false, "port": 22, "auth_method": models.AuthKey, "host_key": ""}
+		if req.SSHServer != nil {
+			sshServer = map[string]interface{}{"ssh_server": true, "port": req.SSHServer.Port, "auth_method": models.AuthCA, "host_key": strings.TrimSpace(req.SSHServer.HostKey)}
 		}
 
-		// ✅ Save or update record (same style as local_agent.go)
-		if err := gdb.Where("host = ?", req.IP).
-			Assign(resource).FirstOrCreate(&resource).Error; err != nil {
+		// ✅ Save or update record, taking a use of the registration token
+		// in the same transaction; an agent re-registering with its own
+		// agent token doesn't use one up
+		refusal := ""
+		err := gdb.Transaction(func(tx *gorm.DB) error {
+			if matchedToken.ID != 0 && !authenticated {
+				state, err := takeTokenUse(tx, &matchedToken)
+				if err != nil {
+					return err
+				}
+				if state != "active" {
+					refusal = state
+					return errTokenUnusable
+				}
+			}
+			var err error
+			if found {
+				resource.ID = existing.ID
+				err = tx.Model(&existing).Updates(resource).Error
+			} else {
+				err = tx.Create(&resource).Error
+			}
+			if err != nil {
+				return err
+			}
+			// Assign skips false, so an agent can switch the tunnel off again
+			if err := tx.Model(&resource).Update("tunnel", req.Tunnel).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&resource).Updates(sshServer).Error; err != nil {
+				return err
+			}
+			// An adoption allowance is good for one registration
+			if existing.AdoptableUntil != nil {
+				if err := tx.Model(&resource).Update("adoptable_until", nil).Error; err != nil {
+					return err
+				}
+			}
+			// Remember the resource a DB token registered
+			if matchedToken.ID != 0 {
+				return tx.Model(&matchedToken).Update("resource_id", resource.ID).Error
+			}
+			return nil
+		})
+		if refusal != "" {
+			auditTokenRefusal(gdb, c, matchedToken, refusal)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "registration token " + refusal})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "db error: " + err.Error()})
 			return
 		}
+		noteAddress(gdb, resource, existing.Host)
 
 		// ✅ Append agent key to authorized_keys
 		if err := addAgentKey(req.PublicKey); err != nil {
@@ -107,47 +237,175 @@ func RegisterAgent(gdb *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// If a DB token was used, mark it as used and associate with resource
-		if foundToken {
-			matchedToken.Used = true
-			matchedToken.ResourceID = &resource.ID
-			if err := gdb.Save(&matchedToken).Error; err != nil {
-				log.Printf("⚠️ failed to mark token used: %v", err)
-			}
+		// ✅ Issue the agent's credential, replacing any earlier one once used
+		_, agentToken, err := auth.IssueAgentCredential(gdb, resource)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue agent credential: " + err.Error()})
+			return
 		}
 
 		log.Printf("✅ Agent %s (%s) registered and key added.", req.Hostname, req.IP)
 		c.JSON(http.StatusOK, gin.H{
 			"message":     "agent registered successfully",
 			"resource_id": resource.ID,
+			"agent_token": agentToken,
 		})
 	}
 }
 
-// AgentHeartbeat updates the agent’s heartbeat timestamp
-func AgentHeartbeat(gdb *gorm.DB) gin.HandlerFunc {
+// presentsAgentCredential reports whether the request may register over
+// res: it carries an active agent credential of res (authenticated), or
+// an admin allowed res to be adopted. A resource without credentials
+// belongs to nobody until then.
+func presentsAgentCredential(db *gorm.DB, c *gin.Context, res models.Resource) (allowed, authenticated bool) {
+	if token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")); token != "" {
+		if cred, err := auth.LookupAgentCredential(db, token); err == nil && cred.ResourceID == res.ID {
+			return true, true
+		}
+	}
+	return res.AdoptableUntil != nil && res.AdoptableUntil.After(time.Now()), false
+}
+
+// errTokenUnusable aborts a registration whose token was used up or
+// revoked while it was being registered.
+var errTokenUnusable = errors.New("registration token unusable")
+
+// auditRegisterConflict records a refused attempt to register a host
+// that belongs to another agent.
+func auditRegisterConflict(db *gorm.DB, c *gin.Context, res models.Resource, hostname, ip string) {
+	metaJSON, _ := json.Marshal(map[string]interface{}{
+		"name":     res.Name,
+		"hostname": hostname,
+		"ip":       ip,
+	})
+	_ = db.Create(&models.AuditLog{
+		OrgID:         res.OrgID,
+		Action:        "agent.register_rejected",
+		ResourceType:  "resource",
+		ResourceID:    res.ID,
+		Metadata:      datatypes.JSON(metaJSON),
+		IP:            c.ClientIP(),
+		UserAgent:     c.GetHeader("User-Agent"),
+		InitiatorName: "agent",
+		CreatedAt:     time.Now(),
+	}).Error
+	log.Printf("⚠️ Refused registration of %s (%s) over resource %d without its agent token", hostname, ip, res.ID)
+}
+
+// AgentHeartbeat updates the agent’s heartbeat timestamp. The resource is
+// the one the agent's credential belongs to; when an admin asked for a
+// rotation the response carries the replacement token, and when the agent
+// is not on its target version an update offer.
+func AgentHeartbeat(gdb *gorm.DB, releasesDir string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		cred := c.MustGet("agent").(*models.AgentCredential)
 		var req struct {
-			IP string `json:"ip"`
+			IP        string              `json:"ip"`
+			Inventory *inventory.Snapshot `json:"inventory"` // optional host inventory
+			Version   string              `json:"version"`   // agent build, with OS and Arch for updates
+			OS        string              `json:"os"`
+			Arch      string              `json:"arch"`
+			Update    *agentupdate.Status `json:"update"` // last self-update attempt
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 			return
 		}
 
-		if err := gdb.Model(&models.Resource{}).
-			Where("host = ?", req.IP).
-			Updates(map[string]interface{}{
-				"last_heartbeat": time.Now(),
-				"status":         "online",
-				"updated_at":     time.Now(),
-			}).Error; err != nil {
+		if err := health.Beat(gdb, cred.ResourceID); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "update failed"})
 			return
 		}
+		if req.IP != "" {
+			if err := updateAddress(gdb, cred.ResourceID, req.IP); err != nil {
+				log.Printf("⚠️ Failed to update address for resource %d: %v", cred.ResourceID, err)
+			}
+		}
+		if req.Inventory != nil {
+			if err := storeInventory(gdb, cred.ResourceID, *req.Inventory); err != nil {
+				log.Printf("⚠️ Failed to store inventory for resource %d: %v", cred.ResourceID, err)
+			}
+		}
+
+		var resource models.Resource
+		if err := gdb.First(&resource, cred.ResourceID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		if req.Version != "" && req.Version != resource.AgentVersion {
+			if err := gdb.Model(&resource).Update("agent_version", req.Version).Error; err != nil {
+				log.Printf("⚠️ Failed to store agent version for resource %d: %v", cred.ResourceID, err)
+			}
+		}
+		if req.Update != nil {
+			if err := storeUpdateStatus(gdb, c, resource, *req.Update); err != nil {
+				log.Printf("⚠️ Failed to store update status for resource %d: %v", cred.ResourceID, err)
+			}
+			resource.UpdateStatus, _ = json.Marshal(req.Update)
+		}
 
-		log.Printf("💓 Heartbeat received from agent %s", req.IP)
-		c.JSON(http.StatusOK, gin.H{"status": "heartbeat ok"})
+		log.Printf("💓 Heartbeat received from agent %s (resource %d)", req.IP, cred.ResourceID)
+		resp := gin.H{"status": "heartbeat ok"}
+		if cred.RotateRequested {
+			if _, token, err := auth.IssueAgentCredential(gdb, resource); err == nil {
+				resp["agent_token"] = token
+			}
+		}
+		if offer := updateOffer(gdb, releasesDir, resource, req.Version, req.OS, req.Arch); offer != nil {
+			resp["update"] = offer
+		}
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// DeregisterAgent removes the calling agent's resource, used when a host
+// is decommissioned or the agent uninstalled.
+func DeregisterAgent(gdb *gorm.DB, tunnels *connect.Tunnels) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred := c.MustGet("agent").(*models.AgentCredential)
+		var res models.Resource
+		if err := gdb.First(&res, cred.ResourceID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		if err := removeResource(gdb, tunnels, res); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		metaJSON, _ := json.Marshal(map[string]interface{}{
+			"name": res.Name,
+			"host": res.Host,
+		})
+		_ = gdb.Create(&models.AuditLog{
+			OrgID:         res.OrgID,
+			Action:        "agent.deregister",
+			ResourceType:  "resource",
+			ResourceID:    res.ID,
+			Metadata:      datatypes.JSON(metaJSON),
+			IP:            c.ClientIP(),
+			UserAgent:     c.GetHeader("User-Agent"),
+			InitiatorName: "agent",
+			CreatedAt:     time.Now(),
+		}).Error
+		log.Printf("👋 Agent %s (%s) deregistered", res.Name, res.Host)
+		c.JSON(http.StatusOK, gin.H{"message": "agent deregistered"})
+	}
+}
+
+// AgentTunnelWS accepts an agent's reverse tunnel. Besides its token the
+// agent authenticates inside the tunnel with the SSH key it registered
+// with.
+func AgentTunnelWS(tunnels *connect.Tunnels) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred := c.MustGet("agent").(*models.AgentCredential)
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		if err := tunnels.Serve(tunnel.NetConn(conn), cred.ResourceID); err != nil {
+			log.Printf("⚠️ Agent tunnel from %s refused: %v", c.ClientIP(), err)
+		}
 	}
 }
 
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/agentssh"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/sshca"
+)
+
+// maxAgentEvents caps the session events accepted per request.
+const maxAgentEvents = 500
+
+// AgentSSHCA returns the host access CA of the agent's organization, the
+// only CA the agent's own SSH server accepts certificates from.
+func AgentSSHCA(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred := c.MustGet("agent").(*models.AgentCredential)
+		var res models.Resource
+		if err := db.First(&res, cred.ResourceID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		signer, err := sshca.Load(db, res.OrgID, models.CAHostAccess)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"public_key": strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))})
+	}
+}
+
+// AgentSSHEvents records session events from the agent's SSH server as
+// agent_ssh.<type> audit entries of its resource.
+// Expects JSON: { "events": [ { "type": "exec", "login": "deploy",
+// "command": "uptime", "at": "..." } ] }
+func AgentSSHEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred := c.MustGet("agent").(*models.AgentCredential)
+		var req struct {
+			Events []agentssh.Event `json:"events"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+		if len(req.Events) > maxAgentEvents {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "too many events in one request"})
+			return
+		}
+		var res models.Resource
+		if err := db.First(&res, cred.ResourceID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+
+		logs := make([]models.AuditLog, 0, len(req.Events))
+		for _, ev := range req.Events {
+			if !agentssh.EventTypes[ev.Type] {
+				continue
+			}
+			at := ev.At
+			if at.IsZero() || at.After(time.Now()) {
+				at = time.Now()
+			}
+			metaJSON, _ := json.Marshal(ev)
+			initiator := "agent"
+			if ev.Login != "" {
+				initiator = ev.Login + "@" + res.Name
+			}
+			logs = append(logs, models.AuditLog{
+				OrgID:         res.OrgID,
+				Action:        "agent_ssh." + ev.Type,
+				ResourceType:  "resource",
+				ResourceID:    res.ID,
+				Metadata:      datatypes.JSON(metaJSON),
+				IP:            c.ClientIP(),
+				UserAgent:     c.GetHeader("User-Agent"),
+				InitiatorName: initiator,
+				CreatedAt:     at,
+			})
+		}
+		if len(logs) > 0 {
+			if err := db.Create(&logs).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"recorded": len(logs)})
+	}
+}
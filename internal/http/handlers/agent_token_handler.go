@@ -5,28 +5,54 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"teleport_lite/internal/auth"
 	"teleport_lite/internal/models"
 )
 
-// CreateRegistrationToken creates a new one-time or time-limited registration token.
-// Protected endpoint — should be called by admins.
+// CreateRegistrationToken creates a new registration token for the caller's
+// organization. Protected endpoint — should be called by admins.
+// Expects JSON: { "ttl_minutes": 60, "description": "web fleet",
+// "labels": "env=prod,team=web", "allowed_types": "SSH", "max_uses": 10 }
+// max_uses defaults to 1; 0 = unlimited.
 func CreateRegistrationToken(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req struct {
-			ResourceID *int64 `json:"resource_id"`
-			TTLMinutes int    `json:"ttl_minutes"` // optional, 0 = no expiry
+			ResourceID   *int64 `json:"resource_id"`
+			TTLMinutes   int    `json:"ttl_minutes"` // optional, 0 = no expiry
+			Description  string `json:"description"`
+			Labels       string `json:"labels"`
+			AllowedTypes string `json:"allowed_types"`
+			MaxUses      *int   `json:"max_uses"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		maxUses := 1
+		if req.MaxUses != nil {
+			maxUses = *req.MaxUses
+		}
+		if maxUses < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_uses must be 0 (unlimited) or more"})
+			return
+		}
+		for _, part := range strings.Split(req.Labels, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			if kv := strings.SplitN(part, "=", 2); len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "labels must be key=value pairs, got " + part})
+				return
+			}
+		}
 
 		// generate random token
 		b := make([]byte, 32)
@@ -42,49 +68,39 @@ func CreateRegistrationToken(db *gorm.DB) gin.HandlerFunc {
 			expires = &t
 		}
 
+		cl := c.MustGet("claims").(*auth.Claims)
 		rt := models.RegistrationToken{
-			Token:      tok,
-			ResourceID: req.ResourceID,
-			ExpiresAt:  expires,
-			Used:       false,
+			OrgID:        int64(cl.OrgID),
+			Token:        tok,
+			Description:  strings.TrimSpace(req.Description),
+			Labels:       strings.TrimSpace(req.Labels),
+			AllowedTypes: strings.TrimSpace(req.AllowedTypes),
+			MaxUses:      maxUses,
+			ResourceID:   req.ResourceID,
+			ExpiresAt:    expires,
+			Used:         false,
+			CreatedBy:    int64(cl.UserID),
 		}
 
 		if err := db.Create(&rt).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-
-		// Record audit log for token creation
-		var initiatorName string
-		var initiatorID int64
-		var orgID int64
-		if claimsI, ok := c.Get("claims"); ok {
-			if cl, ok := claimsI.(*auth.Claims); ok {
-				initiatorID = int64(cl.UserID)
-				orgID = int64(cl.OrgID)
-				var u models.User
-				if err := db.First(&u, cl.UserID).Error; err == nil {
-					initiatorName = u.Name
-				}
+		// The column default replaces a zero max_uses on insert
+		if maxUses == 0 {
+			if err := db.Model(&rt).Update("max_uses", 0).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
 			}
 		}
 
-		meta := map[string]interface{}{"ttl_minutes": req.TTLMinutes}
-		metaJSON, _ := json.Marshal(meta)
-
-		audit := models.AuditLog{
-			OrgID:         orgID,
-			UserID:        initiatorID,
-			Action:        "registration_token.create",
-			ResourceType:  "registration_token",
-			ResourceID:    rt.ID,
-			Metadata:      datatypes.JSON(metaJSON),
-			IP:            c.ClientIP(),
-			UserAgent:     c.GetHeader("User-Agent"),
-			InitiatorName: initiatorName,
-			CreatedAt:     time.Now(),
-		}
-		_ = db.Create(&audit).Error
+		recordAudit(db, c, "registration_token.create", "registration_token", rt.ID, map[string]interface{}{
+			"ttl_minutes":   req.TTLMinutes,
+			"description":   rt.Description,
+			"labels":        rt.Labels,
+			"allowed_types": rt.AllowedTypes,
+			"max_uses":      rt.MaxUses,
+		})
 
 		c.JSON(http.StatusCreated, gin.H{
 			"token":      tok,
@@ -93,3 +109,126 @@ func CreateRegistrationToken(db *gorm.DB) gin.HandlerFunc {
 		})
 	}
 }
+
+// registrationTokenView is a token as listed: the secret is reduced to a
+// prefix to tell tokens apart.
+type registrationTokenView struct {
+	models.RegistrationToken
+	Prefix string `json:"prefix"`
+	State  string `json:"state"` // active, expired, exhausted or revoked
+}
+
+// ListRegistrationTokens returns the organization's registration tokens,
+// newest first.
+func ListRegistrationTokens(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+		var tokens []models.RegistrationToken
+		if err := db.Where("org_id = ?", cl.OrgID).Order("id DESC").Find(&tokens).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		views := make([]registrationTokenView, 0, len(tokens))
+		for _, t := range tokens {
+			prefix := t.Token
+			if len(prefix) > 8 {
+				prefix = prefix[:8]
+			}
+			views = append(views, registrationTokenView{RegistrationToken: t, Prefix: prefix, State: tokenState(t)})
+		}
+		c.JSON(http.StatusOK, gin.H{"tokens": views})
+	}
+}
+
+// RevokeRegistrationToken stops a token from registering further agents.
+// Resources it already registered are not affected.
+func RevokeRegistrationToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+		var rt models.RegistrationToken
+		if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&rt).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+			return
+		}
+		if rt.RevokedAt == nil {
+			now := time.Now()
+			if err := db.Model(&rt).Update("revoked_at", &now).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			recordAudit(db, c, "registration_token.revoke", "registration_token", rt.ID, map[string]interface{}{
+				"description": rt.Description,
+				"uses":        rt.Uses,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+	}
+}
+
+// tokenState names why a token can or can't be used.
+func tokenState(t models.RegistrationToken) string {
+	switch {
+	case t.RevokedAt != nil:
+		return "revoked"
+	case t.Exhausted():
+		return "exhausted"
+	case t.ExpiresAt != nil && t.ExpiresAt.Before(time.Now()):
+		return "expired"
+	}
+	return "active"
+}
+
+// checkRegistrationToken looks up token and checks that it can register
+// a resource of resourceType, without taking a use. A revoked, exhausted
+// or expired token is refused with an audit entry.
+func checkRegistrationToken(db *gorm.DB, c *gin.Context, token, resourceType string) (models.RegistrationToken, int, string) {
+	var rt models.RegistrationToken
+	if err := db.Where("token = ?", token).First(&rt).Error; err != nil {
+		return rt, http.StatusUnauthorized, "invalid registration token"
+	}
+	if state := tokenState(rt); state != "active" {
+		auditTokenRefusal(db, c, rt, state)
+		return rt, http.StatusUnauthorized, "registration token " + state
+	}
+	if !rt.AllowsType(resourceType) {
+		auditTokenRefusal(db, c, rt, "type "+resourceType+" not allowed")
+		return rt, http.StatusForbidden, "registration token does not allow resource type " + resourceType
+	}
+	return rt, http.StatusOK, ""
+}
+
+// takeTokenUse takes one use of rt in tx, holding its row lock until tx
+// ends so concurrent registrations can't overrun max_uses. It returns the
+// token's state, anything but "active" meaning no use was taken.
+func takeTokenUse(tx *gorm.DB, rt *models.RegistrationToken) (string, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(rt, rt.ID).Error; err != nil {
+		return "", err
+	}
+	if state := tokenState(*rt); state != "active" {
+		return state, nil
+	}
+	rt.Uses++
+	rt.Used = rt.MaxUses > 0 && rt.Uses >= rt.MaxUses
+	return "active", tx.Model(rt).Updates(map[string]interface{}{"uses": rt.Uses, "used": rt.Used}).Error
+}
+
+// auditTokenRefusal records an attempt to register with an unusable token.
+func auditTokenRefusal(db *gorm.DB, c *gin.Context, rt models.RegistrationToken, reason string) {
+	metaJSON, _ := json.Marshal(map[string]interface{}{
+		"reason":      reason,
+		"description": rt.Description,
+		"uses":        rt.Uses,
+		"max_uses":    rt.MaxUses,
+	})
+	_ = db.Create(&models.AuditLog{
+		OrgID:         rt.OrgID,
+		Action:        "registration_token.rejected",
+		ResourceType:  "registration_token",
+		ResourceID:    rt.ID,
+		Metadata:      datatypes.JSON(metaJSON),
+		IP:            c.ClientIP(),
+		UserAgent:     c.GetHeader("User-Agent"),
+		InitiatorName: "agent",
+		CreatedAt:     time.Now(),
+	}).Error
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/agentupdate"
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+)
+
+// updateTarget returns the version res should run: the most recently
+// changed target whose label selector matches it, else the org-wide one.
+func updateTarget(db *gorm.DB, res models.Resource) (models.AgentUpdateTarget, bool) {
+	var targets []models.AgentUpdateTarget
+	if err := db.Where("org_id = ?", res.OrgID).Order("updated_at DESC").Find(&targets).Error; err != nil {
+		return models.AgentUpdateTarget{}, false
+	}
+	var orgWide *models.AgentUpdateTarget
+	labels := res.Labels()
+	for i, t := range targets {
+		if strings.TrimSpace(t.Labels) == "" {
+			if orgWide == nil {
+				orgWide = &targets[i]
+			}
+			continue
+		}
+		if rbac.MatchLabels(t.Labels, labels) {
+			return t, true
+		}
+	}
+	if orgWide != nil {
+		return *orgWide, true
+	}
+	return models.AgentUpdateTarget{}, false
+}
+
+// releaseBinary is the path of a release build in dir.
+func releaseBinary(dir, version, goos, goarch string) string {
+	return filepath.Join(dir, version, agentupdate.BinaryName(goos, goarch))
+}
+
+// updateOffer returns the update to offer an agent running version on
+// goos/goarch, or nil. A target the agent already failed to apply is only
+// offered again once an admin sets it anew.
+func updateOffer(db *gorm.DB, releasesDir string, res models.Resource, version, goos, goarch string) *agentupdate.Offer {
+	if version == "" || goos == "" || goarch == "" {
+		return nil
+	}
+	target, ok := updateTarget(db, res)
+	if !ok || target.Version == version {
+		return nil
+	}
+	var st agentupdate.Status
+	if len(res.UpdateStatus) > 0 && json.Unmarshal(res.UpdateStatus, &st) == nil && st.To == target.Version {
+		failed := st.State == agentupdate.StateFailed || st.State == agentupdate.StateRolledBack
+		if st.State == agentupdate.StatePending || (failed && st.At.After(target.UpdatedAt)) {
+			return nil
+		}
+	}
+	bin := releaseBinary(releasesDir, target.Version, goos, goarch)
+	manifest, err := os.ReadFile(bin + ".manifest")
+	var sig []byte
+	if err == nil {
+		sig, err = os.ReadFile(bin + ".sig")
+	}
+	if err == nil {
+		_, err = os.Stat(bin)
+	}
+	if err != nil {
+		log.Printf("⚠️ Agent release %s for %s/%s unavailable: %v", target.Version, goos, goarch, err)
+		return nil
+	}
+	return &agentupdate.Offer{
+		Version:   target.Version,
+		URL:       "/agents/update/" + target.Version + "/" + goos + "/" + goarch,
+		Manifest:  string(manifest),
+		Signature: strings.TrimSpace(string(sig)),
+	}
+}
+
+// storeUpdateStatus saves the agent's reported update status, auditing
+// the outcome of an attempt when its state changes.
+func storeUpdateStatus(db *gorm.DB, c *gin.Context, res models.Resource, st agentupdate.Status) error {
+	var prev agentupdate.Status
+	if len(res.UpdateStatus) > 0 {
+		_ = json.Unmarshal(res.UpdateStatus, &prev)
+	}
+	if prev.State == st.State && prev.To == st.To && prev.At.Equal(st.At) {
+		return nil
+	}
+	data, _ := json.Marshal(st)
+	if err := db.Model(&models.Resource{}).Where("id = ?", res.ID).
+		Update("update_status", datatypes.JSON(data)).Error; err != nil {
+		return err
+	}
+	if st.State == agentupdate.StatePending {
+		return nil
+	}
+	_ = db.Create(&models.AuditLog{
+		OrgID:         res.OrgID,
+		Action:        "agent.update_" + st.State,
+		ResourceType:  "resource",
+		ResourceID:    res.ID,
+		Metadata:      datatypes.JSON(data),
+		IP:            c.ClientIP(),
+		UserAgent:     c.GetHeader("User-Agent"),
+		InitiatorName: "agent",
+		CreatedAt:     time.Now(),
+	}).Error
+	log.Printf("⬆️ Agent update on resource %d: %s %s -> %s", res.ID, st.State, st.From, st.To)
+	return nil
+}
+
+// AgentDownload serves a release build to an agent being offered it.
+func AgentDownload(releasesDir string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version, goos, goarch := c.Param("version"), c.Param("os"), c.Param("arch")
+		if !agentupdate.ValidVersion(version) || !agentupdate.ValidVersion(goos) || !agentupdate.ValidVersion(goarch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid release"})
+			return
+		}
+		bin := releaseBinary(releasesDir, version, goos, goarch)
+		if _, err := os.Stat(bin); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "release not found"})
+			return
+		}
+		c.FileAttachment(bin, filepath.Base(bin))
+	}
+}
+
+// ListAgentUpdateTargets returns the organization's agent version targets.
+func ListAgentUpdateTargets(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+		var targets []models.AgentUpdateTarget
+		if err := db.Where("org_id = ?", cl.OrgID).Order("labels").Find(&targets).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"targets": targets})
+	}
+}
+
+// SetAgentUpdateTarget sets the agent version for the org, or for the
+// resources matching a label selector. Setting a target again retries
+// agents whose earlier attempt at it failed.
+// Expects JSON: { "version": "1.4.0", "labels": "env=staging" }
+func SetAgentUpdateTarget(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+		var req struct {
+			Version string `json:"version" binding:"required"`
+			Labels  string `json:"labels"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !agentupdate.ValidVersion(req.Version) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version " + req.Version})
+			return
+		}
+		req.Labels = strings.TrimSpace(req.Labels)
+
+		var target models.AgentUpdateTarget
+		err := db.Where("org_id = ? AND labels = ?", cl.OrgID, req.Labels).First(&target).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			target = models.AgentUpdateTarget{OrgID: int64(cl.OrgID), Labels: req.Labels}
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		target.Version = req.Version
+		target.UpdatedAt = time.Now()
+		if err := db.Save(&target).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "agent_update.target_set", "agent_update_target", target.ID, target)
+		c.JSON(http.StatusOK, gin.H{"target": target})
+	}
+}
+
+// DeleteAgentUpdateTarget removes a version target; agents it applied to
+// stay on their current version.
+func DeleteAgentUpdateTarget(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+		var target models.AgentUpdateTarget
+		if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&target).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "target not found"})
+			return
+		}
+		if err := db.Delete(&target).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(db, c, "agent_update.target_delete", "agent_update_target", target.ID, target)
+		c.JSON(http.StatusOK, gin.H{"message": "target deleted"})
+	}
+}
+
+// GetResourceUpdate returns a resource's agent version, the version it
+// should run and its last update attempt.
+func GetResourceUpdate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		var target interface{}
+		if t, ok := updateTarget(db, res); ok {
+			target = t
+		}
+		var status interface{}
+		if len(res.UpdateStatus) > 0 {
+			status = res.UpdateStatus
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"resource_id":   res.ID,
+			"agent_version": res.AgentVersion,
+			"target":        target,
+			"status":        status,
+		})
+	}
+}
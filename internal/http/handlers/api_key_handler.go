@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/models"
+)
+
+// ListAPIKeys returns the caller's API keys. Secrets are never returned.
+func ListAPIKeys(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var keys []models.APIKey
+		if err := db.Where("user_id = ?", cl.UserID).Order("id DESC").Find(&keys).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+	}
+}
+
+// CreateAPIKey issues an API key for the caller. The key is only shown in
+// this response.
+// Expects JSON: { "name": "laptop", "ttl_days": 90 }
+func CreateAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var req struct {
+			Name    string `json:"name" binding:"required"`
+			TTLDays int    `json:"ttl_days"` // optional, 0 = no expiry
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		secret, prefix := auth.NewAPIKey()
+		key := models.APIKey{
+			OrgID:  int64(cl.OrgID),
+			UserID: int64(cl.UserID),
+			Name:   strings.TrimSpace(req.Name),
+			Prefix: prefix,
+			Hash:   auth.HashAPIKey(secret),
+		}
+		if req.TTLDays > 0 {
+			t := time.Now().AddDate(0, 0, req.TTLDays)
+			key.ExpiresAt = &t
+		}
+		if err := db.Create(&key).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "apikey.create", "api_key", key.ID, map[string]interface{}{
+			"name":       key.Name,
+			"prefix":     key.Prefix,
+			"expires_at": key.ExpiresAt,
+		})
+		c.JSON(http.StatusCreated, gin.H{"api_key": key, "key": secret})
+	}
+}
+
+// DeleteAPIKey revokes one of the caller's API keys.
+func DeleteAPIKey(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var key models.APIKey
+		if err := db.Where("id = ? AND user_id = ?", c.Param("id"), cl.UserID).First(&key).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+			return
+		}
+		if err := db.Delete(&key).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "apikey.delete", "api_key", key.ID, map[string]interface{}{
+			"name":   key.Name,
+			"prefix": key.Prefix,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/models"
+)
+
+// recordAudit writes an audit log entry attributed to the caller in c.
+// Failures are ignored, matching the inline audit writes elsewhere.
+func recordAudit(db *gorm.DB, c *gin.Context, action, resourceType string, resourceID int64, meta interface{}) {
+	var initiatorName string
+	var initiatorID int64
+	var orgID int64
+	if claimsI, ok := c.Get("claims"); ok {
+		if cl, ok := claimsI.(*auth.Claims); ok {
+			initiatorID = int64(cl.UserID)
+			orgID = int64(cl.OrgID)
+			var u models.User
+			if err := db.First(&u, cl.UserID).Error; err == nil {
+				initiatorName = u.Name
+			}
+		}
+	}
+
+	metaJSON, _ := json.Marshal(meta)
+	audit := models.AuditLog{
+		OrgID:         orgID,
+		UserID:        initiatorID,
+		Action:        action,
+		ResourceType:  resourceType,
+		ResourceID:    resourceID,
+		Metadata:      datatypes.JSON(metaJSON),
+		IP:            c.ClientIP(),
+		UserAgent:     c.GetHeader("User-Agent"),
+		InitiatorName: initiatorName,
+		CreatedAt:     time.Now(),
+	}
+	_ = db.Create(&audit).Error
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/discovery"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/sshca"
+)
+
+// StartDiscovery starts a scan for SSH servers.
+// Expects JSON: { "cidr": "10.0.4.0/24", "ports": "22,2222", "concurrency": 64 }
+// ports defaults to 22. Progress is read from GetDiscoveryJob.
+func StartDiscovery(db *gorm.DB, jobs *discovery.Jobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+		var req struct {
+			CIDR        string `json:"cidr" binding:"required"`
+			Ports       string `json:"ports"`
+			Concurrency int    `json:"concurrency" binding:"min=0"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(req.Ports) == "" {
+			req.Ports = "22"
+		}
+
+		job := models.DiscoveryJob{
+			OrgID:       int64(cl.OrgID),
+			CIDR:        strings.TrimSpace(req.CIDR),
+			Ports:       req.Ports,
+			Concurrency: req.Concurrency,
+			CreatedBy:   int64(cl.UserID),
+		}
+		if err := jobs.Start(&job); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, discovery.ErrJobRunning) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "discovery.start", "discovery_job", job.ID, map[string]interface{}{
+			"cidr": job.CIDR, "ports": job.Ports, "concurrency": job.Concurrency,
+		})
+		c.JSON(http.StatusAccepted, gin.H{"job": job})
+	}
+}
+
+// ListDiscoveryJobs returns the organization's discovery jobs, newest
+// first.
+func ListDiscoveryJobs(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+		var jobs []models.DiscoveryJob
+		if err := db.Where("org_id = ?", cl.OrgID).Order("id DESC").Limit(50).Find(&jobs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+	}
+}
+
+// GetDiscoveryJob returns a job's progress and the candidates found so
+// far. ?status=proposed filters candidates.
+func GetDiscoveryJob(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := orgDiscoveryJob(db, c)
+		if !ok {
+			return
+		}
+		q := db.Where("job_id = ?", job.ID)
+		if status := c.Query("status"); status != "" {
+			q = q.Where("status IN ?", strings.Split(status, ","))
+		}
+		var cands []models.DiscoveryCandidate
+		if err := q.Order("id").Find(&cands).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"job": job, "candidates": cands})
+	}
+}
+
+// CancelDiscoveryJob stops a running job; candidates found so far stay.
+func CancelDiscoveryJob(db *gorm.DB, jobs *discovery.Jobs) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := orgDiscoveryJob(db, c)
+		if !ok {
+			return
+		}
+		if !jobs.Cancel(job.ID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "job is not running"})
+			return
+		}
+		recordAudit(db, c, "discovery.cancel", "discovery_job", job.ID, map[string]interface{}{"cidr": job.CIDR})
+		c.JSON(http.StatusOK, gin.H{"message": "job cancelled"})
+	}
+}
+
+// AcceptCandidate turns a proposed candidate into an agentless resource
+// with the discovered host key pinned. The controller logs in with a
+// certificate from the host access CA (see HostAccessCA) or a stored key.
+// A candidate whose host key wasn't discovered needs host_key, in
+// authorized_keys format, from the admin.
+// Expects JSON: { "name": "db-7", "labels": {"env": "prod"},
+// "auth_method": "ca" } or { "auth_method": "key", "private_key": "-----BEGIN ..." }
+func AcceptCandidate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cand, ok := orgCandidate(db, c)
+		if !ok {
+			return
+		}
+		if cand.Status != models.CandidateProposed {
+			c.JSON(http.StatusConflict, gin.H{"error": "candidate is " + cand.Status})
+			return
+		}
+		var req struct {
+			Name       string            `json:"name"`
+			Labels     map[string]string `json:"labels"`
+			AuthMethod string            `json:"auth_method" binding:"required,oneof=ca key"`
+			PrivateKey string            `json:"private_key"`
+			HostKey    string            `json:"host_key"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.AuthMethod == models.AuthKey {
+			if _, err := ssh.ParsePrivateKey([]byte(req.PrivateKey)); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "private_key must be an unencrypted SSH private key"})
+				return
+			}
+		} else {
+			req.PrivateKey = ""
+		}
+		hostKey := cand.HostKey
+		if hostKey == "" {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.HostKey))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "no host key was discovered for this candidate, host_key must be given in authorized_keys format"})
+				return
+			}
+			hostKey = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		}
+		if req.Name == "" {
+			req.Name = cand.Host
+		}
+
+		meta := map[string]interface{}{"banner": cand.Banner, "discovery_job": cand.JobID}
+		if len(req.Labels) > 0 {
+			meta["labels"] = req.Labels
+		}
+		metaJSON, _ := json.Marshal(meta)
+		res := models.Resource{
+			OrgID:       cand.OrgID,
+			Name:        req.Name,
+			Type:        "SSH",
+			Host:        cand.Host,
+			Port:        cand.Port,
+			ExternalRef: "Discovered",
+			PrivateKey:  req.PrivateKey,
+			Status:      models.ResourceAgentless,
+			Metadata:    datatypes.JSON(metaJSON),
+			AuthMethod:  req.AuthMethod,
+			HostKey:     hostKey,
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var n int64
+			if err := tx.Model(&models.Resource{}).Where("org_id = ? AND host = ? AND port = ?", cand.OrgID, cand.Host, cand.Port).Count(&n).Error; err != nil {
+				return err
+			}
+			if n > 0 {
+				return errors.New("a resource for " + cand.Host + " already exists")
+			}
+			if err := tx.Create(&res).Error; err != nil {
+				return err
+			}
+			return tx.Model(&cand).Updates(map[string]interface{}{"status": models.CandidateAccepted, "resource_id": res.ID}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "discovery.accept", "resource", res.ID, map[string]interface{}{
+			"candidate_id": cand.ID, "host": cand.Host, "port": cand.Port,
+			"fingerprint": cand.Fingerprint, "auth_method": res.AuthMethod,
+		})
+		c.JSON(http.StatusCreated, gin.H{"resource": res})
+	}
+}
+
+// RejectCandidate dismisses a proposed candidate.
+func RejectCandidate(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cand, ok := orgCandidate(db, c)
+		if !ok {
+			return
+		}
+		if cand.Status != models.CandidateProposed {
+			c.JSON(http.StatusConflict, gin.H{"error": "candidate is " + cand.Status})
+			return
+		}
+		if err := db.Model(&cand).Update("status", models.CandidateRejected).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(db, c, "discovery.reject", "discovery_candidate", cand.ID, map[string]interface{}{
+			"host": cand.Host, "port": cand.Port,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "candidate rejected"})
+	}
+}
+
+// HostAccessCA returns the public key agentless hosts list in sshd's
+// TrustedUserCAKeys so the controller can log in with certificates.
+// Certificates carry the login as their principal.
+func HostAccessCA(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+		signer, err := sshca.Load(db, int64(cl.OrgID), models.CAHostAccess)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"public_key": strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))})
+	}
+}
+
+func orgDiscoveryJob(db *gorm.DB, c *gin.Context) (models.DiscoveryJob, bool) {
+	cl := c.MustGet("claims").(*auth.Claims)
+	var job models.DiscoveryJob
+	if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&job).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return job, false
+	}
+	return job, true
+}
+
+func orgCandidate(db *gorm.DB, c *gin.Context) (models.DiscoveryCandidate, bool) {
+	cl := c.MustGet("claims").(*auth.Claims)
+	var cand models.DiscoveryCandidate
+	if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&cand).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "candidate not found"})
+		return cand, false
+	}
+	return cand, true
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/connect"
+	"teleport_lite/internal/locks"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+)
+
+// Exec limits. Output beyond execOutputLimit per stream is dropped and
+// the result is marked truncated.
+const (
+	execDefaultTimeout     = 30 * time.Second
+	execMaxTimeout         = 10 * time.Minute
+	execDefaultConcurrency = 10
+	execMaxConcurrency     = 50
+	execOutputLimit        = 1 << 20
+	execMaxCommandLen      = 4096
+)
+
+type execRequest struct {
+	Login          string `json:"login" binding:"required"`
+	Command        string `json:"command" binding:"required"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	Port           string `json:"port"`
+}
+
+// execResult is the outcome of one command on one resource. ExitCode is -1
+// when the command did not finish.
+type execResult struct {
+	ResourceID   int64  `json:"resource_id"`
+	ResourceName string `json:"resource_name"`
+	Host         string `json:"host"`
+	Status       string `json:"status"` // ok, failed, timeout, denied, error
+	ExitCode     int    `json:"exit_code"`
+	Stdout       string `json:"stdout"`
+	Stderr       string `json:"stderr"`
+	Truncated    bool   `json:"truncated,omitempty"`
+	Error        string `json:"error,omitempty"`
+	DurationMS   int64  `json:"duration_ms"`
+}
+
+func (r *execRequest) normalize() error {
+	r.Login = strings.TrimSpace(r.Login)
+	if len(r.Command) > execMaxCommandLen {
+		return errors.New("command too long")
+	}
+	if r.Port == "" {
+		r.Port = "22"
+	}
+	return nil
+}
+
+func (r *execRequest) timeout() time.Duration {
+	t := time.Duration(r.TimeoutSeconds) * time.Second
+	if t <= 0 {
+		return execDefaultTimeout
+	}
+	if t > execMaxTimeout {
+		return execMaxTimeout
+	}
+	return t
+}
+
+// ExecResource runs a command on one resource as an allowed login and
+// returns its output and exit code.
+// Expects JSON: { "login": "ubuntu", "command": "uptime", "timeout_seconds": 30 }
+func ExecResource(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var req execRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := req.normalize(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var res models.Resource
+		if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&res).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+
+		ex, err := newExecutor(db, cl)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		result := ex.run(c.Request.Context(), res, req)
+		recordAudit(db, c, "resource.exec", "resource", res.ID, execAuditMeta(result, req, ""))
+
+		status := http.StatusOK
+		if result.Status == "denied" {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"result": result})
+	}
+}
+
+// ExecBatch runs a command on many resources, selected by ID and/or a
+// label selector, at most concurrency at a time. Resources where the
+// login is not allowed are reported as denied and not contacted.
+// Expects JSON: { "resource_ids": [1,2], "labels": "env=prod", "login": "ubuntu",
+// "command": "uptime", "timeout_seconds": 30, "concurrency": 10 }
+func ExecBatch(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var req struct {
+			execRequest
+			ResourceIDs []int64 `json:"resource_ids"`
+			Labels      string  `json:"labels"`
+			Concurrency int     `json:"concurrency"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := req.normalize(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.ResourceIDs) == 0 && strings.TrimSpace(req.Labels) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "resource_ids or labels required"})
+			return
+		}
+		if req.Concurrency <= 0 {
+			req.Concurrency = execDefaultConcurrency
+		}
+		if req.Concurrency > execMaxConcurrency {
+			req.Concurrency = execMaxConcurrency
+		}
+
+		query := db.Where("org_id = ?", cl.OrgID).Order("id")
+		if len(req.ResourceIDs) > 0 {
+			query = query.Where("id IN ?", req.ResourceIDs)
+		}
+		var all []models.Resource
+		if err := query.Find(&all).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var targets []models.Resource
+		for _, r := range all {
+			if rbac.MatchLabels(req.Labels, r.Labels()) {
+				targets = append(targets, r)
+			}
+		}
+		if len(targets) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no matching resources"})
+			return
+		}
+
+		ex, err := newExecutor(db, cl)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		batchID := newBatchID()
+		results := make([]execResult, len(targets))
+		sem := make(chan struct{}, req.Concurrency)
+		var wg sync.WaitGroup
+		for i, res := range targets {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, res models.Resource) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				results[i] = ex.run(c.Request.Context(), res, req.execRequest)
+			}(i, res)
+		}
+		wg.Wait()
+
+		summary := map[string]int{}
+		for i, r := range results {
+			summary[r.Status]++
+			recordAudit(db, c, "resource.exec", "resource", targets[i].ID, execAuditMeta(r, req.execRequest, batchID))
+		}
+
+		c.JSON(http.StatusOK, gin.H{"batch_id": batchID, "summary": summary, "results": results})
+	}
+}
+
+// executor checks access and runs commands for one caller.
+type executor struct {
+	db      *gorm.DB
+	user    models.User
+	roleIDs []int64
+	ev      *rbac.Evaluator
+}
+
+func newExecutor(db *gorm.DB, cl *auth.Claims) (*executor, error) {
+	var user models.User
+	if err := db.First(&user, cl.UserID).Error; err != nil {
+		return nil, err
+	}
+	ev, err := rbac.NewEvaluator(db, cl.OrgID)
+	if err != nil {
+		return nil, err
+	}
+	roleIDs, err := locks.RoleIDs(db, user.OrgID, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &executor{db: db, user: user, roleIDs: roleIDs, ev: ev}, nil
+}
+
+// run checks that the caller may use req.Login on res, then runs the
+// command with the request's timeout.
+func (ex *executor) run(ctx context.Context, res models.Resource, req execRequest) (result execResult) {
+	result = execResult{ResourceID: res.ID, ResourceName: res.Name, Host: res.Host, ExitCode: -1}
+
+	access, err := connect.Authorize(ex.ev, ex.user, res, req.Login)
+	if err != nil {
+		result.Status, result.Error = "denied", "login "+req.Login+" not allowed on this resource"
+		return result
+	}
+	if msg := locks.Refusal(ex.db, ex.user.OrgID, ex.user.ID, ex.roleIDs, res.ID, req.Login); msg != "" {
+		result.Status, result.Error = "denied", msg
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, req.timeout())
+	defer cancel()
+	start := time.Now()
+	defer func() { result.DurationMS = time.Since(start).Milliseconds() }()
+
+	client, err := connect.Dial(access, req.Port)
+	if err != nil {
+		result.Status, result.Error = "error", "ssh dial error: "+err.Error()
+		return result
+	}
+	defer client.Close()
+
+	sshSession, err := client.NewSession()
+	if err != nil {
+		result.Status, result.Error = "error", "ssh session error: "+err.Error()
+		return result
+	}
+	defer sshSession.Close()
+
+	stdout := &cappedBuffer{max: execOutputLimit}
+	stderr := &cappedBuffer{max: execOutputLimit}
+	sshSession.Stdout = stdout
+	sshSession.Stderr = stderr
+
+	done := make(chan error, 1)
+	go func() { done <- sshSession.Run(req.Command) }()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		_ = sshSession.Signal(ssh.SIGKILL)
+		_ = client.Close()
+		<-done
+		result.Status, result.Error = "timeout", "command timed out after "+req.timeout().String()
+		result.Stdout, result.Stderr = stdout.String(), stderr.String()
+		result.Truncated = stdout.truncated || stderr.truncated
+		return result
+	}
+
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
+	result.Truncated = stdout.truncated || stderr.truncated
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		result.Status, result.ExitCode = "ok", 0
+	case errors.As(err, &exitErr):
+		result.Status, result.ExitCode = "failed", exitErr.ExitStatus()
+	default:
+		result.Status, result.Error = "error", err.Error()
+	}
+	return result
+}
+
+// execAuditMeta is the audit metadata of one command invocation. Output
+// is not stored.
+func execAuditMeta(r execResult, req execRequest, batchID string) map[string]interface{} {
+	meta := map[string]interface{}{
+		"host":        r.Host,
+		"login":       req.Login,
+		"command":     req.Command,
+		"status":      r.Status,
+		"exit_code":   r.ExitCode,
+		"duration_ms": r.DurationMS,
+	}
+	if r.Error != "" {
+		meta["error"] = r.Error
+	}
+	if batchID != "" {
+		meta["batch_id"] = batchID
+	}
+	return meta
+}
+
+func newBatchID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the
+// rest, so a chatty command cannot exhaust memory.
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if room := b.max - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/provision"
+	"teleport_lite/internal/rbac"
+)
+
+// hostLogins computes the Unix accounts res should have: every login an
+// active user may use on it, with the groups, shell and sudoers rules of
+// the roles that grant that login. Groups and rules are merged across
+// roles; the shell of the lowest role ID that sets one wins.
+func hostLogins(db *gorm.DB, res models.Resource) ([]provision.Login, error) {
+	ev, err := rbac.NewEvaluator(db, uint64(res.OrgID))
+	if err != nil {
+		return nil, err
+	}
+	var users []models.User
+	if err := db.Where("org_id = ?", res.OrgID).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	var policies []models.RolePolicy
+	if err := db.Where("org_id = ?", res.OrgID).Order("role_id").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	policyOf := map[int64]models.RolePolicy{}
+	for _, p := range policies {
+		policyOf[p.RoleID] = p
+	}
+
+	logins := map[string]*provision.Login{}
+	shellRole := map[string]int64{}
+	for _, u := range users {
+		if u.Status != models.UserActive {
+			continue
+		}
+		exp := ev.Explain(u)
+		for _, ra := range exp.Resources {
+			if ra.ResourceID != res.ID {
+				continue
+			}
+			for _, lg := range ra.Logins {
+				l := logins[lg.Login]
+				if l == nil {
+					l = &provision.Login{Name: lg.Login}
+					logins[lg.Login] = l
+				}
+				// Only the roles granting this login shape it; direct
+				// user_resource_access grants bring no groups or sudo
+				for _, g := range lg.Grants {
+					p, ok := policyOf[g.RoleID]
+					if g.RoleID == 0 || !ok {
+						continue
+					}
+					l.Groups = appendUnique(l.Groups, splitTrim(p.HostGroups, ",")...)
+					l.Sudoers = appendUnique(l.Sudoers, splitTrim(p.HostSudoers, "\n")...)
+					if p.HostShell != "" && (l.Shell == "" || g.RoleID < shellRole[l.Name]) {
+						l.Shell, shellRole[l.Name] = p.HostShell, g.RoleID
+					}
+				}
+			}
+		}
+	}
+
+	out := make([]provision.Login, 0, len(logins))
+	for _, l := range logins {
+		if !provision.ValidName(l.Name) || l.Name == "root" {
+			continue
+		}
+		sort.Strings(l.Groups)
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// AgentLogins returns the accounts the calling agent's host should have.
+func AgentLogins(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred := c.MustGet("agent").(*models.AgentCredential)
+		var res models.Resource
+		if err := db.First(&res, cred.ResourceID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+		logins, err := hostLogins(db, res)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"logins": logins})
+	}
+}
+
+// AgentLoginReport stores the outcome of an agent's account
+// reconciliation. Accounts created, deleted or failing are audited.
+func AgentLoginReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cred := c.MustGet("agent").(*models.AgentCredential)
+		var report provision.Report
+		if err := c.ShouldBindJSON(&report); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+			return
+		}
+		report.At = time.Now()
+		data, _ := json.Marshal(report)
+		if err := db.Model(&models.Resource{}).Where("id = ?", cred.ResourceID).
+			Update("provisioning", datatypes.JSON(data)).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		var changes []provision.Result
+		for _, r := range report.Results {
+			if r.Action != provision.ActionUnchanged {
+				changes = append(changes, r)
+			}
+		}
+		if len(changes) > 0 {
+			metaJSON, _ := json.Marshal(gin.H{"results": changes})
+			_ = db.Create(&models.AuditLog{
+				OrgID:         cred.OrgID,
+				Action:        "agent.host_users",
+				ResourceType:  "resource",
+				ResourceID:    cred.ResourceID,
+				Metadata:      datatypes.JSON(metaJSON),
+				IP:            c.ClientIP(),
+				UserAgent:     c.GetHeader("User-Agent"),
+				InitiatorName: "agent",
+				CreatedAt:     time.Now(),
+			}).Error
+			log.Printf("👤 Host accounts reconciled on resource %d: %d changed", cred.ResourceID, len(changes))
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// GetResourceLogins returns the accounts a resource should have and the
+// last reconciliation report from its agent.
+func GetResourceLogins(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		logins, err := hostLogins(db, res)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var report interface{}
+		if len(res.Provisioning) > 0 {
+			report = res.Provisioning
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"resource_id": res.ID,
+			"desired":     logins,
+			"report":      report,
+		})
+	}
+}
+
+func splitTrim(s, sep string) []string {
+	var out []string
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, have := range list {
+			if have == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
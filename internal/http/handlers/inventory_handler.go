@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/inventory"
+	"teleport_lite/internal/models"
+)
+
+// inventoryHistory is how many snapshots are kept per resource, about two
+// hours at one heartbeat a minute.
+const inventoryHistory = 120
+
+// storeInventory saves snap as the resource's latest inventory, adds it
+// to the history and drops the oldest entries beyond inventoryHistory.
+func storeInventory(db *gorm.DB, resourceID int64, snap inventory.Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Resource{}).Where("id = ?", resourceID).
+			Update("inventory", datatypes.JSON(data)).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.ResourceInventory{ResourceID: resourceID, Snapshot: datatypes.JSON(data)}).Error; err != nil {
+			return err
+		}
+		var oldest models.ResourceInventory
+		err := tx.Where("resource_id = ?", resourceID).Order("id DESC").
+			Offset(inventoryHistory - 1).Limit(1).Find(&oldest).Error
+		if err != nil || oldest.ID == 0 {
+			return err
+		}
+		return tx.Where("resource_id = ? AND id < ?", resourceID, oldest.ID).
+			Delete(&models.ResourceInventory{}).Error
+	})
+}
+
+// GetResourceInventory returns a resource's latest inventory snapshot and
+// its history, newest first. ?limit=N caps the history (default all kept).
+func GetResourceInventory(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(inventoryHistory)))
+		if limit <= 0 || limit > inventoryHistory {
+			limit = inventoryHistory
+		}
+
+		var history []models.ResourceInventory
+		if err := db.Where("resource_id = ?", res.ID).Order("id DESC").Limit(limit).Find(&history).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var latest interface{}
+		if len(res.Inventory) > 0 {
+			latest = res.Inventory
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"resource_id": res.ID,
+			"latest":      latest,
+			"history":     history,
+		})
+	}
+}
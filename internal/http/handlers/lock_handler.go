@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/locks"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/session"
+)
+
+// ListLocks returns the active locks of the caller's organization.
+// Pass ?all=1 to include expired locks.
+func ListLocks(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		query := db.Where("org_id = ?", cl.OrgID).Order("id DESC")
+		if c.Query("all") == "" {
+			query = query.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+		}
+		var list []models.Lock
+		if err := query.Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"locks": list})
+	}
+}
+
+// CreateLock locks a user, role, resource or login and immediately
+// terminates every live session the lock matches.
+// Expects JSON: { "target_kind": "user", "target_value": "5", "message": "...", "ttl_minutes": 60 }
+func CreateLock(db *gorm.DB, reg *session.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var req struct {
+			TargetKind  string `json:"target_kind" binding:"required,oneof=user role resource login"`
+			TargetValue string `json:"target_value" binding:"required"`
+			Message     string `json:"message"`
+			TTLMinutes  int    `json:"ttl_minutes"` // optional, 0 = until removed
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		req.TargetValue = strings.TrimSpace(req.TargetValue)
+
+		// Make sure id targets exist in this organization
+		if req.TargetKind != models.LockTargetLogin {
+			id, err := strconv.ParseInt(req.TargetValue, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "target_value must be an id for " + req.TargetKind + " locks"})
+				return
+			}
+			var target interface{}
+			switch req.TargetKind {
+			case models.LockTargetUser:
+				target = &models.User{}
+			case models.LockTargetRole:
+				target = &models.Role{}
+			case models.LockTargetResource:
+				target = &models.Resource{}
+			}
+			if err := db.Where("id = ? AND org_id = ?", id, cl.OrgID).First(target).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": req.TargetKind + " not found"})
+				return
+			}
+		}
+
+		lock := models.Lock{
+			OrgID:       int64(cl.OrgID),
+			TargetKind:  req.TargetKind,
+			TargetValue: req.TargetValue,
+			Message:     req.Message,
+			CreatedBy:   int64(cl.UserID),
+		}
+		if req.TTLMinutes > 0 {
+			t := time.Now().Add(time.Duration(req.TTLMinutes) * time.Minute)
+			lock.ExpiresAt = &t
+		}
+		if err := db.Create(&lock).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		reason := "locked"
+		if lock.Message != "" {
+			reason = "locked: " + lock.Message
+		}
+		terminated := reg.TerminateMatching(func(s *session.Session) bool {
+			return locks.Matches(lock, s)
+		}, reason)
+
+		recordAudit(db, c, "lock.create", "lock", lock.ID, map[string]interface{}{
+			"target_kind":  lock.TargetKind,
+			"target_value": lock.TargetValue,
+			"message":      lock.Message,
+			"expires_at":   lock.ExpiresAt,
+			"terminated":   terminated,
+		})
+
+		c.JSON(http.StatusCreated, gin.H{"lock": lock, "terminated_sessions": terminated})
+	}
+}
+
+// DeleteLock removes a lock.
+func DeleteLock(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var lock models.Lock
+		if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&lock).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "lock not found"})
+			return
+		}
+		if err := db.Delete(&lock).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "lock.delete", "lock", lock.ID, map[string]interface{}{
+			"target_kind":  lock.TargetKind,
+			"target_value": lock.TargetValue,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "lock removed"})
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/connect"
+	"teleport_lite/internal/locks"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+	"teleport_lite/internal/session"
+)
+
+// PortForwardWS forwards a TCP connection to dest_host:dest_port as seen
+// from a resource, through an SSH direct-tcpip channel. The WebSocket
+// carries the raw stream in binary frames both ways. The caller must be
+// allowed to use login on the resource and one of their roles must allow
+// the destination (RolePolicy.AllowedForwards).
+// Query: resource_id, login, dest_host (default localhost), dest_port, port (SSH, default 22).
+func PortForwardWS(gdb *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		login := c.Query("login")
+		destHost := c.DefaultQuery("dest_host", "localhost")
+		destPort, err := strconv.Atoi(c.Query("dest_port"))
+		if login == "" || err != nil || destPort <= 0 || destPort > 65535 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "login and a valid dest_port are required"})
+			return
+		}
+
+		var res models.Resource
+		if err := gdb.Where("id = ? AND org_id = ?", c.Query("resource_id"), cl.OrgID).First(&res).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+			return
+		}
+
+		var user models.User
+		if err := gdb.First(&user, cl.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+		ev, err := rbac.NewEvaluator(gdb, cl.OrgID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		access, err := connect.Authorize(ev, user, res, login)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "login " + login + " not allowed on this resource"})
+			return
+		}
+		roleIDs, err := locks.RoleIDs(gdb, user.OrgID, user.ID)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "session refused: lock check failed"})
+			return
+		}
+		if msg := locks.Refusal(gdb, user.OrgID, user.ID, roleIDs, res.ID, login); msg != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": msg})
+			return
+		}
+		pol, err := session.LoadPolicy(gdb, roleIDs, res)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !pol.AllowsForward(destHost, destPort) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "forwarding to " + net.JoinHostPort(destHost, strconv.Itoa(destPort)) + " is not allowed for your roles"})
+			return
+		}
+
+		client, err := connect.Dial(access, c.DefaultQuery("port", "22"))
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "ssh dial error: " + err.Error()})
+			return
+		}
+		defer client.Close()
+
+		dest := net.JoinHostPort(destHost, strconv.Itoa(destPort))
+		remote, err := client.Dial("tcp", dest)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "forward to " + dest + " failed: " + err.Error()})
+			return
+		}
+		defer remote.Close()
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		meta := map[string]interface{}{
+			"host":        res.Host,
+			"login":       login,
+			"destination": dest,
+		}
+		recordAudit(gdb, c, "port_forward.start", "resource", res.ID, meta)
+		start := time.Now()
+
+		sent, received := pipeWebsocket(conn, remote)
+
+		meta["bytes_sent"] = sent
+		meta["bytes_received"] = received
+		meta["duration_ms"] = time.Since(start).Milliseconds()
+		recordAudit(gdb, c, "port_forward.end", "resource", res.ID, meta)
+	}
+}
+
+// pipeWebsocket copies binary frames from ws to remote and remote data
+// back as binary frames until either side closes. It returns the bytes
+// sent to and received from remote.
+func pipeWebsocket(ws *websocket.Conn, remote net.Conn) (sent, received int64) {
+	var in, out atomic.Int64
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			_ = remote.Close()
+			_ = ws.Close()
+		})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer stop()
+		for {
+			mt, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if mt != websocket.BinaryMessage {
+				continue
+			}
+			n, err := remote.Write(data)
+			in.Add(int64(n))
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer stop()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := remote.Read(buf)
+			if n > 0 {
+				if werr := ws.WriteMessage(websocket.BinaryMessage, buf[:n]); werr != nil {
+					return
+				}
+				out.Add(int64(n))
+			}
+			if err != nil {
+				if err != io.EOF {
+					return
+				}
+				_ = ws.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	return in.Load(), out.Load()
+}
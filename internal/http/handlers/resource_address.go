@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+)
+
+// updateAddress moves a resource to the IP its agent reports.
+func updateAddress(db *gorm.DB, resourceID int64, ip string) error {
+	var res models.Resource
+	if err := db.First(&res, resourceID).Error; err != nil {
+		return err
+	}
+	oldHost := res.Host
+	if oldHost != ip {
+		if err := db.Model(&res).Update("host", ip).Error; err != nil {
+			return err
+		}
+		res.Host = ip
+	}
+	noteAddress(db, res, oldHost)
+	return nil
+}
+
+// noteAddress records res.Host in the resource's address history and
+// audits a change from oldHost.
+func noteAddress(db *gorm.DB, res models.Resource, oldHost string) {
+	now := time.Now()
+	q := db.Model(&models.ResourceAddress{}).
+		Where("resource_id = ? AND ip = ?", res.ID, res.Host).
+		Update("last_seen", now)
+	if q.Error == nil && q.RowsAffected == 0 {
+		_ = db.Create(&models.ResourceAddress{ResourceID: res.ID, IP: res.Host, FirstSeen: now, LastSeen: now}).Error
+	}
+	if oldHost == "" || oldHost == res.Host {
+		return
+	}
+
+	metaJSON, _ := json.Marshal(map[string]interface{}{
+		"name": res.Name,
+		"from": oldHost,
+		"to":   res.Host,
+	})
+	_ = db.Create(&models.AuditLog{
+		OrgID:         res.OrgID,
+		Action:        "resource.ip_change",
+		ResourceType:  "resource",
+		ResourceID:    res.ID,
+		Metadata:      datatypes.JSON(metaJSON),
+		InitiatorName: "agent",
+		CreatedAt:     now,
+	}).Error
+	log.Printf("🔀 Resource %s (%d) moved from %s to %s", res.Name, res.ID, oldHost, res.Host)
+}
+
+// ListResourceAddresses returns the IPs a resource has been seen at,
+// most recent first.
+func ListResourceAddresses(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		var addrs []models.ResourceAddress
+		if err := db.Where("resource_id = ?", res.ID).Order("last_seen DESC").Find(&addrs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"addresses": addrs})
+	}
+}
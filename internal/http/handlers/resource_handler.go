@@ -6,7 +6,7 @@ import (
 
 	//"os"
 	//"os/user"
-	//"strings"
+	"strings"
 	"time"
 
 	"teleport_lite/internal/auth"
@@ -15,12 +15,19 @@ import (
 	"github.com/gin-gonic/gin"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
+
+	"teleport_lite/internal/connect"
 )
 
 func ListResources(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var resource []models.Resource
-		if err := db.Find(&resource).Error; err != nil {
+		q := db
+		// Optional ?status=online,degraded filter on the health state
+		if status := c.Query("status"); status != "" {
+			q = q.Where("status IN ?", strings.Split(status, ","))
+		}
+		if err := q.Find(&resource).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -97,3 +104,48 @@ func UpdateResourceUsers(db *gorm.DB) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{"message": "ssh users updated"})
 	}
 }
+
+// removeResource deletes a resource with its agent credentials, inventory,
+// address history and access assignments, and closes its tunnel. Sessions
+// and audit entries are kept.
+func removeResource(db *gorm.DB, tunnels *connect.Tunnels, res models.Resource) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, m := range []interface{}{
+			&models.AgentCredential{},
+			&models.ResourceInventory{},
+			&models.ResourceAddress{},
+			&models.UserResourceAccess{},
+			&models.AccessRule{},
+		} {
+			if err := tx.Where("resource_id = ?", res.ID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&res).Error
+	})
+	if err != nil {
+		return err
+	}
+	tunnels.Disconnect(res.ID)
+	return nil
+}
+
+// DeleteResource removes a resource, e.g. a decommissioned host whose
+// agent can no longer deregister itself.
+func DeleteResource(db *gorm.DB, tunnels *connect.Tunnels) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, ok := orgResource(db, c)
+		if !ok {
+			return
+		}
+		if err := removeResource(db, tunnels, res); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		recordAudit(db, c, "resource.delete", "resource", res.ID, map[string]interface{}{
+			"name": res.Name,
+			"host": res.Host,
+		})
+		c.JSON(http.StatusOK, gin.H{"message": "resource deleted"})
+	}
+}
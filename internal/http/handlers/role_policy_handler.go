@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/provision"
+)
+
+// GetRolePolicy returns the session policy of a role. Roles without a
+// stored policy get the defaults.
+func GetRolePolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var role models.Role
+		if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&role).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+			return
+		}
+
+		policy := models.RolePolicy{RoleID: role.ID, OrgID: role.OrgID, OnModeratorLeave: models.ModeratorLeavePause}
+		err := db.First(&policy, "role_id = ?", role.ID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"policy": policy})
+	}
+}
+
+// UpdateRolePolicy creates or replaces the session policy of a role.
+// Expects JSON: { "required_moderators": 1, "moderator_role_id": 3,
+// "moderated_labels": "env=prod", "on_moderator_leave": "pause",
+// "idle_timeout_minutes": 15, "max_session_ttl_minutes": 480,
+// "allowed_forwards": "localhost:5432,10.0.*:80", "host_groups": "docker",
+// "host_shell": "/bin/bash", "host_sudoers": "ALL=(ALL) NOPASSWD: ALL" }
+func UpdateRolePolicy(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var role models.Role
+		if err := db.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&role).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "role not found"})
+			return
+		}
+
+		var req struct {
+			RequiredModerators   int    `json:"required_moderators" binding:"min=0"`
+			ModeratorRoleID      int64  `json:"moderator_role_id"`
+			ModeratedLabels      string `json:"moderated_labels"`
+			OnModeratorLeave     string `json:"on_moderator_leave" binding:"omitempty,oneof=pause terminate"`
+			IdleTimeoutMinutes   int    `json:"idle_timeout_minutes" binding:"min=0"`
+			MaxSessionTTLMinutes int    `json:"max_session_ttl_minutes" binding:"min=0"`
+			AllowedForwards      string `json:"allowed_forwards"`
+			HostGroups           string `json:"host_groups"`
+			HostShell            string `json:"host_shell"`
+			HostSudoers          string `json:"host_sudoers"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.OnModeratorLeave == "" {
+			req.OnModeratorLeave = models.ModeratorLeavePause
+		}
+		for _, dest := range strings.Split(req.AllowedForwards, ",") {
+			if dest = strings.TrimSpace(dest); dest == "" {
+				continue
+			}
+			if _, _, err := net.SplitHostPort(dest); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "allowed_forwards entries must be host:port, got " + dest})
+				return
+			}
+		}
+		for _, g := range strings.Split(req.HostGroups, ",") {
+			if g = strings.TrimSpace(g); g != "" && !provision.ValidName(g) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid host group " + g})
+				return
+			}
+		}
+		if req.HostShell != "" && !strings.HasPrefix(req.HostShell, "/") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "host_shell must be an absolute path"})
+			return
+		}
+		if req.RequiredModerators > 0 {
+			var modRole models.Role
+			if err := db.Where("id = ? AND org_id = ?", req.ModeratorRoleID, cl.OrgID).First(&modRole).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "moderator_role_id must be a role of this organization"})
+				return
+			}
+		}
+
+		// Load the existing row so saving keeps its created_at
+		var policy models.RolePolicy
+		err := db.Where("role_id = ?", role.ID).First(&policy).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			policy = models.RolePolicy{RoleID: role.ID}
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		policy.OrgID = role.OrgID
+		policy.RequiredModerators = req.RequiredModerators
+		policy.ModeratorRoleID = req.ModeratorRoleID
+		policy.ModeratedLabels = req.ModeratedLabels
+		policy.OnModeratorLeave = req.OnModeratorLeave
+		policy.IdleTimeoutMinutes = req.IdleTimeoutMinutes
+		policy.MaxSessionTTLMinutes = req.MaxSessionTTLMinutes
+		policy.AllowedForwards = req.AllowedForwards
+		policy.HostGroups = req.HostGroups
+		policy.HostShell = req.HostShell
+		policy.HostSudoers = req.HostSudoers
+		if err := db.Save(&policy).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		recordAudit(db, c, "role.policy_update", "role", role.ID, policy)
+		c.JSON(http.StatusOK, gin.H{"policy": policy})
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/session"
+)
+
+// ListActiveSessions returns the SSH sessions currently running in the
+// caller's organization, including live byte counters.
+func ListActiveSessions(reg *session.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		out := []session.Info{}
+		for _, s := range reg.List() {
+			if s.OrgID == int64(cl.OrgID) {
+				out = append(out, s.Info())
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"sessions": out})
+	}
+}
+
+// ListSessions returns recorded sessions, newest first. Optional query:
+// status (active|ended), user_id, resource_id, limit (max 200).
+func ListSessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		limit := 50
+		if parsed, err := strconv.Atoi(c.Query("limit")); err == nil && parsed > 0 && parsed <= 200 {
+			limit = parsed
+		}
+
+		query := db.Where("org_id = ?", cl.OrgID).Order("started_at DESC").Limit(limit)
+		if v := c.Query("status"); v != "" {
+			query = query.Where("status = ?", v)
+		}
+		if v := c.Query("user_id"); v != "" {
+			query = query.Where("user_id = ?", v)
+		}
+		if v := c.Query("resource_id"); v != "" {
+			query = query.Where("resource_id = ?", v)
+		}
+
+		var rows []models.Session
+		if err := query.Find(&rows).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sessions": rows})
+	}
+}
+
+// TerminateSession forcibly closes a live session's SSH connection and
+// WebSocket.
+func TerminateSession(db *gorm.DB, reg *session.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		s, ok := reg.Get(c.Param("id"))
+		if !ok || s.OrgID != int64(cl.OrgID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found or already ended"})
+			return
+		}
+
+		var admin models.User
+		reason := "terminated by administrator"
+		if err := db.First(&admin, cl.UserID).Error; err == nil {
+			reason = "terminated by " + admin.Email
+		}
+		s.Terminate(reason)
+
+		recordAudit(db, c, "session.terminate", "session", s.ResourceID, map[string]interface{}{
+			"session_id": s.ID,
+			"user_id":    s.UserID,
+			"user_email": s.UserEmail,
+			"login":      s.Login,
+			"host":       s.Host,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "session terminated"})
+	}
+}
+
+// ListSessionAudit returns the audit trail of a session: connect,
+// disconnect, join, leave and terminate entries carrying its session_id.
+func ListSessionAudit(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var logs []models.AuditLog
+		if err := db.Where("org_id = ?", cl.OrgID).
+			Where("JSON_UNQUOTE(JSON_EXTRACT(metadata, '$.session_id')) = ?", c.Param("id")).
+			Order("id").
+			Find(&logs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"logs": logs})
+	}
+}
+
+// ModeratorTerminateSession lets a moderator attached to a live session
+// end it. Unlike TerminateSession it needs no sessions:write permission.
+func ModeratorTerminateSession(db *gorm.DB, reg *session.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		s, ok := reg.Get(c.Param("id"))
+		if !ok || s.OrgID != int64(cl.OrgID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found or already ended"})
+			return
+		}
+		if !s.IsModerator(int64(cl.UserID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only attached moderators can terminate this session"})
+			return
+		}
+
+		reason := "terminated by moderator"
+		var mod models.User
+		if err := db.First(&mod, cl.UserID).Error; err == nil {
+			reason = "terminated by moderator " + mod.Email
+		}
+		s.Terminate(reason)
+
+		recordAudit(db, c, "session.moderator_terminate", "session", s.ResourceID, map[string]interface{}{
+			"session_id": s.ID,
+			"user_id":    s.UserID,
+			"user_email": s.UserEmail,
+			"login":      s.Login,
+			"host":       s.Host,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "session terminated"})
+	}
+}
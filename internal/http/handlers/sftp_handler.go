@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/connect"
+	"teleport_lite/internal/locks"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+)
+
+// sftpTarget resolves the resource and login of an SFTP request and opens
+// an SFTP client with the same login and lock checks as SSHWS. It writes
+// the error response itself and returns ok=false on failure.
+// Query: login (required), port (default 22).
+func sftpTarget(gdb *gorm.DB, c *gin.Context) (res models.Resource, login string, client *sftp.Client, conn *ssh.Client, ok bool) {
+	cl := c.MustGet("claims").(*auth.Claims)
+	login = c.Query("login")
+	if login == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login is required"})
+		return
+	}
+
+	if err := gdb.Where("id = ? AND org_id = ?", c.Param("id"), cl.OrgID).First(&res).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "resource not found"})
+		return
+	}
+
+	var user models.User
+	if err := gdb.First(&user, cl.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+	ev, err := rbac.NewEvaluator(gdb, cl.OrgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	access, err := connect.Authorize(ev, user, res, login)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "login " + login + " not allowed on this resource"})
+		return
+	}
+
+	roleIDs, err := locks.RoleIDs(gdb, int64(cl.OrgID), int64(cl.UserID))
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "session refused: lock check failed"})
+		return
+	}
+	if msg := locks.Refusal(gdb, int64(cl.OrgID), int64(cl.UserID), roleIDs, res.ID, login); msg != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": msg})
+		return
+	}
+
+	conn, err = connect.Dial(access, c.DefaultQuery("port", "22"))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "ssh dial error: " + err.Error()})
+		return
+	}
+	client, err = sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		c.JSON(http.StatusBadGateway, gin.H{"error": "sftp error: " + err.Error()})
+		return
+	}
+	return res, login, client, conn, true
+}
+
+// ListFiles lists a directory on a resource over SFTP.
+// Query: path (default "."), login, port.
+func ListFiles(gdb *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, _, client, conn, ok := sftpTarget(gdb, c)
+		if !ok {
+			return
+		}
+		defer conn.Close()
+		defer client.Close()
+
+		dir := c.DefaultQuery("path", ".")
+		infos, err := client.ReadDir(dir)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if abs, err := client.RealPath(dir); err == nil {
+			dir = abs
+		}
+
+		type entry struct {
+			Name    string    `json:"name"`
+			Path    string    `json:"path"`
+			Size    int64     `json:"size"`
+			Mode    string    `json:"mode"`
+			IsDir   bool      `json:"is_dir"`
+			ModTime time.Time `json:"mod_time"`
+		}
+		out := make([]entry, 0, len(infos))
+		for _, fi := range infos {
+			out = append(out, entry{
+				Name:    fi.Name(),
+				Path:    path.Join(dir, fi.Name()),
+				Size:    fi.Size(),
+				Mode:    fi.Mode().String(),
+				IsDir:   fi.IsDir(),
+				ModTime: fi.ModTime(),
+			})
+		}
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].IsDir != out[j].IsDir {
+				return out[i].IsDir
+			}
+			return out[i].Name < out[j].Name
+		})
+		c.JSON(http.StatusOK, gin.H{"path": dir, "entries": out})
+	}
+}
+
+// DownloadFile streams a file from a resource to the client. Files larger
+// than maxBytes are refused.
+// Query: path, login, port.
+func DownloadFile(gdb *gorm.DB, maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		res, login, client, conn, ok := sftpTarget(gdb, c)
+		if !ok {
+			return
+		}
+		defer conn.Close()
+		defer client.Close()
+
+		p := c.Query("path")
+		f, err := client.Open(p)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "not a regular file"})
+			return
+		}
+		if fi.Size() > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file exceeds the transfer limit of " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+			return
+		}
+
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", `attachment; filename="`+path.Base(p)+`"`)
+		c.Header("Content-Length", strconv.FormatInt(fi.Size(), 10))
+		c.Status(http.StatusOK)
+
+		sum := sha256.New()
+		n, err := io.Copy(io.MultiWriter(c.Writer, sum), io.LimitReader(f, maxBytes))
+
+		recordAudit(gdb, c, "sftp.download", "resource", res.ID, transferMeta(res, login, p, n, sum, err))
+	}
+}
+
+// UploadFile streams a multipart "file" field to a resource without
+// buffering it. Uploads larger than maxBytes are aborted and the partial
+// file is removed.
+// Query: path (target directory, or full file path ending in the file
+// name when the form has no file name), login, port.
+func UploadFile(gdb *gorm.DB, maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file exceeds the transfer limit of " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+			return
+		}
+		mr, err := c.Request.MultipartReader()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "multipart form with a file field required"})
+			return
+		}
+
+		res, login, client, conn, ok := sftpTarget(gdb, c)
+		if !ok {
+			return
+		}
+		defer conn.Close()
+		defer client.Close()
+
+		part, err := mr.NextPart()
+		for err == nil && part.FormName() != "file" {
+			part, err = mr.NextPart()
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing file field"})
+			return
+		}
+		defer part.Close()
+
+		target := c.DefaultQuery("path", ".")
+		if name := path.Base(part.FileName()); part.FileName() != "" && name != "." && name != "/" {
+			target = path.Join(target, name)
+		}
+
+		f, err := client.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		sum := sha256.New()
+		n, err := io.Copy(io.MultiWriter(f, sum), io.LimitReader(part, maxBytes+1))
+		_ = f.Close()
+		if err == nil && n > maxBytes {
+			err = errors.New("file exceeds the transfer limit")
+		}
+		if err != nil {
+			_ = client.Remove(target)
+		}
+
+		recordAudit(gdb, c, "sftp.upload", "resource", res.ID, transferMeta(res, login, target, n, sum, err))
+
+		switch {
+		case err != nil && n > maxBytes:
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file exceeds the transfer limit of " + strconv.FormatInt(maxBytes, 10) + " bytes"})
+		case err != nil:
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusCreated, gin.H{"path": target, "size": n, "sha256": hex.EncodeToString(sum.Sum(nil))})
+		}
+	}
+}
+
+// transferMeta is the audit metadata of one file transfer.
+func transferMeta(res models.Resource, login, p string, n int64, sum interface{ Sum([]byte) []byte }, err error) map[string]interface{} {
+	meta := map[string]interface{}{
+		"host":   res.Host,
+		"login":  login,
+		"path":   p,
+		"size":   n,
+		"sha256": hex.EncodeToString(sum.Sum(nil)),
+		"status": "ok",
+	}
+	if err != nil {
+		meta["status"] = "failed"
+		meta["error"] = err.Error()
+	}
+	return meta
+}
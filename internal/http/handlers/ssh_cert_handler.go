@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/sshca"
+)
+
+// IssueSSHCert signs the caller's SSH public key with the organization's
+// user CA. The short-lived certificate authenticates them to the SSH proxy.
+// Expects JSON: { "public_key": "ssh-ed25519 AAAA...", "ttl_minutes": 480 }
+func IssueSSHCert(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		var req struct {
+			PublicKey  string `json:"public_key" binding:"required"`
+			TTLMinutes int    `json:"ttl_minutes"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid public_key: " + err.Error()})
+			return
+		}
+		if _, isCert := pub.(*ssh.Certificate); isCert {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "public_key must be a plain key, not a certificate"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, cl.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+
+		cert, err := sshca.SignUserCert(db, user, pub, time.Duration(req.TTLMinutes)*time.Minute)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		validBefore := time.Unix(int64(cert.ValidBefore), 0)
+
+		recordAudit(db, c, "ssh_cert.issue", "user", user.ID, map[string]interface{}{
+			"serial":       cert.Serial,
+			"fingerprint":  ssh.FingerprintSHA256(pub),
+			"valid_before": validBefore,
+		})
+		c.JSON(http.StatusCreated, gin.H{
+			"certificate":  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert))),
+			"valid_before": validBefore,
+		})
+	}
+}
+
+// SSHProxyInfo returns what an OpenSSH client needs to trust the SSH
+// proxy: its address and host key in known_hosts form.
+func SSHProxyInfo(db *gorm.DB, addr string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if addr == "" || addr == "off" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "ssh proxy is disabled"})
+			return
+		}
+		hostKey, err := sshca.ProxyHostKey(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"addr":     addr,
+			"host_key": strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey.PublicKey()))),
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/locks"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/session"
+)
+
+// SSHJoinWS attaches the caller to a live SSH session. Observers receive
+// the terminal output only; peers may also type. Moderators watch like
+// observers and count towards the session's moderation policy; they must
+// hold one of the required moderator roles. Joins and leaves are written to
+// the audit log with the session id.
+// Query: session_id, mode (observer|peer|moderator, default observer),
+// proto (framed, default raw; see ws_protocol.go).
+func SSHJoinWS(gdb *gorm.DB, reg *session.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		mode := c.DefaultQuery("mode", session.ModeObserver)
+		if mode != session.ModeObserver && mode != session.ModePeer && mode != session.ModeModerator {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be observer, peer or moderator"})
+			return
+		}
+
+		sess, ok := reg.Get(c.Query("session_id"))
+		if !ok || sess.OrgID != int64(cl.OrgID) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found or already ended"})
+			return
+		}
+
+		var user models.User
+		if err := gdb.First(&user, cl.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+
+		// Locks on the target resource or login also keep joiners out
+		roleIDs, err := locks.RoleIDs(gdb, user.OrgID, user.ID)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "session refused: lock check failed"})
+			return
+		}
+		if locks.Refusal(gdb, user.OrgID, user.ID, roleIDs, sess.ResourceID, sess.Login) != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "session is locked"})
+			return
+		}
+
+		if mode == session.ModeModerator {
+			if !sess.Moderated() || !sess.CanModerate(roleIDs) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "not a moderator for this session"})
+				return
+			}
+			if user.ID == sess.UserID {
+				c.JSON(http.StatusForbidden, gin.H{"error": "session owner cannot moderate their own session"})
+				return
+			}
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		meta := map[string]interface{}{
+			"session_id":  sess.ID,
+			"mode":        mode,
+			"host":        sess.Host,
+			"ssh_user":    sess.Login,
+			"owner_email": sess.UserEmail,
+		}
+
+		out := newWebsocketWriter(conn)
+		if c.Query("proto") == protoFramed {
+			out.proto = protoFramed
+		}
+		party := session.NewParty(user.ID, user.Email, mode, out)
+		party.RoleIDs = roleIDs
+		sess.Notify(user.Email + " joined as " + mode)
+		sess.AddParty(party)
+		_ = party.Notify("joined " + sess.Login + "@" + sess.Host + " as " + mode)
+		recordAudit(gdb, c, "session.join", "SSH", sess.ResourceID, meta)
+
+		pumpInput(conn, out, sess, party)
+
+		sess.RemoveParty(party.ID)
+		sess.Notify(user.Email + " left")
+		recordAudit(gdb, c, "session.leave", "SSH", sess.ResourceID, meta)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/locks"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/session"
+)
+
+// SSHResumeWS reattaches the owner of a live session after their
+// WebSocket dropped. The resume token from the "session" control message
+// only works for the user who started the session, and the output the
+// client missed is replayed from the session's buffer. Always framed.
+// Query: session_id, token, offset (output bytes already received).
+func SSHResumeWS(gdb *gorm.DB, reg *session.Registry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cl := c.MustGet("claims").(*auth.Claims)
+
+		sess, ok := reg.Get(c.Query("session_id"))
+		if !ok || sess.OrgID != int64(cl.OrgID) || !sess.Resumable() {
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found or already ended"})
+			return
+		}
+		offset, err := strconv.ParseInt(c.DefaultQuery("offset", "0"), 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a non-negative integer"})
+			return
+		}
+
+		var user models.User
+		if err := gdb.First(&user, cl.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+
+		// Locks created while the owner was away still apply
+		roleIDs, err := locks.RoleIDs(gdb, user.OrgID, user.ID)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "session refused: lock check failed"})
+			return
+		}
+		if locks.Refusal(gdb, user.OrgID, user.ID, roleIDs, sess.ResourceID, sess.Login) != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "session is locked"})
+			return
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		out := newWebsocketWriter(conn)
+		out.proto = protoFramed
+		owner := session.NewParty(user.ID, user.Email, session.ModeOwner, out)
+		owner.RoleIDs = roleIDs
+
+		if err := sess.Resume(user.ID, c.Query("token"), owner, offset); err != nil {
+			msg := "session can no longer be resumed"
+			if errors.Is(err, session.ErrResumeDenied) {
+				msg = "resume denied"
+				recordAudit(gdb, c, "session.resume_denied", "SSH", sess.ResourceID, map[string]interface{}{
+					"session_id": sess.ID,
+				})
+			}
+			_ = out.WriteControl(wsControlMsg{Op: "error", Message: msg})
+			_ = out.Close()
+			return
+		}
+
+		meta := map[string]interface{}{
+			"session_id": sess.ID,
+			"host":       sess.Host,
+			"ssh_user":   sess.Login,
+			"offset":     offset,
+		}
+		recordAudit(gdb, c, "session.resume", "SSH", sess.ResourceID, meta)
+
+		closed := pumpInput(conn, out, sess, owner)
+		ownerGone(sess, owner, closed)
+	}
+}
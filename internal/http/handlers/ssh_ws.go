@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,7 +15,11 @@ import (
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 	"teleport_lite/internal/auth"
+	"teleport_lite/internal/connect"
+	"teleport_lite/internal/locks"
 	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+	"teleport_lite/internal/session"
 )
 
 var upgrader = websocket.Upgrader{
@@ -26,13 +31,15 @@ var upgrader = websocket.Upgrader{
 }
 
 type wsAuthMsg struct {
-	Op   string `json:"op"`   // operation: "auth"
-	Cols int    `json:"cols"` // terminal width
-	Rows int    `json:"rows"` // terminal height
+	Op    string `json:"op"`    // operation: "auth"
+	Cols  int    `json:"cols"`  // terminal width
+	Rows  int    `json:"rows"`  // terminal height
+	Proto string `json:"proto"` // "framed" or "" for raw, see ws_protocol.go
 }
 
-// SSHWS establishes SSH session via WebSocket using private key from DB
-func SSHWS(gdb *gorm.DB) gin.HandlerFunc {
+// SSHWS establishes SSH session via WebSocket using private key from DB.
+// Live sessions are tracked in reg so they can be terminated by locks.
+func SSHWS(gdb *gorm.DB, reg *session.Registry) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		host := c.DefaultQuery("host", "127.0.0.1")
 		port := c.DefaultQuery("port", "22")
@@ -43,6 +50,7 @@ func SSHWS(gdb *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		defer conn.Close()
+		out := newWebsocketWriter(conn)
 
 		// ✅ Extract user agent from request
 		userAgent := c.Request.Header.Get("User-Agent")
@@ -99,95 +107,127 @@ func SSHWS(gdb *gorm.DB) gin.HandlerFunc {
 			return
 		}
 		conn.SetReadDeadline(time.Time{})
+		if auth.Proto != protoRaw && auth.Proto != protoFramed {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte("unsupported protocol "+auth.Proto+"\n"))
+			return
+		}
+		out.proto = auth.Proto
 
-		// ✅ Fetch resource from DB using the same method as local_agent.go
+		// ✅ Fetch resource from DB, by ID when given since hosts behind the
+		// same NAT share an IP
 		var resource models.Resource
-		if err := gdb.Where("host = ?", host).First(&resource).Error; err != nil {
+		q := gdb.Where("host = ? AND org_id = ?", host, orgID)
+		if id := c.Query("resource_id"); id != "" {
+			q = gdb.Where("id = ? AND org_id = ?", id, orgID)
+		}
+		if err := q.First(&resource).Error; err != nil {
 			_ = conn.WriteMessage(websocket.TextMessage, []byte("resource not found for host "+host+"\n"))
 			return
 		}
 
-		if resource.PrivateKey == "" {
-			_ = conn.WriteMessage(websocket.TextMessage,
-				[]byte("❌ No private key found in DB for host "+host+"\n"))
+		// ✅ Only logins the user's roles, access rules or resource grants
+		// allow, as reported by /access/explain, get a credential
+		ev, err := rbac.NewEvaluator(gdb, uint64(orgID))
+		if err != nil {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte("access check failed\n"))
 			return
 		}
-
-		// ✅ Parse private key from DB
-		signer, err := ssh.ParsePrivateKey([]byte(resource.PrivateKey))
+		access, err := connect.Authorize(ev, dbUser, resource, user)
 		if err != nil {
-			_ = conn.WriteMessage(websocket.TextMessage,
-				[]byte("❌ Invalid private key in DB: "+err.Error()+"\n"))
+			deniedJSON, _ := json.Marshal(map[string]string{"ssh_user": user, "host": resource.Host, "reason": "login not allowed"})
+			_ = gdb.Create(&models.AuditLog{
+				OrgID:         orgID,
+				UserID:        userID,
+				Action:        "ssh_denied",
+				ResourceType:  "resource",
+				ResourceID:    resource.ID,
+				IP:            clientIP,
+				UserAgent:     userAgent,
+				InitiatorName: webUserName,
+				Metadata:      datatypes.JSON(deniedJSON),
+				CreatedAt:     time.Now(),
+			}).Error
+			_ = conn.WriteMessage(websocket.TextMessage, []byte("login "+user+" not allowed on this resource\n"))
 			return
 		}
 
-		cfg := &ssh.ClientConfig{
-			User: user,
-			Auth: []ssh.AuthMethod{
-				ssh.PublicKeys(signer),
-			},
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Timeout:         10 * time.Second,
-		}
-
-		client, err := ssh.Dial("tcp", host+":"+port, cfg)
+		// ✅ Refuse locked users, roles, resources and logins before dialing
+		roleIDs, err := locks.RoleIDs(gdb, orgID, userID)
 		if err != nil {
-			_ = conn.WriteMessage(websocket.TextMessage,
-				[]byte("ssh dial error: "+err.Error()+"\n"))
+			_ = conn.WriteMessage(websocket.TextMessage, []byte("session refused: lock check failed\n"))
 			return
 		}
-		defer client.Close()
-
-		session, err := client.NewSession()
-		if err != nil {
-			_ = conn.WriteMessage(websocket.TextMessage,
-				[]byte("ssh session error: "+err.Error()+"\n"))
+		if msg := locks.Refusal(gdb, orgID, userID, roleIDs, resource.ID, user); msg != "" {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(msg+"\n"))
 			return
 		}
-		defer session.Close()
 
-		cols, rows := auth.Cols, auth.Rows
-		if cols == 0 {
-			cols = 120
-		}
-		if rows == 0 {
-			rows = 32
+		// ✅ Check the credential before starting the session
+		if _, err := connect.Signer(access); err != nil {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(err.Error()+"\n"))
+			return
 		}
 
-		if err := session.RequestPty("xterm-256color", rows, cols, ssh.TerminalModes{
-			ssh.ECHO:          1,
-			ssh.TTY_OP_ISPEED: 14400,
-			ssh.TTY_OP_OSPEED: 14400,
-		}); err != nil {
-			_ = conn.WriteMessage(websocket.TextMessage,
-				[]byte("pty error: "+err.Error()+"\n"))
+		// ✅ Track the live session so it can be listed, joined and terminated
+		sess := session.New(orgID, userID, roleIDs, resource.ID, user)
+		sess.UserEmail = webUserEmail
+		sess.ResourceName = resource.Name
+		sess.Host = host
+		sess.ClientIP = clientIP
+		owner := session.NewParty(userID, webUserEmail, session.ModeOwner, out)
+		owner.RoleIDs = roleIDs
+		sess.AddParty(owner)
+		reg.Add(sess)
+		defer reg.Remove(sess.ID)
+
+		pol, err := session.LoadPolicy(gdb, roleIDs, resource)
+		if err != nil {
+			sess.Terminate("policy error")
 			return
 		}
+		sess.SetPolicy(pol)
+		if pol.IdleTimeout > 0 || pol.MaxTTL > 0 {
+			meta["idle_timeout"] = pol.IdleTimeout.String()
+			meta["max_ttl"] = pol.MaxTTL.String()
+		}
 
-		stdin, _ := session.StdinPipe()
-		stdout, _ := session.StdoutPipe()
-		stderr, _ := session.StderrPipe()
-
-		if err := session.Start("/bin/bash -l"); err != nil {
-			_ = session.Start("/bin/sh")
+		// ✅ Framed clients may resume the session after a dropped connection
+		if out.proto == protoFramed {
+			_ = out.WriteControl(wsControlMsg{Op: "session", SessionID: sess.ID, ResumeToken: sess.EnableResume()})
 		}
 
-		// SSH → WebSocket
-		go io.Copy(websocketWriter{conn}, stdout)
-		go io.Copy(websocketWriter{conn}, stderr)
+		// WebSocket → SSH, started early so the owner leaving is noticed
+		// while waiting for moderators
+		go func() {
+			closed := pumpInput(conn, out, sess, owner)
+			ownerGone(sess, owner, closed)
+		}()
 
-		// WebSocket → SSH
-		for {
-			mt, data, err := conn.ReadMessage()
-			if err != nil {
-				break
-			}
-			if mt == websocket.TextMessage || mt == websocket.BinaryMessage {
-				_, _ = stdin.Write(data)
+		// ✅ Moderated sessions only start once the moderators have joined
+		if sess.Moderated() {
+			_ = owner.Notify("waiting for moderators: " + sess.ModeratorsWanted() + " (session " + sess.ID + ")")
+			select {
+			case <-sess.Ready():
+			case <-sess.Done():
+			case <-time.After(moderatorWait):
+				sess.Terminate("moderators did not join")
 			}
 		}
 
+		if sess.Reason() == "" {
+			startShell(sess, out, access, port, auth.Cols, auth.Rows)
+		}
+
+		// The session outlives this WebSocket if the owner resumes it from
+		// another connection
+		<-sess.Done()
+
 		// ✅ Record SSH disconnect when session ends
+		meta["session_id"] = sess.ID
+		meta["reason"] = sess.Reason()
+		meta["bytes_in"] = strconv.FormatInt(sess.BytesIn(), 10)
+		meta["bytes_out"] = strconv.FormatInt(sess.BytesOut(), 10)
+		metaJSON, _ = json.Marshal(meta)
 		disconnectLog := models.AuditLog{
 			OrgID:         orgID,
 			UserID:        userID,
@@ -200,15 +240,83 @@ func SSHWS(gdb *gorm.DB) gin.HandlerFunc {
 			CreatedAt:     time.Now(),
 		}
 		_ = gdb.Create(&disconnectLog).Error
+	}
+}
+
+// moderatorWait is how long a moderated session waits for its moderators.
+const moderatorWait = 15 * time.Minute
 
-		_ = session.Close()
+// resumeGrace is how long a session survives its owner's dropped
+// connection, waiting for a resume.
+const resumeGrace = 2 * time.Minute
+
+// ownerGone handles the owner's WebSocket going away. A deliberate close
+// ends the session for everyone; a dropped resumable connection leaves it
+// running for resumeGrace.
+func ownerGone(sess *session.Session, owner *session.Party, closed bool) {
+	if closed || !sess.Resumable() {
+		sess.Terminate("client_closed")
+		return
 	}
+	sess.Detach(owner.ID, resumeGrace)
 }
 
-type websocketWriter struct{ *websocket.Conn }
+// startShell dials the target, starts a login shell on a PTY and wires it
+// to sess. Errors are reported to the owner and terminate the session.
+func startShell(sess *session.Session, out *websocketWriter, access connect.Access, port string, cols, rows int) {
+	client, err := connect.Dial(access, port)
+	if err != nil {
+		_ = out.WriteError("ssh dial error: " + err.Error())
+		sess.Terminate("dial error")
+		return
+	}
+	sess.AddCloser(client)
+
+	sshSession, err := client.NewSession()
+	if err != nil {
+		_ = out.WriteError("ssh session error: " + err.Error())
+		sess.Terminate("session error")
+		return
+	}
+	sess.AddCloser(sshSession)
+
+	if cols == 0 {
+		cols = 120
+	}
+	if rows == 0 {
+		rows = 32
+	}
+
+	if err := sshSession.RequestPty("xterm-256color", rows, cols, ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}); err != nil {
+		_ = out.WriteError("pty error: " + err.Error())
+		sess.Terminate("pty error")
+		return
+	}
+
+	stdin, _ := sshSession.StdinPipe()
+	stdout, _ := sshSession.StdoutPipe()
+	stderr, _ := sshSession.StderrPipe()
+
+	if err := sshSession.Start("/bin/bash -l"); err != nil {
+		_ = sshSession.Start("/bin/sh")
+	}
+	sess.SetInput(stdin)
+	sess.SetTerminal(sshTerminal{sshSession})
 
-func (w websocketWriter) Write(p []byte) (int, error) {
-	return len(p), w.Conn.WriteMessage(websocket.BinaryMessage, p)
+	// SSH → every attached WebSocket, then the exit status once all
+	// output has been delivered
+	var copies sync.WaitGroup
+	copies.Add(2)
+	go func() { defer copies.Done(); io.Copy(sess.Output(), stdout) }()
+	go func() { defer copies.Done(); io.Copy(sess.Output(), stderr) }()
+	go func() {
+		copies.Wait()
+		waitExit(sess, sshSession)
+	}()
 }
 
 func atoi(s string, def int) int {
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"teleport_lite/internal/auth"
 	"teleport_lite/internal/models"
+	"teleport_lite/internal/session"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -27,8 +28,9 @@ func ListUsers(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-// DeactivateUser sets a user's status to suspended. Requires appropriate permission at the route level.
-func DeactivateUser(db *gorm.DB) gin.HandlerFunc {
+// DeactivateUser sets a user's status to suspended and terminates their
+// live SSH sessions. Requires appropriate permission at the route level.
+func DeactivateUser(db *gorm.DB, reg *session.Registry) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		id := c.Param("id")
 
@@ -44,6 +46,10 @@ func DeactivateUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		reg.TerminateMatching(func(s *session.Session) bool {
+			return s.UserID == user.ID
+		}, "account suspended")
+
 		c.JSON(http.StatusOK, gin.H{"message": "user deactivated"})
 	}
 }
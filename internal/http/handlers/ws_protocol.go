@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
+
+	"teleport_lite/internal/session"
+)
+
+// Terminal WebSocket protocols.
+//
+// Raw (the default, kept for older clients): every frame the client sends
+// is written to stdin, and the server sends terminal output as binary
+// frames and status lines as text frames.
+//
+// Framed (auth message "proto":"framed", or ?proto=framed when joining):
+// binary frames carry terminal data in both directions and text frames
+// carry JSON control messages. Binary frames from the server are exactly
+// the remote output, so a client can count them to resume after a
+// dropped connection (see SSHResumeWS). A normal close frame means the
+// session ended; any other close may be resumed.
+//
+//	client → server: {"op":"resize","cols":120,"rows":32}
+//	                 {"op":"signal","signal":"INT"}
+//	                 {"op":"ping"}
+//	                 {"op":"close"}
+//	server → client: {"op":"session","session_id":"...","resume_token":"..."}
+//	                 {"op":"notice","message":"..."}
+//	                 {"op":"pong"}
+//	                 {"op":"exit","status":0,"signal":""}
+//	                 {"op":"error","message":"..."}
+const (
+	protoRaw    = ""
+	protoFramed = "framed"
+)
+
+type wsControlMsg struct {
+	Op      string `json:"op"`
+	Cols    int    `json:"cols,omitempty"`
+	Rows    int    `json:"rows,omitempty"`
+	Signal  string `json:"signal,omitempty"`
+	Status  *int   `json:"status,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	SessionID   string `json:"session_id,omitempty"`
+	ResumeToken string `json:"resume_token,omitempty"`
+}
+
+// allowedSignals are the signals a client may send to the remote process.
+var allowedSignals = map[string]bool{
+	"INT": true, "TERM": true, "KILL": true, "HUP": true, "QUIT": true,
+	"USR1": true, "USR2": true, "ALRM": true, "PIPE": true, "ABRT": true,
+}
+
+// pumpInput forwards frames read from conn to the session until the
+// WebSocket closes or a framed client sends "close". Input from observers
+// is dropped. It reports whether the client closed on purpose, either
+// with a "close" message or a normal close frame.
+func pumpInput(conn *websocket.Conn, out *websocketWriter, sess *session.Session, party *session.Party) (closed bool) {
+	for {
+		mt, data, err := conn.ReadMessage()
+		if err != nil {
+			return websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway)
+		}
+		if mt != websocket.TextMessage && mt != websocket.BinaryMessage {
+			continue
+		}
+		if out.proto != protoFramed || mt == websocket.BinaryMessage {
+			_ = sess.WriteInput(party, data)
+			continue
+		}
+
+		var msg wsControlMsg
+		if err := json.Unmarshal(data, &msg); err != nil {
+			_ = out.WriteControl(wsControlMsg{Op: "error", Message: "invalid control message"})
+			continue
+		}
+		switch msg.Op {
+		case "resize":
+			if msg.Cols > 0 && msg.Rows > 0 {
+				_ = sess.Resize(party, msg.Cols, msg.Rows)
+			}
+		case "signal":
+			sig := strings.TrimPrefix(strings.ToUpper(msg.Signal), "SIG")
+			if !allowedSignals[sig] {
+				_ = out.WriteControl(wsControlMsg{Op: "error", Message: "unsupported signal " + msg.Signal})
+				continue
+			}
+			if err := sess.Signal(party, sig); err != nil {
+				_ = out.WriteControl(wsControlMsg{Op: "error", Message: err.Error()})
+			}
+		case "ping":
+			_ = out.WriteControl(wsControlMsg{Op: "pong"})
+		case "close":
+			return true
+		default:
+			_ = out.WriteControl(wsControlMsg{Op: "error", Message: "unknown op " + msg.Op})
+		}
+	}
+}
+
+// sshTerminal adapts an *ssh.Session to session.Terminal.
+type sshTerminal struct{ *ssh.Session }
+
+func (t sshTerminal) Resize(cols, rows int) error { return t.WindowChange(rows, cols) }
+
+func (t sshTerminal) Signal(name string) error { return t.Session.Signal(ssh.Signal(name)) }
+
+// waitExit waits for the remote shell to finish and reports its exit
+// status to every party, which ends the session.
+func waitExit(sess *session.Session, sshSession *ssh.Session) {
+	err := sshSession.Wait()
+	status, signal := 0, ""
+	switch e := err.(type) {
+	case nil:
+	case *ssh.ExitError:
+		status, signal = e.ExitStatus(), e.Signal()
+	default:
+		// Connection closed (e.g. terminated) or no exit status sent
+		status = -1
+	}
+	sess.Exit(status, signal)
+}
+
+// websocketWriter serializes writes from the stdout/stderr copiers and
+// control messages, since a websocket.Conn allows only one writer. It
+// implements session.Conn for both protocols.
+type websocketWriter struct {
+	*websocket.Conn
+	mu    *sync.Mutex
+	proto string
+}
+
+func newWebsocketWriter(conn *websocket.Conn) *websocketWriter {
+	return &websocketWriter{Conn: conn, mu: &sync.Mutex{}}
+}
+
+func (w *websocketWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(p), w.Conn.WriteMessage(websocket.BinaryMessage, p)
+}
+
+// WriteText sends a status line to raw clients as a text frame. Framed
+// clients reserve binary frames for remote output and get status through
+// Notify and WriteError instead.
+func (w *websocketWriter) WriteText(msg string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Conn.WriteMessage(websocket.TextMessage, []byte(msg))
+}
+
+// WriteError reports a failure to the client, as an error control message
+// for framed clients.
+func (w *websocketWriter) WriteError(msg string) error {
+	if w.proto == protoFramed {
+		return w.WriteControl(wsControlMsg{Op: "error", Message: msg})
+	}
+	return w.WriteText(msg + "\n")
+}
+
+// WriteControl sends a JSON control message to framed clients. Raw
+// clients have no control channel and get nothing.
+func (w *websocketWriter) WriteControl(msg wsControlMsg) error {
+	if w.proto != protoFramed {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Conn.WriteJSON(msg)
+}
+
+// Notify writes a highlighted status line to the terminal, or a notice
+// control message for framed clients.
+func (w *websocketWriter) Notify(msg string) error {
+	if w.proto == protoFramed {
+		return w.WriteControl(wsControlMsg{Op: "notice", Message: msg})
+	}
+	return w.WriteText("\r\n\x1b[33m[" + msg + "]\x1b[0m\r\n")
+}
+
+// Close ends the WebSocket with a normal close frame, telling framed
+// clients not to try resuming.
+func (w *websocketWriter) Close() error {
+	w.mu.Lock()
+	_ = w.Conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	w.mu.Unlock()
+	return w.Conn.Close()
+}
+
+// Exit tells the client the remote command finished.
+func (w *websocketWriter) Exit(status int, signal string) error {
+	if w.proto != protoFramed {
+		line := "exit status " + strconv.Itoa(status)
+		if signal != "" {
+			line = "killed by signal " + signal
+		}
+		return w.Notify(line)
+	}
+	return w.WriteControl(wsControlMsg{Op: "exit", Status: &status, Signal: signal})
+}
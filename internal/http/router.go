@@ -7,14 +7,20 @@ import (
 	"gorm.io/gorm"
 
 	"teleport_lite/internal/auth"
+	"teleport_lite/internal/config"
+	"teleport_lite/internal/connect"
+	"teleport_lite/internal/discovery"
 	"teleport_lite/internal/http/handlers"
 
 	//"teleport_lite/internal/models"
 	"teleport_lite/internal/rbac"
+	"teleport_lite/internal/session"
 )
 
-func NewRouter(db *gorm.DB, jwtSecret string) *gin.Engine {
+func NewRouter(db *gorm.DB, cfg config.Config, sessions *session.Registry, tunnels *connect.Tunnels) *gin.Engine {
+	jwtSecret := cfg.JWTSecret
 	r := gin.Default()
+	jobs := discovery.NewJobs(db)
 	r.LoadHTMLGlob("internal/ui/views/*.tmpl")
 	r.Static("/static", "internal/ui/static")
 
@@ -80,7 +86,16 @@ func NewRouter(db *gorm.DB, jwtSecret string) *gin.Engine {
 	// Public routes
 	r.POST("/api/v1/auth/login", handlers.LoginHandler(db, jwtSecret))
 	r.POST("/agents/register", handlers.RegisterAgent(db))
-	r.POST("/agents/heartbeat", handlers.AgentHeartbeat(db))
+	// Agent calls, authenticated with the token issued at registration
+	agentMW := auth.Agent(db)
+	r.POST("/agents/heartbeat", agentMW, handlers.AgentHeartbeat(db, cfg.AgentReleasesDir))
+	r.GET("/agents/tunnel", agentMW, handlers.AgentTunnelWS(tunnels))
+	r.POST("/agents/deregister", agentMW, handlers.DeregisterAgent(db, tunnels))
+	r.GET("/agents/logins", agentMW, handlers.AgentLogins(db))
+	r.POST("/agents/logins/report", agentMW, handlers.AgentLoginReport(db))
+	r.GET("/agents/update/:version/:os/:arch", agentMW, handlers.AgentDownload(cfg.AgentReleasesDir))
+	r.GET("/agents/ssh/ca", agentMW, handlers.AgentSSHCA(db))
+	r.POST("/agents/ssh/events", agentMW, handlers.AgentSSHEvents(db))
 
 	// ✅ Protected API routes (still secure)
 	chk := rbac.Checker{DB: db}
@@ -91,10 +106,14 @@ func NewRouter(db *gorm.DB, jwtSecret string) *gin.Engine {
 		// Current user info & permissions
 		api.GET("/me", handlers.MeHandler(db))
 		api.POST("/me/password", handlers.ChangeMyPassword(db))
+		// API keys for non-interactive clients, e.g. ssh via the proxy
+		api.GET("/apikeys", handlers.ListAPIKeys(db))
+		api.POST("/apikeys", handlers.CreateAPIKey(db))
+		api.DELETE("/apikeys/:id", handlers.DeleteAPIKey(db))
 		// Users
 		api.GET("/users", require(chk, "users:read"), handlers.ListUsers(db))
 		api.POST("/users", require(chk, "users:write"), handlers.CreateUser(db))
-		api.POST("/users/:id/deactivate", require(chk, "users:assign-role"), handlers.DeactivateUser(db))
+		api.POST("/users/:id/deactivate", require(chk, "users:assign-role"), handlers.DeactivateUser(db, sessions))
 		api.POST("/users/:id/activate", require(chk, "users:assign-role"), handlers.ActivateUser(db))
 		api.POST("/users/:id/password", require(chk, "users:assign-role"), handlers.ChangePassword(db))
 		//api.POST("/users/:id/roles", require(chk, "users:assign-role"), assignRole(db))
@@ -104,6 +123,8 @@ func NewRouter(db *gorm.DB, jwtSecret string) *gin.Engine {
 		api.GET("/roles", require(chk, "roles:read"), handlers.ListRoles(db))
 		api.POST("/roles", require(chk, "roles:write"), handlers.CreateRole(db))
 		api.POST("/roles/:id/permissions", require(chk, "roles:write"), assignPerms(db))
+		api.GET("/roles/:id/policy", require(chk, "roles:read"), handlers.GetRolePolicy(db))
+		api.PUT("/roles/:id/policy", require(chk, "roles:write"), handlers.UpdateRolePolicy(db))
 
 		// Assign_Roles
 		assign := api.Group("/assign")
@@ -116,19 +137,84 @@ func NewRouter(db *gorm.DB, jwtSecret string) *gin.Engine {
 		api.GET("/resources", require(chk, "resources:read"), handlers.ListResources(db))
 		// Registration tokens for agents/resources (requires generate-token permission)
 		api.POST("/agents/tokens", require(chk, "resources:generate-token"), handlers.CreateRegistrationToken(db))
+		api.GET("/agents/tokens", require(chk, "resources:generate-token"), handlers.ListRegistrationTokens(db))
+		api.DELETE("/agents/tokens/:id", require(chk, "resources:generate-token"), handlers.RevokeRegistrationToken(db))
 		// Assign SSH users to a resource (admin only)
 		api.POST("/resources/:id/users", require(chk, "users:assign-role"), handlers.UpdateResourceUsers(db))
 		// Assign resource access to a user (admin only)
 		api.POST("/users/:id/access", require(chk, "users:assign-role"), handlers.UpdateUserAccess(db))
 		//api.GET("/resources/local", require(chk, "resources:read"), handlers.GetLocalResource)
 		api.POST("/resources", require(chk, "resources:write"), createResource(db))
+		api.DELETE("/resources/:id", require(chk, "resources:write"), handlers.DeleteResource(db, tunnels))
+		api.GET("/resources/:id/inventory", require(chk, "resources:read"), handlers.GetResourceInventory(db))
+		api.GET("/resources/:id/addresses", require(chk, "resources:read"), handlers.ListResourceAddresses(db))
+		api.GET("/resources/:id/logins", require(chk, "resources:read"), handlers.GetResourceLogins(db))
+		api.GET("/resources/:id/update", require(chk, "resources:read"), handlers.GetResourceUpdate(db))
+		// Agent self-update: target version per org or label selector
+		api.GET("/agent-updates", require(chk, "resources:read"), handlers.ListAgentUpdateTargets(db))
+		api.PUT("/agent-updates", require(chk, "resources:write"), handlers.SetAgentUpdateTarget(db))
+		api.DELETE("/agent-updates/:id", require(chk, "resources:write"), handlers.DeleteAgentUpdateTarget(db))
+		// Agent credentials: list, rotate on next heartbeat, revoke
+		api.GET("/resources/:id/agent-credentials", require(chk, "resources:read"), handlers.ListAgentCredentials(db))
+		api.POST("/resources/:id/agent-credentials/rotate", require(chk, "resources:write"), handlers.RotateAgentCredential(db))
+		api.DELETE("/resources/:id/agent-credentials", require(chk, "resources:write"), handlers.RevokeAgentCredentials(db, tunnels))
+		api.POST("/resources/:id/adopt", require(chk, "resources:write"), handlers.AllowAgentAdoption(db))
+
+		// Non-interactive commands, checked against the caller's allowed logins
+		api.POST("/resources/exec", handlers.ExecBatch(db))
+		api.POST("/resources/:id/exec", handlers.ExecResource(db))
+
+		// File transfer over SFTP, the login authorized like /ws/ssh
+		api.GET("/resources/:id/files", require(chk, "resources:read"), handlers.ListFiles(db))
+		api.GET("/resources/:id/files/download", require(chk, "resources:read"), handlers.DownloadFile(db, cfg.SFTPMaxBytes))
+		api.POST("/resources/:id/files/upload", require(chk, "resources:read"), handlers.UploadFile(db, cfg.SFTPMaxBytes))
 
 		//SSH
-		api.GET("/ws/ssh", handlers.SSHWS(db))
+		api.GET("/ws/ssh", handlers.SSHWS(db, sessions))
+		api.GET("/ws/forward", handlers.PortForwardWS(db))
+		api.GET("/ws/ssh/resume", handlers.SSHResumeWS(db, sessions))
+		api.GET("/ws/ssh/join", require(chk, "sessions:join"), handlers.SSHJoinWS(db, sessions))
+		// Short-lived certificates for OpenSSH clients going through the proxy
+		api.POST("/ssh/certs", handlers.IssueSSHCert(db))
+		api.GET("/ssh/proxy", handlers.SSHProxyInfo(db, cfg.SSHProxyAddr))
+		api.GET("/ssh/host-ca", require(chk, "resources:read"), handlers.HostAccessCA(db))
+
+		// Discovery of agentless SSH hosts
+		api.POST("/discovery/jobs", require(chk, "resources:write"), handlers.StartDiscovery(db, jobs))
+		api.GET("/discovery/jobs", require(chk, "resources:read"), handlers.ListDiscoveryJobs(db))
+		api.GET("/discovery/jobs/:id", require(chk, "resources:read"), handlers.GetDiscoveryJob(db))
+		api.DELETE("/discovery/jobs/:id", require(chk, "resources:write"), handlers.CancelDiscoveryJob(db, jobs))
+		api.POST("/discovery/candidates/:id/accept", require(chk, "resources:write"), handlers.AcceptCandidate(db))
+		api.POST("/discovery/candidates/:id/reject", require(chk, "resources:write"), handlers.RejectCandidate(db))
 
 		// Audit Trail
 		api.GET("/audit", require(chk, "audit:read"), handlers.ListAudit(db))
 
+		// Access simulation
+		api.GET("/access/explain", require(chk, "access:read"), handlers.ExplainAccess(db))
+		api.GET("/access/matrix", require(chk, "access:read"), handlers.AccessMatrix(db))
+
+		// Sessions
+		api.GET("/sessions", require(chk, "sessions:read"), handlers.ListSessions(db))
+		api.GET("/sessions/active", require(chk, "sessions:read"), handlers.ListActiveSessions(sessions))
+		api.DELETE("/sessions/:id", require(chk, "sessions:write"), handlers.TerminateSession(db, sessions))
+		api.GET("/sessions/:id/audit", require(chk, "sessions:read"), handlers.ListSessionAudit(db))
+		api.POST("/sessions/:id/terminate", handlers.ModeratorTerminateSession(db, sessions))
+
+		// Locks
+		api.GET("/locks", require(chk, "locks:read"), handlers.ListLocks(db))
+		api.POST("/locks", require(chk, "locks:write"), handlers.CreateLock(db, sessions))
+		api.DELETE("/locks/:id", require(chk, "locks:write"), handlers.DeleteLock(db))
+
+		// Access review campaigns
+		api.GET("/reviews", require(chk, "reviews:read"), handlers.ListAccessReviews(db))
+		api.POST("/reviews", require(chk, "reviews:write"), handlers.CreateAccessReview(db))
+		api.GET("/reviews/mine", handlers.ListMyReviewItems(db))
+		api.GET("/reviews/:id", require(chk, "reviews:read"), handlers.GetAccessReview(db))
+		api.GET("/reviews/:id/export", require(chk, "reviews:read"), handlers.ExportAccessReview(db))
+		api.POST("/reviews/:id/items/:item_id/decision", handlers.DecideAccessReviewItem(db))
+		api.POST("/reviews/:id/close", require(chk, "reviews:write"), handlers.CloseAccessReview(db))
+
 	}
 
 	// ✅ Remove protected root route to prevent template conflicts
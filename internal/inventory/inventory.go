@@ -0,0 +1,235 @@
+// Package inventory describes a host's state as agents report it on each
+// heartbeat. Collect reads everything from /proc (and utmp), so it works
+// against a copied /proc tree as well as the live one.
+package inventory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snapshot is one inventory report.
+type Snapshot struct {
+	CollectedAt       time.Time `json:"collected_at"`
+	AgentVersion      string    `json:"agent_version"`
+	Kernel            string    `json:"kernel"`
+	UptimeSeconds     float64   `json:"uptime_seconds"`
+	Load1             float64   `json:"load1"`
+	Load5             float64   `json:"load5"`
+	Load15            float64   `json:"load15"`
+	MemTotalBytes     uint64    `json:"mem_total_bytes"`
+	MemAvailableBytes uint64    `json:"mem_available_bytes"`
+	Disks             []Disk    `json:"disks"`
+	SSHDVersion       string    `json:"sshd_version"`
+	Users             []Login   `json:"users"`
+	ListeningPorts    []Port    `json:"listening_ports"`
+}
+
+// Disk is the usage of one mounted filesystem.
+type Disk struct {
+	Mount      string `json:"mount"`
+	FSType     string `json:"fs_type"`
+	TotalBytes uint64 `json:"total_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+}
+
+// Login is a logged-in user session from utmp.
+type Login struct {
+	User  string    `json:"user"`
+	TTY   string    `json:"tty"`
+	Host  string    `json:"host,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+// Port is a listening TCP socket.
+type Port struct {
+	Proto   string `json:"proto"` // tcp or tcp6
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+// Collector reads a host's inventory. The zero value reads the live
+// system.
+type Collector struct {
+	ProcRoot string // default /proc
+	UtmpPath string // default /var/run/utmp
+}
+
+// Collect gathers a snapshot. Parts that can't be read are left empty
+// rather than failing the whole report.
+func (c Collector) Collect(agentVersion string) Snapshot {
+	s := Snapshot{CollectedAt: time.Now().UTC(), AgentVersion: agentVersion}
+	s.Kernel = strings.TrimSpace(c.read("sys/kernel/osrelease"))
+	if f := strings.Fields(c.read("uptime")); len(f) > 0 {
+		s.UptimeSeconds, _ = strconv.ParseFloat(f[0], 64)
+	}
+	if f := strings.Fields(c.read("loadavg")); len(f) >= 3 {
+		s.Load1, _ = strconv.ParseFloat(f[0], 64)
+		s.Load5, _ = strconv.ParseFloat(f[1], 64)
+		s.Load15, _ = strconv.ParseFloat(f[2], 64)
+	}
+	mem := parseMeminfo(c.read("meminfo"))
+	s.MemTotalBytes = mem["MemTotal"]
+	s.MemAvailableBytes = mem["MemAvailable"]
+	s.Disks = disks(c.read("mounts"))
+	s.SSHDVersion = sshdVersion()
+	s.Users = c.logins()
+	s.ListeningPorts = append(listening("tcp", c.read("net/tcp")), listening("tcp6", c.read("net/tcp6"))...)
+	return s
+}
+
+func (c Collector) read(name string) string {
+	root := c.ProcRoot
+	if root == "" {
+		root = "/proc"
+	}
+	b, _ := os.ReadFile(filepath.Join(root, name))
+	return string(b)
+}
+
+// parseMeminfo returns /proc/meminfo values in bytes.
+func parseMeminfo(data string) map[string]uint64 {
+	out := map[string]uint64{}
+	sc := bufio.NewScanner(strings.NewReader(data))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(f[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(f) > 2 && f[2] == "kB" {
+			v *= 1024
+		}
+		out[strings.TrimSuffix(f[0], ":")] = v
+	}
+	return out
+}
+
+// diskFS are the filesystem types worth reporting; pseudo filesystems
+// such as proc, tmpfs and overlay are skipped.
+var diskFS = map[string]bool{
+	"ext2": true, "ext3": true, "ext4": true, "xfs": true, "btrfs": true,
+	"zfs": true, "vfat": true, "f2fs": true, "jfs": true, "reiserfs": true,
+}
+
+func disks(mounts string) []Disk {
+	var out []Disk
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(strings.NewReader(mounts))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 3 || !diskFS[f[2]] || seen[f[0]] {
+			continue
+		}
+		seen[f[0]] = true
+		d := Disk{Mount: f[1], FSType: f[2]}
+		d.TotalBytes, d.FreeBytes = statfs(f[1])
+		out = append(out, d)
+	}
+	return out
+}
+
+// sshdVersion asks sshd for its version; OpenSSH prints it to stderr.
+func sshdVersion() string {
+	for _, bin := range []string{"/usr/sbin/sshd", "sshd"} {
+		out, _ := exec.Command(bin, "-V").CombinedOutput()
+		line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		if strings.HasPrefix(line, "OpenSSH") {
+			return strings.TrimSuffix(line, ",")
+		}
+	}
+	return ""
+}
+
+// utmp record layout used by glibc on 64-bit Linux.
+const (
+	utmpSize        = 384
+	utmpUserProcess = 7
+)
+
+func (c Collector) logins() []Login {
+	path := c.UtmpPath
+	if path == "" {
+		path = "/var/run/utmp"
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var out []Login
+	for off := 0; off+utmpSize <= len(data); off += utmpSize {
+		rec := data[off : off+utmpSize]
+		if int16(binary.LittleEndian.Uint16(rec[0:])) != utmpUserProcess {
+			continue
+		}
+		out = append(out, Login{
+			User:  cstring(rec[44:76]),
+			TTY:   cstring(rec[8:40]),
+			Host:  cstring(rec[76:332]),
+			Since: time.Unix(int64(int32(binary.LittleEndian.Uint32(rec[340:]))), 0).UTC(),
+		})
+	}
+	return out
+}
+
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+// tcpListen is the socket state of a listening socket in /proc/net/tcp.
+const tcpListen = "0A"
+
+// listening parses /proc/net/tcp or tcp6 for listening sockets.
+func listening(proto, table string) []Port {
+	var out []Port
+	sc := bufio.NewScanner(strings.NewReader(table))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 4 || f[3] != tcpListen {
+			continue
+		}
+		hexIP, hexPort, ok := strings.Cut(f[1], ":")
+		if !ok {
+			continue
+		}
+		port, err := strconv.ParseUint(hexPort, 16, 16)
+		if err != nil {
+			continue
+		}
+		ip := procIP(hexIP)
+		if ip == nil {
+			continue
+		}
+		out = append(out, Port{Proto: proto, Address: ip.String(), Port: int(port)})
+	}
+	return out
+}
+
+// procIP decodes an address from /proc/net/tcp*, stored as 32-bit words
+// in host (little-endian) byte order.
+func procIP(s string) net.IP {
+	b, err := hex.DecodeString(s)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil
+	}
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	return ip
+}
@@ -0,0 +1,119 @@
+package inventory
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeFixture writes files, keyed by path relative to root.
+func writeFixture(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// utmpRecord builds one glibc utmp record.
+func utmpRecord(typ int16, tty, user, host string, since int32) []byte {
+	rec := make([]byte, utmpSize)
+	binary.LittleEndian.PutUint16(rec[0:], uint16(typ))
+	copy(rec[8:40], tty)
+	copy(rec[44:76], user)
+	copy(rec[76:332], host)
+	binary.LittleEndian.PutUint32(rec[340:], uint32(since))
+	return rec
+}
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	proc := filepath.Join(dir, "proc")
+	writeFixture(t, proc, map[string]string{
+		"sys/kernel/osrelease": "6.1.0-18-amd64\n",
+		"uptime":               "12345.67 45678.90\n",
+		"loadavg":              "0.52 0.34 0.10 1/234 5678\n",
+		"meminfo": "MemTotal:        2048000 kB\n" +
+			"MemFree:          512000 kB\n" +
+			"MemAvailable:    1024000 kB\n" +
+			"HugePages_Total:       0\n",
+		"net/tcp": "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 00000000:0016 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 0 100 0 0 10 0\n" +
+			"   1: 0100007F:1538 00000000:0000 0A 00000000:00000000 00:00000000 00000000   106        0 2 1 0 100 0 0 10 0\n" +
+			"   2: 0F02000A:0016 0202000A:C350 01 00000000:00000000 02:000A7B2C 00000000     0        0 3 4 0 20 4 30 10 -1\n",
+		"net/tcp6": "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+			"   0: 00000000000000000000000000000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 4 1 0 100 0 0 10 0\n" +
+			"   1: 00000000000000000000000001000000:0277 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 5 1 0 100 0 0 10 0\n",
+	})
+
+	var utmp []byte
+	utmp = append(utmp, utmpRecord(2, "~", "reboot", "6.1.0-18-amd64", 1700000000)...) // BOOT_TIME
+	utmp = append(utmp, utmpRecord(utmpUserProcess, "pts/0", "alice", "10.0.2.2", 1700000100)...)
+	utmp = append(utmp, utmpRecord(8, "pts/1", "", "", 1700000200)...) // DEAD_PROCESS
+	utmp = append(utmp, utmpRecord(utmpUserProcess, "tty1", "bob", "", 1700000300)...)
+	utmp = append(utmp, make([]byte, 10)...) // truncated trailing record
+	utmpPath := filepath.Join(dir, "utmp")
+	if err := os.WriteFile(utmpPath, utmp, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := Collector{ProcRoot: proc, UtmpPath: utmpPath}.Collect("1.4.0")
+
+	if s.AgentVersion != "1.4.0" {
+		t.Errorf("AgentVersion = %q", s.AgentVersion)
+	}
+	if s.Kernel != "6.1.0-18-amd64" {
+		t.Errorf("Kernel = %q", s.Kernel)
+	}
+	if s.UptimeSeconds != 12345.67 {
+		t.Errorf("UptimeSeconds = %v", s.UptimeSeconds)
+	}
+	if s.Load1 != 0.52 || s.Load5 != 0.34 || s.Load15 != 0.10 {
+		t.Errorf("load = %v %v %v", s.Load1, s.Load5, s.Load15)
+	}
+	if s.MemTotalBytes != 2048000*1024 || s.MemAvailableBytes != 1024000*1024 {
+		t.Errorf("memory = %d total, %d available", s.MemTotalBytes, s.MemAvailableBytes)
+	}
+
+	wantPorts := []Port{
+		{Proto: "tcp", Address: "0.0.0.0", Port: 22},
+		{Proto: "tcp", Address: "127.0.0.1", Port: 5432},
+		{Proto: "tcp6", Address: "::", Port: 22},
+		{Proto: "tcp6", Address: "::1", Port: 631},
+	}
+	if !reflect.DeepEqual(s.ListeningPorts, wantPorts) {
+		t.Errorf("ListeningPorts = %+v, want %+v", s.ListeningPorts, wantPorts)
+	}
+
+	wantUsers := []Login{
+		{User: "alice", TTY: "pts/0", Host: "10.0.2.2", Since: time.Unix(1700000100, 0).UTC()},
+		{User: "bob", TTY: "tty1", Since: time.Unix(1700000300, 0).UTC()},
+	}
+	if !reflect.DeepEqual(s.Users, wantUsers) {
+		t.Errorf("Users = %+v, want %+v", s.Users, wantUsers)
+	}
+}
+
+func TestCollectMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	s := Collector{ProcRoot: dir, UtmpPath: filepath.Join(dir, "utmp")}.Collect("dev")
+	if s.Kernel != "" || s.UptimeSeconds != 0 || s.MemTotalBytes != 0 || s.Users != nil || s.ListeningPorts != nil {
+		t.Errorf("expected an empty snapshot, got %+v", s)
+	}
+}
+
+func TestParseMeminfo(t *testing.T) {
+	got := parseMeminfo("MemTotal:  100 kB\nbad line\nHugePages_Total:   4\nSwapTotal: x kB\n")
+	want := map[string]uint64{"MemTotal": 100 * 1024, "HugePages_Total": 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMeminfo = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,12 @@
+package inventory
+
+import "syscall"
+
+// statfs returns the total and available bytes of the filesystem at path.
+func statfs(path string) (total, free uint64) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package inventory
+
+// statfs is only implemented on Linux, where agents run.
+func statfs(path string) (total, free uint64) {
+	return 0, 0
+}
@@ -0,0 +1,108 @@
+package locks
+
+import (
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/session"
+)
+
+// RoleIDs returns the roles assigned to userID within orgID.
+func RoleIDs(db *gorm.DB, orgID, userID int64) ([]int64, error) {
+	var ids []int64
+	err := db.Model(&models.UserRole{}).
+		Where("user_id = ? AND org_id = ?", userID, orgID).
+		Pluck("role_id", &ids).Error
+	return ids, err
+}
+
+// ForUser returns the first active lock targeting the user or one of their
+// roles, or nil if there is none.
+func ForUser(db *gorm.DB, orgID, userID int64, roleIDs []int64) (*models.Lock, error) {
+	return find(db, orgID,
+		"(target_kind = ? AND target_value = ?) OR (target_kind = ? AND target_value IN ?)",
+		models.LockTargetUser, strconv.FormatInt(userID, 10),
+		models.LockTargetRole, idStrings(roleIDs),
+	)
+}
+
+// ForSession returns the first active lock that forbids the user from
+// opening a session on resourceID as login, or nil if there is none.
+func ForSession(db *gorm.DB, orgID, userID int64, roleIDs []int64, resourceID int64, login string) (*models.Lock, error) {
+	return find(db, orgID,
+		"(target_kind = ? AND target_value = ?) OR (target_kind = ? AND target_value IN ?) OR "+
+			"(target_kind = ? AND target_value = ?) OR (target_kind = ? AND target_value = ?)",
+		models.LockTargetUser, strconv.FormatInt(userID, 10),
+		models.LockTargetRole, idStrings(roleIDs),
+		models.LockTargetResource, strconv.FormatInt(resourceID, 10),
+		models.LockTargetLogin, login,
+	)
+}
+
+// Matches reports whether lock applies to the live session s.
+func Matches(lock models.Lock, s *session.Session) bool {
+	if lock.OrgID != s.OrgID {
+		return false
+	}
+	switch lock.TargetKind {
+	case models.LockTargetUser:
+		return lock.TargetValue == strconv.FormatInt(s.UserID, 10)
+	case models.LockTargetRole:
+		for _, id := range s.RoleIDs {
+			if lock.TargetValue == strconv.FormatInt(id, 10) {
+				return true
+			}
+		}
+	case models.LockTargetResource:
+		return lock.TargetValue == strconv.FormatInt(s.ResourceID, 10)
+	case models.LockTargetLogin:
+		return lock.TargetValue == s.Login
+	}
+	return false
+}
+
+func find(db *gorm.DB, orgID int64, cond string, args ...interface{}) (*models.Lock, error) {
+	var lock models.Lock
+	err := db.Where("org_id = ?", orgID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Where(cond, args...).
+		Order("id").
+		Limit(1).
+		Find(&lock).Error
+	if err != nil || lock.ID == 0 {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+func idStrings(ids []int64) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, strconv.FormatInt(id, 10))
+	}
+	if len(out) == 0 {
+		// Keep "IN ?" valid when the user has no roles.
+		out = append(out, "")
+	}
+	return out
+}
+
+// Refusal returns the message shown when a lock keeps userID from opening
+// login on resourceID, or "" if no lock applies. A failed lookup refuses.
+func Refusal(db *gorm.DB, orgID, userID int64, roleIDs []int64, resourceID int64, login string) string {
+	lock, err := ForSession(db, orgID, userID, roleIDs, resourceID, login)
+	if err != nil {
+		return "session refused: lock check failed"
+	}
+	if lock == nil {
+		return ""
+	}
+	msg := "⛔ session refused: " + lock.TargetKind + " is locked"
+	if lock.Message != "" {
+		msg += " (" + lock.Message + ")"
+	}
+	return msg
+}
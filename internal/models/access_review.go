@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+const (
+	ReviewOpen   = "open"
+	ReviewClosed = "closed"
+
+	ReviewPending = "pending"
+	ReviewKeep    = "keep"
+	ReviewRevoke  = "revoke"
+
+	ReviewItemRole           = "role"
+	ReviewItemResourceAccess = "resource_access"
+)
+
+// AccessReviewCampaign is a certification round that snapshots the current
+// role and resource grants so reviewers can keep or revoke each of them.
+type AccessReviewCampaign struct {
+	ID          int64      `gorm:"primaryKey" json:"id"`
+	OrgID       int64      `gorm:"index;not null" json:"org_id"`
+	Name        string     `gorm:"size:200;not null" json:"name"`
+	Description string     `gorm:"type:text" json:"description"`
+	Status      string     `gorm:"size:20;index;default:open" json:"status"`
+	DueAt       *time.Time `json:"due_at"`
+	CreatedBy   int64      `json:"created_by"`
+	ClosedBy    int64      `json:"closed_by"`
+	ClosedAt    *time.Time `json:"closed_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	Items []AccessReviewItem `gorm:"foreignKey:CampaignID" json:"items,omitempty"`
+}
+
+// AccessReviewItem is a single grant under review. Kind "role" refers to a
+// user_roles row, kind "resource_access" to a UserResourceAccess row.
+type AccessReviewItem struct {
+	ID           int64      `gorm:"primaryKey" json:"id"`
+	CampaignID   int64      `gorm:"index;not null" json:"campaign_id"`
+	OrgID        int64      `gorm:"index;not null" json:"org_id"`
+	Kind         string     `gorm:"size:32;not null" json:"kind"`
+	UserID       int64      `gorm:"index;not null" json:"user_id"`
+	UserEmail    string     `gorm:"size:255" json:"user_email"`
+	RoleID       int64      `json:"role_id,omitempty"`
+	RoleName     string     `gorm:"size:200" json:"role_name,omitempty"`
+	AccessID     uint64     `json:"access_id,omitempty"`
+	ResourceID   uint64     `json:"resource_id,omitempty"`
+	ResourceName string     `gorm:"size:200" json:"resource_name,omitempty"`
+	ConnectUser  string     `gorm:"size:255" json:"connect_user,omitempty"`
+	ReviewerID   int64      `gorm:"index" json:"reviewer_id"`
+	Decision     string     `gorm:"size:20;default:pending" json:"decision"`
+	Comment      string     `gorm:"type:text" json:"comment"`
+	DecidedAt    *time.Time `json:"decided_at"`
+	AppliedAt    *time.Time `json:"applied_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
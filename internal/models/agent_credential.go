@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// AgentCredential is the bearer token an agent presents on heartbeats and
+// every later agent call. It is bound to one resource and only its SHA-256
+// is stored.
+type AgentCredential struct {
+	ID         int64  `gorm:"primaryKey" json:"id"`
+	OrgID      int64  `gorm:"index;not null" json:"org_id"`
+	ResourceID int64  `gorm:"index;not null" json:"resource_id"`
+	Prefix     string `gorm:"size:20;not null" json:"prefix"` // shown to identify the token
+	Hash       string `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	// RotateRequested hands the agent a replacement on its next heartbeat
+	RotateRequested bool       `gorm:"default:false" json:"rotate_requested"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	LastUsedAt      *time.Time `json:"last_used_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AgentUpdateTarget is the agent version resources should run. A target
+// with a label selector applies to the org's resources matching it and
+// takes precedence over the org-wide target with an empty selector.
+type AgentUpdateTarget struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	OrgID     int64     `gorm:"uniqueIndex:idx_update_target;not null" json:"org_id"`
+	Labels    string    `gorm:"size:255;uniqueIndex:idx_update_target" json:"labels"` // selector, empty = all resources
+	Version   string    `gorm:"size:50;not null" json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
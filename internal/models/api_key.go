@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// APIKey is a long-lived secret a user can present instead of a password,
+// e.g. to the SSH proxy. Only the SHA-256 of the key is stored.
+type APIKey struct {
+	ID         int64      `gorm:"primaryKey" json:"id"`
+	OrgID      int64      `gorm:"index;not null" json:"org_id"`
+	UserID     int64      `gorm:"index;not null" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:20;not null" json:"prefix"` // shown to identify the key
+	Hash       string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Valid reports whether the key may be used at t.
+func (k APIKey) Valid(t time.Time) bool {
+	return k.ExpiresAt == nil || k.ExpiresAt.After(t)
+}
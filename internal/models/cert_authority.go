@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	// CAUser signs short-lived SSH certificates for users of an
+	// organization.
+	CAUser = "user"
+	// CAProxyHost is the host key of the controller's SSH proxy. It is
+	// global, so its OrgID is 0.
+	CAProxyHost = "proxy_host"
+	// CAHostAccess signs the short-lived certificates the controller logs
+	// into agentless resources with. Hosts trust it in TrustedUserCAKeys.
+	CAHostAccess = "host_access"
+)
+
+// CertAuthority is an SSH key pair owned by the controller.
+type CertAuthority struct {
+	ID         int64     `gorm:"primaryKey" json:"id"`
+	OrgID      int64     `gorm:"uniqueIndex:idx_ca_org_type;not null" json:"org_id"`
+	Type       string    `gorm:"size:30;uniqueIndex:idx_ca_org_type;not null" json:"type"`
+	PublicKey  string    `gorm:"type:text;not null" json:"public_key"` // authorized_keys format
+	PrivateKey string    `gorm:"type:text;not null" json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Discovery job states.
+const (
+	DiscoveryRunning   = "running"
+	DiscoveryDone      = "done"
+	DiscoveryCancelled = "cancelled"
+	DiscoveryFailed    = "failed"
+)
+
+// Discovery candidate states.
+const (
+	CandidateProposed = "proposed"
+	CandidateAccepted = "accepted"
+	CandidateRejected = "rejected"
+	CandidateExisting = "existing" // the host is already a resource
+)
+
+// DiscoveryJob is a scan of a CIDR range for SSH servers.
+type DiscoveryJob struct {
+	ID          int64      `gorm:"primaryKey" json:"id"`
+	OrgID       int64      `gorm:"index;not null" json:"org_id"`
+	CIDR        string     `gorm:"size:64;not null" json:"cidr"`
+	Ports       string     `gorm:"size:255;not null" json:"ports"` // comma separated
+	Concurrency int        `json:"concurrency"`
+	Status      string     `gorm:"size:20;index" json:"status"`
+	Total       int        `json:"total"`   // probes to run
+	Scanned     int        `json:"scanned"` // probes finished
+	Found       int        `json:"found"`
+	Error       string     `gorm:"size:255" json:"error,omitempty"`
+	CreatedBy   int64      `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
+
+// DiscoveryCandidate is an SSH server found by a job, proposed as a
+// resource.
+type DiscoveryCandidate struct {
+	ID          int64     `gorm:"primaryKey" json:"id"`
+	JobID       int64     `gorm:"index;not null" json:"job_id"`
+	OrgID       int64     `gorm:"index;not null" json:"org_id"`
+	Host        string    `gorm:"size:100;not null" json:"host"`
+	Port        int       `json:"port"`
+	Banner      string    `gorm:"size:255" json:"banner"`
+	HostKey     string    `gorm:"type:text" json:"host_key"` // authorized_keys format
+	Fingerprint string    `gorm:"size:100" json:"fingerprint"`
+	Status      string    `gorm:"size:20;index" json:"status"`
+	ResourceID  *int64    `json:"resource_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	LockTargetUser     = "user"
+	LockTargetRole     = "role"
+	LockTargetResource = "resource"
+	LockTargetLogin    = "login"
+)
+
+// Lock quarantines a user, role, resource or login. While a lock is active
+// matching users cannot authenticate and matching SSH sessions are refused
+// or terminated.
+type Lock struct {
+	ID          int64      `gorm:"primaryKey" json:"id"`
+	OrgID       int64      `gorm:"index;not null" json:"org_id"`
+	TargetKind  string     `gorm:"size:20;index:idx_lock_target;not null" json:"target_kind"`
+	TargetValue string     `gorm:"size:255;index:idx_lock_target;not null" json:"target_value"` // id or login name
+	Message     string     `gorm:"size:255" json:"message"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expires_at"`
+	CreatedBy   int64      `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Active reports whether the lock is in force at t.
+func (l Lock) Active(t time.Time) bool {
+	return l.ExpiresAt == nil || l.ExpiresAt.After(t)
+}
@@ -1,14 +1,61 @@
 package models
 
-import "time"
+import (
+	"strings"
+	"time"
+)
 
 // RegistrationToken represents a one-time or time-limited token used to
-// authorize agent/resource registration with the controller.
+// authorize agent/resource registration with the controller. Resources
+// registered with it join its organization and get its labels.
 type RegistrationToken struct {
-	ID         int64      `gorm:"primaryKey"`
-	Token      string     `gorm:"size:128;index;not null"`
-	ResourceID *int64     `gorm:"index;null"`
-	Used       bool       `gorm:"default:false"`
-	ExpiresAt  *time.Time `gorm:"index;null"`
-	CreatedAt  time.Time
+	ID          int64  `gorm:"primaryKey" json:"id"`
+	OrgID       int64  `gorm:"index;not null;default:1" json:"org_id"`
+	Token       string `gorm:"size:128;index;not null" json:"-"`
+	Description string `gorm:"size:255" json:"description"`
+	// Labels are applied to registered resources, e.g. "env=prod,team=db";
+	// they override labels sent by the agent.
+	Labels string `gorm:"size:255" json:"labels"`
+	// AllowedTypes lists the resource types it may register, comma
+	// separated, empty = any.
+	AllowedTypes string     `gorm:"size:255" json:"allowed_types"`
+	MaxUses      int        `gorm:"not null;default:1" json:"max_uses"` // 0 = unlimited
+	Uses         int        `gorm:"default:0" json:"uses"`
+	ResourceID   *int64     `gorm:"index;null" json:"resource_id"` // last resource registered
+	Used         bool       `gorm:"default:false" json:"used"`     // exhausted
+	ExpiresAt    *time.Time `gorm:"index;null" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedBy    int64      `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Exhausted reports whether the token has no uses left.
+func (t RegistrationToken) Exhausted() bool {
+	return t.Used || (t.MaxUses > 0 && t.Uses >= t.MaxUses)
+}
+
+// LabelMap parses Labels into key/value pairs.
+func (t RegistrationToken) LabelMap() map[string]string {
+	out := map[string]string{}
+	for _, part := range strings.Split(t.Labels, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) != "" {
+			out[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return out
+}
+
+// AllowsType reports whether the token may register a resource of type
+// typ. Types compare case-insensitively.
+func (t RegistrationToken) AllowsType(typ string) bool {
+	if strings.TrimSpace(t.AllowedTypes) == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(t.AllowedTypes, ",") {
+		if strings.EqualFold(strings.TrimSpace(allowed), typ) {
+			return true
+		}
+	}
+	return false
 }
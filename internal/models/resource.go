@@ -1,14 +1,31 @@
 package models
 
 import (
+	"encoding/json"
 	"gorm.io/datatypes"
 	"time"
 )
 
+// Resource states, see internal/health.
+const (
+	ResourceOnline   = "online"
+	ResourceDegraded = "degraded"
+	ResourceOffline  = "offline"
+	// ResourceAgentless resources have no agent and so no heartbeats.
+	ResourceAgentless = "agentless"
+)
+
+// Resource auth methods: how the controller logs into a resource.
+const (
+	AuthKey = "key" // the private key in Resource.PrivateKey
+	AuthCA  = "ca"  // a certificate from the org's host access CA
+)
+
 type Resource struct {
 	ID            int64          `gorm:"primaryKey"`
 	OrgID         int64          `gorm:"index;not null"`
 	Name          string         `gorm:"size:200;not null"`
+	HostID        string         `gorm:"size:36;index" json:"-"` // UUID the agent keeps in its data dir, not shown to API users
 	Type          string         `gorm:"size:100;not null"`
 	Port          int            `gorm:"default:22" json:"Port"`
 	ExternalRef   string         `gorm:"size:255"`
@@ -18,9 +35,41 @@ type Resource struct {
 	PrivateKey    string         `gorm:"type:text" json:"-"`
 	Status        string         `gorm:"size:50" json:"Status"`
 	LastHeartbeat time.Time      `json:"last_heartbeat"`
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	Tunnel        bool           `gorm:"default:false" json:"tunnel"` // reached through the agent's reverse tunnel
+	Inventory     datatypes.JSON `gorm:"type:json" json:"-"`          // latest snapshot, see ResourceInventory
+	Provisioning  datatypes.JSON `gorm:"type:json" json:"-"`          // last host account report from the agent
+	AgentVersion  string         `gorm:"size:50" json:"agent_version"`
+	UpdateStatus  datatypes.JSON `gorm:"type:json" json:"update_status,omitempty"` // agentupdate.Status of the last self-update
+	AuthMethod    string         `gorm:"size:10;default:key" json:"auth_method"`   // AuthKey or AuthCA
+	HostKey       string         `gorm:"type:text" json:"-"`                       // pinned when set, authorized_keys format
+	SSHServer     bool           `gorm:"default:false" json:"ssh_server"`          // the agent's own SSH server answers on Port
+	// AdoptableUntil lets an agent without the resource's agent token
+	// register over it until then; only set by an admin.
+	AdoptableUntil *time.Time `json:"adoptable_until,omitempty"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
 
 	Org         *Organization `gorm:"foreignKey:OrgID"`
 	AccessRules []AccessRule  `gorm:"foreignKey:ResourceID"`
 }
+
+// Labels returns the key/value labels stored under metadata.labels.
+// Resources without labels return an empty (non-nil) map.
+func (r Resource) Labels() map[string]string {
+	out := map[string]string{}
+	if len(r.Metadata) == 0 {
+		return out
+	}
+	var meta struct {
+		Labels map[string]interface{} `json:"labels"`
+	}
+	if err := json.Unmarshal(r.Metadata, &meta); err != nil {
+		return out
+	}
+	for k, v := range meta.Labels {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		}
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ResourceAddress is an IP a resource's agent has reported, so address
+// changes (DHCP, moves) stay visible after Resource.Host is updated.
+type ResourceAddress struct {
+	ID         int64     `gorm:"primaryKey" json:"id"`
+	ResourceID int64     `gorm:"index:idx_resource_address,unique;not null" json:"resource_id"`
+	IP         string    `gorm:"size:100;index:idx_resource_address,unique;not null" json:"ip"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// ResourceInventory is one inventory snapshot reported by a resource's
+// agent, see internal/inventory. Only the most recent ones are kept.
+type ResourceInventory struct {
+	ID         int64          `gorm:"primaryKey" json:"id"`
+	ResourceID int64          `gorm:"index;not null" json:"resource_id"`
+	Snapshot   datatypes.JSON `gorm:"type:json" json:"snapshot"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	ModeratorLeavePause     = "pause"
+	ModeratorLeaveTerminate = "terminate"
+)
+
+// RolePolicy holds SSH session settings applied to every member of a role.
+type RolePolicy struct {
+	RoleID int64 `gorm:"primaryKey;autoIncrement:false" json:"role_id"`
+	OrgID  int64 `gorm:"index;not null" json:"org_id"`
+
+	// Moderated sessions: members of this role may only start a session on
+	// resources matching ModeratedLabels once RequiredModerators users
+	// holding ModeratorRoleID have joined.
+	RequiredModerators int    `gorm:"default:0" json:"required_moderators"`
+	ModeratorRoleID    int64  `json:"moderator_role_id"`
+	ModeratedLabels    string `gorm:"size:255" json:"moderated_labels"` // label selector, empty = all resources
+	OnModeratorLeave   string `gorm:"size:20;default:pause" json:"on_moderator_leave"`
+
+	// Session limits in minutes, 0 = no limit. Idle time counts from the
+	// last input or output on the terminal.
+	IdleTimeoutMinutes   int `gorm:"default:0" json:"idle_timeout_minutes"`
+	MaxSessionTTLMinutes int `gorm:"default:0" json:"max_session_ttl_minutes"`
+
+	// AllowedForwards lists the TCP destinations members may reach through
+	// port forwarding, as comma separated host:port patterns where either
+	// side may use * globs, e.g. "localhost:5432,10.0.*:80". Empty = none.
+	AllowedForwards string `gorm:"size:1024" json:"allowed_forwards"`
+
+	// Host accounts: agents create the logins members may use with these
+	// comma separated supplementary groups and shell, and install the
+	// sudoers rules, one spec per line such as "ALL=(ALL) NOPASSWD: ALL".
+	HostGroups  string `gorm:"size:255" json:"host_groups"`
+	HostShell   string `gorm:"size:255" json:"host_shell"`
+	HostSudoers string `gorm:"size:1024" json:"host_sudoers"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
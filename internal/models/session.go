@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+const (
+	SessionActive = "active"
+	SessionEnded  = "ended"
+)
+
+// Session is the persisted record of an SSH session proxied by the
+// controller. Live state is kept in memory by internal/session; this row
+// survives restarts and keeps the history.
+type Session struct {
+	ID           string     `gorm:"primaryKey;size:64" json:"id"`
+	OrgID        int64      `gorm:"index;not null" json:"org_id"`
+	UserID       int64      `gorm:"index" json:"user_id"`
+	UserEmail    string     `gorm:"size:255" json:"user_email"`
+	ResourceID   int64      `gorm:"index" json:"resource_id"`
+	ResourceName string     `gorm:"size:200" json:"resource_name"`
+	Host         string     `gorm:"size:100" json:"host"`
+	Login        string     `gorm:"size:255" json:"login"`
+	ClientIP     string     `gorm:"size:64" json:"client_ip"`
+	Status       string     `gorm:"size:20;index" json:"status"`
+	BytesIn      int64      `json:"bytes_in"`
+	BytesOut     int64      `json:"bytes_out"`
+	EndReason    string     `gorm:"size:255" json:"end_reason"`
+	StartedAt    time.Time  `gorm:"index" json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
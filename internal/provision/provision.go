@@ -0,0 +1,52 @@
+// Package provision keeps the Unix accounts on an agent's host in line
+// with the logins the controller allows on its resource. The controller
+// computes the desired Logins; the agent's Reconciler creates and updates
+// them and reports a Result per login.
+package provision
+
+import (
+	"regexp"
+	"time"
+)
+
+// Login is a Unix account the controller wants on the host.
+type Login struct {
+	Name   string   `json:"name"`
+	Groups []string `json:"groups,omitempty"` // supplementary groups
+	Shell  string   `json:"shell,omitempty"`  // "" = the agent's default
+	// Sudoers are sudoers rule specs without the user, e.g.
+	// "ALL=(ALL) NOPASSWD: ALL". Empty = no sudo.
+	Sudoers []string `json:"sudoers,omitempty"`
+}
+
+// Reconciliation outcomes.
+const (
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+	ActionRevoked   = "revoked" // no longer allowed, account kept
+	ActionDeleted   = "deleted"
+	ActionFailed    = "failed"
+)
+
+// Result is the outcome of reconciling one login.
+type Result struct {
+	Login  string `json:"login"`
+	Action string `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is what an agent sends back after a reconciliation.
+type Report struct {
+	Results []Result  `json:"results"`
+	At      time.Time `json:"at"`
+}
+
+var nameRE = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// ValidName reports whether name is usable as a login or group name. It
+// is deliberately stricter than useradd so names are also safe in
+// sudoers and file names.
+func ValidName(name string) bool {
+	return nameRE.MatchString(name)
+}
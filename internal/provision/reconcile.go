@@ -0,0 +1,290 @@
+package provision
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sudoersPrefix names the drop-in files the reconciler owns.
+const sudoersPrefix = "teleport-lite-"
+
+// Reconciler applies desired logins to the local host with the shadow
+// utilities. It must run as root.
+type Reconciler struct {
+	SudoersDir   string // default /etc/sudoers.d
+	DefaultShell string // default /bin/bash
+	// DeleteRevoked removes accounts the reconciler created once no user
+	// may log in as them any more. Otherwise they only lose sudo.
+	DeleteRevoked bool
+}
+
+// Reconcile brings the host in line with desired. managed lists the
+// accounts created by earlier runs; only those are ever deleted or have
+// their shell and groups replaced, existing accounts only gain groups and
+// sudo. It returns a result per login and the new managed list.
+func (r Reconciler) Reconcile(desired []Login, managed []string) ([]Result, []string) {
+	if os.Geteuid() != 0 {
+		results := make([]Result, 0, len(desired))
+		for _, l := range desired {
+			results = append(results, Result{Login: l.Name, Action: ActionFailed, Error: "agent is not running as root"})
+		}
+		return results, managed
+	}
+
+	isManaged := map[string]bool{}
+	for _, name := range managed {
+		isManaged[name] = true
+	}
+	wanted := map[string]bool{}
+	var results []Result
+
+	for _, l := range desired {
+		wanted[l.Name] = true
+		action, err := r.apply(l, isManaged)
+		if err != nil {
+			results = append(results, Result{Login: l.Name, Action: ActionFailed, Error: err.Error()})
+			continue
+		}
+		results = append(results, Result{Login: l.Name, Action: action})
+	}
+
+	for _, name := range managed {
+		if wanted[name] {
+			continue
+		}
+		action, err := r.revoke(name)
+		if err != nil {
+			results = append(results, Result{Login: name, Action: ActionFailed, Error: err.Error()})
+			continue
+		}
+		if action == ActionDeleted {
+			delete(isManaged, name)
+		}
+		results = append(results, Result{Login: name, Action: action})
+	}
+
+	// Drop-ins left over for accounts the reconciler never created
+	if files, err := filepath.Glob(filepath.Join(r.sudoersDir(), sudoersPrefix+"*")); err == nil {
+		for _, f := range files {
+			if name := strings.TrimPrefix(filepath.Base(f), sudoersPrefix); !wanted[name] && !isManaged[name] {
+				_ = os.Remove(f)
+			}
+		}
+	}
+
+	next := make([]string, 0, len(isManaged))
+	for name := range isManaged {
+		next = append(next, name)
+	}
+	sort.Strings(next)
+	return results, next
+}
+
+// apply creates or updates one account, recording it in managed when
+// created.
+func (r Reconciler) apply(l Login, managed map[string]bool) (string, error) {
+	if !ValidName(l.Name) || l.Name == "root" {
+		return "", fmt.Errorf("refusing to provision login %q", l.Name)
+	}
+	for _, g := range l.Groups {
+		if !ValidName(g) {
+			return "", fmt.Errorf("invalid group %q", g)
+		}
+		if _, err := user.LookupGroup(g); err != nil {
+			if err := run("groupadd", g); err != nil {
+				return "", err
+			}
+		}
+	}
+	shell := l.Shell
+	if shell == "" {
+		shell = r.defaultShell()
+	}
+	if !filepath.IsAbs(shell) {
+		return "", fmt.Errorf("shell %q is not an absolute path", shell)
+	}
+
+	action := ActionUnchanged
+	u, err := user.Lookup(l.Name)
+	switch {
+	case errors.As(err, new(user.UnknownUserError)):
+		args := []string{"--create-home", "--shell", shell}
+		if len(l.Groups) > 0 {
+			args = append(args, "--groups", strings.Join(l.Groups, ","))
+		}
+		if err := run("useradd", append(args, l.Name)...); err != nil {
+			return "", err
+		}
+		managed[l.Name] = true
+		action = ActionCreated
+	case err != nil:
+		return "", err
+	case managed[l.Name]:
+		have, _ := groupNames(u)
+		if loginShell(l.Name) != shell || !sameSet(have, l.Groups) {
+			if err := run("usermod", "--shell", shell, "--groups", strings.Join(l.Groups, ","), l.Name); err != nil {
+				return "", err
+			}
+			action = ActionUpdated
+		}
+	default:
+		have, _ := groupNames(u)
+		if missing := without(l.Groups, have); len(missing) > 0 {
+			if err := run("usermod", "--append", "--groups", strings.Join(missing, ","), l.Name); err != nil {
+				return "", err
+			}
+			action = ActionUpdated
+		}
+	}
+
+	changed, err := r.writeSudoers(l.Name, l.Sudoers)
+	if err != nil {
+		return "", err
+	}
+	if changed && action == ActionUnchanged {
+		action = ActionUpdated
+	}
+	return action, nil
+}
+
+// revoke handles a managed account no user may log in as any more.
+func (r Reconciler) revoke(name string) (string, error) {
+	if _, err := r.writeSudoers(name, nil); err != nil {
+		return "", err
+	}
+	if !r.DeleteRevoked {
+		return ActionRevoked, nil
+	}
+	if _, err := user.Lookup(name); errors.As(err, new(user.UnknownUserError)) {
+		return ActionDeleted, nil
+	}
+	if err := run("userdel", "--remove", name); err != nil {
+		return "", err
+	}
+	return ActionDeleted, nil
+}
+
+// writeSudoers installs the drop-in for name, or removes it when specs is
+// empty. The file is checked with visudo before it goes live. It reports
+// whether anything changed.
+func (r Reconciler) writeSudoers(name string, specs []string) (bool, error) {
+	path := filepath.Join(r.sudoersDir(), sudoersPrefix+name)
+	old, _ := os.ReadFile(path)
+	if len(specs) == 0 {
+		if old == nil {
+			return false, nil
+		}
+		return true, os.Remove(path)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Managed by the teleport-lite agent, changes are overwritten\n")
+	for _, spec := range specs {
+		if strings.ContainsAny(spec, "\r\n") {
+			return false, fmt.Errorf("invalid sudoers rule %q", spec)
+		}
+		fmt.Fprintf(&b, "%s %s\n", name, spec)
+	}
+	if string(old) == b.String() {
+		return false, nil
+	}
+
+	// sudo skips files with a dot in their name, so the candidate is
+	// never read before it is checked
+	tmp := filepath.Join(r.sudoersDir(), "."+sudoersPrefix+name+".tmp")
+	if err := os.WriteFile(tmp, []byte(b.String()), 0440); err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp)
+	if err := run("visudo", "-cqf", tmp); err != nil {
+		return false, fmt.Errorf("sudoers rules rejected: %w", err)
+	}
+	return true, os.Rename(tmp, path)
+}
+
+func (r Reconciler) sudoersDir() string {
+	if r.SudoersDir != "" {
+		return r.SudoersDir
+	}
+	return "/etc/sudoers.d"
+}
+
+func (r Reconciler) defaultShell() string {
+	if r.DefaultShell != "" {
+		return r.DefaultShell
+	}
+	return "/bin/bash"
+}
+
+// run executes a command, folding its output into the error.
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %s", name, msg)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// groupNames returns the names of u's supplementary groups.
+func groupNames(u *user.User) ([]string, error) {
+	ids, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, id := range ids {
+		if id == u.Gid {
+			continue
+		}
+		if g, err := user.LookupGroupId(id); err == nil {
+			names = append(names, g.Name)
+		}
+	}
+	return names, nil
+}
+
+// loginShell reads name's shell from /etc/passwd.
+func loginShell(name string) string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Split(s.Text(), ":")
+		if len(fields) == 7 && fields[0] == name {
+			return fields[6]
+		}
+	}
+	return ""
+}
+
+// without returns the entries of want missing from have.
+func without(want, have []string) []string {
+	seen := map[string]bool{}
+	for _, h := range have {
+		seen[h] = true
+	}
+	var out []string
+	for _, w := range want {
+		if !seen[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func sameSet(a, b []string) bool {
+	return len(without(a, b)) == 0 && len(without(b, a)) == 0
+}
@@ -0,0 +1,342 @@
+package rbac
+
+import (
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+)
+
+// ConnectPermission grants SSH access: held through a role it covers every
+// resource, and access rules that grant it scope it to individual
+// resources or label selectors. Together with user_resource_access grants
+// it decides the logins Evaluator.Allowed reports, which every SSH path
+// (terminal, exec, SFTP, port forwards and the proxy) checks before
+// dialing.
+const ConnectPermission = "resources:write"
+
+// Grant records one reason a user holds a permission or a login.
+type Grant struct {
+	Source   string `json:"source"` // "role", "access_rule" or "user_resource_access"
+	RoleID   int64  `json:"role_id,omitempty"`
+	RoleName string `json:"role_name,omitempty"`
+	RuleID   uint64 `json:"rule_id,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+type PermissionGrant struct {
+	Key    string  `json:"key"`
+	Grants []Grant `json:"grants"`
+}
+
+type LoginGrant struct {
+	Login  string  `json:"login"`
+	Grants []Grant `json:"grants"`
+}
+
+type ResourceAccess struct {
+	ResourceID   int64        `json:"resource_id"`
+	ResourceName string       `json:"resource_name"`
+	Host         string       `json:"host"`
+	Logins       []LoginGrant `json:"logins"`
+}
+
+type RoleRef struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// Explanation is the effective access of a single user.
+type Explanation struct {
+	UserID      int64             `json:"user_id"`
+	Email       string            `json:"email"`
+	Name        string            `json:"name"`
+	Status      models.UserStatus `json:"status"`
+	Roles       []RoleRef         `json:"roles"`
+	Permissions []PermissionGrant `json:"permissions"`
+	Resources   []ResourceAccess  `json:"resources"`
+}
+
+// MatrixRow is one (user, resource, login) triple that is reachable.
+type MatrixRow struct {
+	UserID       int64   `json:"user_id"`
+	Email        string  `json:"email"`
+	ResourceID   int64   `json:"resource_id"`
+	ResourceName string  `json:"resource_name"`
+	Host         string  `json:"host"`
+	Login        string  `json:"login"`
+	Grants       []Grant `json:"grants"`
+}
+
+// Evaluator holds a snapshot of an organization's roles, rules, grants and
+// resources so many users can be evaluated without re-querying.
+type Evaluator struct {
+	roles     map[int64]models.Role
+	rolePerms map[int64][]string
+	userRoles map[int64][]int64
+	access    map[int64][]models.UserResourceAccess
+	rules     []models.AccessRule
+	resources []models.Resource
+}
+
+// NewEvaluator loads everything needed to compute effective access in orgID.
+func NewEvaluator(db *gorm.DB, orgID uint64) (*Evaluator, error) {
+	ev := &Evaluator{
+		roles:     map[int64]models.Role{},
+		rolePerms: map[int64][]string{},
+		userRoles: map[int64][]int64{},
+		access:    map[int64][]models.UserResourceAccess{},
+	}
+
+	var roles []models.Role
+	if err := db.Where("org_id = ?", orgID).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range roles {
+		ev.roles[r.ID] = r
+	}
+
+	var perms []struct {
+		RoleID  int64
+		PermKey string
+	}
+	if err := db.Table("role_permissions rp").
+		Select("rp.role_id AS role_id, p.`key` AS perm_key").
+		Joins("JOIN roles r ON r.id = rp.role_id AND r.org_id = ?", orgID).
+		Joins("JOIN permissions p ON p.id = rp.permission_id").
+		Scan(&perms).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range perms {
+		ev.rolePerms[p.RoleID] = append(ev.rolePerms[p.RoleID], p.PermKey)
+	}
+
+	var userRoles []models.UserRole
+	if err := db.Where("org_id = ?", orgID).Find(&userRoles).Error; err != nil {
+		return nil, err
+	}
+	for _, ur := range userRoles {
+		ev.userRoles[ur.UserID] = append(ev.userRoles[ur.UserID], ur.RoleID)
+	}
+
+	var access []models.UserResourceAccess
+	if err := db.Where("org_id = ?", orgID).Find(&access).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range access {
+		ev.access[a.UserID] = append(ev.access[a.UserID], a)
+	}
+
+	if err := db.Preload("Permission").Where("org_id = ?", orgID).Find(&ev.rules).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("org_id = ?", orgID).Order("id").Find(&ev.resources).Error; err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// Explain computes the permissions and resource logins held by user and the
+// role, rule or grant that produced each of them.
+func (ev *Evaluator) Explain(user models.User) Explanation {
+	exp := Explanation{
+		UserID:      user.ID,
+		Email:       user.Email,
+		Name:        user.Name,
+		Status:      user.Status,
+		Roles:       []RoleRef{},
+		Permissions: []PermissionGrant{},
+		Resources:   []ResourceAccess{},
+	}
+
+	var roleIDs []int64
+	for _, id := range ev.userRoles[user.ID] {
+		if r, ok := ev.roles[id]; ok {
+			roleIDs = append(roleIDs, id)
+			exp.Roles = append(exp.Roles, RoleRef{ID: r.ID, Name: r.Name, Slug: r.Slug})
+		}
+	}
+
+	// Permissions granted through role_permissions
+	permGrants := map[string][]Grant{}
+	globalConnect := []Grant{}
+	for _, id := range roleIDs {
+		r := ev.roles[id]
+		for _, key := range ev.rolePerms[id] {
+			g := Grant{Source: "role", RoleID: r.ID, RoleName: r.Name}
+			permGrants[key] = append(permGrants[key], g)
+			if key == ConnectPermission {
+				g.Detail = "role grants " + ConnectPermission + " on every resource"
+				globalConnect = append(globalConnect, g)
+			}
+		}
+	}
+	keys := make([]string, 0, len(permGrants))
+	for k := range permGrants {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		exp.Permissions = append(exp.Permissions, PermissionGrant{Key: k, Grants: permGrants[k]})
+	}
+
+	logins := ConnectLogins(user)
+	for _, res := range ev.resources {
+		byLogin := map[string][]Grant{}
+		add := func(login string, g Grant) {
+			if login == "" {
+				return
+			}
+			byLogin[login] = append(byLogin[login], g)
+		}
+
+		for _, a := range ev.access[user.ID] {
+			if int64(a.ResourceID) != res.ID {
+				continue
+			}
+			g := Grant{Source: "user_resource_access", RuleID: a.ID}
+			if a.ConnectUser != "" {
+				add(a.ConnectUser, g)
+				continue
+			}
+			for _, l := range logins {
+				add(l, g)
+			}
+		}
+
+		for _, g := range globalConnect {
+			for _, l := range logins {
+				add(l, g)
+			}
+		}
+
+		labels := res.Labels()
+		for _, rule := range ev.rules {
+			if rule.Permission == nil || rule.Permission.Key != ConnectPermission {
+				continue
+			}
+			if rule.ResourceID != 0 && int64(rule.ResourceID) != res.ID {
+				continue
+			}
+			if !containsID(roleIDs, int64(rule.RoleID)) {
+				continue
+			}
+			if !MatchLabels(rule.ConstraintExpr, labels) {
+				continue
+			}
+			r := ev.roles[int64(rule.RoleID)]
+			g := Grant{Source: "access_rule", RoleID: r.ID, RoleName: r.Name, RuleID: rule.ID, Detail: rule.ConstraintExpr}
+			for _, l := range logins {
+				add(l, g)
+			}
+		}
+
+		if len(byLogin) == 0 {
+			continue
+		}
+		ra := ResourceAccess{ResourceID: res.ID, ResourceName: res.Name, Host: res.Host}
+		names := make([]string, 0, len(byLogin))
+		for l := range byLogin {
+			names = append(names, l)
+		}
+		sort.Strings(names)
+		for _, l := range names {
+			ra.Logins = append(ra.Logins, LoginGrant{Login: l, Grants: byLogin[l]})
+		}
+		exp.Resources = append(exp.Resources, ra)
+	}
+
+	return exp
+}
+
+// Allowed reports whether user may log into resourceID as login, together
+// with the grants that allow it. Suspended users are never allowed.
+func (ev *Evaluator) Allowed(user models.User, resourceID int64, login string) (bool, []Grant) {
+	if user.Status != models.UserActive {
+		return false, nil
+	}
+	for _, ra := range ev.Explain(user).Resources {
+		if ra.ResourceID != resourceID {
+			continue
+		}
+		for _, lg := range ra.Logins {
+			if lg.Login == login {
+				return true, lg.Grants
+			}
+		}
+	}
+	return false, nil
+}
+
+// Matrix flattens the reachable logins of every active user into rows.
+func (ev *Evaluator) Matrix(users []models.User) []MatrixRow {
+	rows := []MatrixRow{}
+	for _, u := range users {
+		if u.Status != models.UserActive {
+			continue
+		}
+		for _, ra := range ev.Explain(u).Resources {
+			for _, lg := range ra.Logins {
+				rows = append(rows, MatrixRow{
+					UserID:       u.ID,
+					Email:        u.Email,
+					ResourceID:   ra.ResourceID,
+					ResourceName: ra.ResourceName,
+					Host:         ra.Host,
+					Login:        lg.Login,
+					Grants:       lg.Grants,
+				})
+			}
+		}
+	}
+	return rows
+}
+
+// ConnectLogins splits the user's comma separated connect_user field.
+func ConnectLogins(user models.User) []string {
+	var out []string
+	for _, l := range strings.Split(user.ConnectUser, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// MatchLabels evaluates a selector such as "env=prod,team=db" against
+// labels. An empty selector matches everything and a value of "*" only
+// requires the key to be present.
+func MatchLabels(selector string, labels map[string]string) bool {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return true
+	}
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return false
+		}
+		key, want := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		got, ok := labels[key]
+		if !ok || (want != "*" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
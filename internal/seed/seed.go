@@ -48,6 +48,14 @@ func FirstSetup(db *gorm.DB) error {
 		{Key: "resources:generate-token", Description: "Generate registration tokens", Resource: "resources", Action: "generate-token"},
 		{Key: "resources:write", Description: "Manage resources", Resource: "resources", Action: "write"},
 		{Key: "audit:read", Description: "View audit logs", Resource: "audit", Action: "read"},
+		{Key: "access:read", Description: "Simulate effective access", Resource: "access", Action: "read"},
+		{Key: "reviews:read", Description: "View access review campaigns", Resource: "reviews", Action: "read"},
+		{Key: "reviews:write", Description: "Manage access review campaigns", Resource: "reviews", Action: "write"},
+		{Key: "sessions:read", Description: "View live and past SSH sessions", Resource: "sessions", Action: "read"},
+		{Key: "sessions:write", Description: "Terminate SSH sessions", Resource: "sessions", Action: "write"},
+		{Key: "sessions:join", Description: "Join or observe another user's SSH session", Resource: "sessions", Action: "join"},
+		{Key: "locks:read", Description: "View locks", Resource: "locks", Action: "read"},
+		{Key: "locks:write", Description: "Lock users, roles, resources and logins", Resource: "locks", Action: "write"},
 	}
 
 	permIDs := map[string]uint64{}
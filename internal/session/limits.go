@@ -0,0 +1,66 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// limitCheckInterval is how often idle and TTL limits are checked.
+var limitCheckInterval = 5 * time.Second
+
+func (s *Session) touch() { s.lastActivity.Store(time.Now().UnixNano()) }
+
+// LastActivity returns the time of the last terminal input or output.
+func (s *Session) LastActivity() time.Time {
+	return time.Unix(0, s.lastActivity.Load())
+}
+
+// warnBefore is how long before a limit the parties are warned: one
+// minute, or half the limit for very short limits.
+func warnBefore(limit time.Duration) time.Duration {
+	if limit < 2*time.Minute {
+		return limit / 2
+	}
+	return time.Minute
+}
+
+// enforceLimits terminates the session once it has been idle for idle or
+// has run for ttl, warning the parties shortly before. A zero limit is
+// not enforced.
+func (s *Session) enforceLimits(idle, ttl time.Duration) {
+	ticker := time.NewTicker(limitCheckInterval)
+	defer ticker.Stop()
+
+	var idleWarned, ttlWarned bool
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			if ttl > 0 {
+				left := s.StartedAt.Add(ttl).Sub(now)
+				if left <= 0 {
+					s.Terminate(ReasonMaxTTL)
+					return
+				}
+				if !ttlWarned && left <= warnBefore(ttl) {
+					ttlWarned = true
+					s.Notify(fmt.Sprintf("⚠ session reaches its maximum duration in %s", left.Round(time.Second)))
+				}
+			}
+			if idle > 0 {
+				left := s.LastActivity().Add(idle).Sub(now)
+				if left <= 0 {
+					s.Terminate(ReasonIdleTimeout)
+					return
+				}
+				if left > warnBefore(idle) {
+					idleWarned = false
+				} else if !idleWarned {
+					idleWarned = true
+					s.Notify(fmt.Sprintf("⚠ idle session will be disconnected in %s", left.Round(time.Second)))
+				}
+			}
+		}
+	}
+}
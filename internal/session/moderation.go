@@ -0,0 +1,146 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+
+	"teleport_lite/internal/models"
+)
+
+// SetPolicy applies pol to the session. If pol requires moderators the
+// session becomes pending until they join; idle and TTL limits are
+// enforced from now on.
+func (s *Session) SetPolicy(pol Policy) {
+	s.mu.Lock()
+	s.policy = pol
+	if len(pol.Moderators) > 0 && s.state == StateRunning {
+		s.state = StatePending
+		s.ready = make(chan struct{})
+	}
+	s.mu.Unlock()
+	s.checkModerators()
+	if pol.IdleTimeout > 0 || pol.MaxTTL > 0 {
+		go s.enforceLimits(pol.IdleTimeout, pol.MaxTTL)
+	}
+}
+
+// Moderated reports whether the session requires moderators.
+func (s *Session) Moderated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.policy.Moderators) > 0
+}
+
+// Ready is closed once the moderators required to start the session have
+// joined. It is already closed for unmoderated sessions.
+func (s *Session) Ready() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready
+}
+
+// CanModerate reports whether a user holding roleIDs satisfies at least one
+// moderator requirement of the session.
+func (s *Session) CanModerate(roleIDs []int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, req := range s.policy.Moderators {
+		if hasRole(roleIDs, req.RoleID) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsModerator reports whether userID is attached as a moderator.
+func (s *Session) IsModerator(userID int64) bool {
+	for _, p := range s.parties.list() {
+		if p.Mode == ModeModerator && p.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// ModeratorsWanted describes the outstanding moderator requirements, e.g.
+// "1 more Security". It returns "" when all are met.
+func (s *Session) ModeratorsWanted() string {
+	s.mu.Lock()
+	reqs := s.policy.Moderators
+	s.mu.Unlock()
+
+	var missing []string
+	for _, req := range reqs {
+		if n := req.Count - s.countModerators(req.RoleID); n > 0 {
+			missing = append(missing, fmt.Sprintf("%d more %s", n, req.RoleName))
+		}
+	}
+	return strings.Join(missing, ", ")
+}
+
+func (s *Session) countModerators(roleID int64) int {
+	users := map[int64]struct{}{}
+	for _, p := range s.parties.list() {
+		if p.Mode == ModeModerator && p.UserID != s.UserID && hasRole(p.RoleIDs, roleID) {
+			users[p.UserID] = struct{}{}
+		}
+	}
+	return len(users)
+}
+
+// checkModerators moves the session between pending, running and paused
+// as moderators come and go. Each transition is re-checked and applied
+// under s.mu, so concurrent joins can't start the session twice.
+func (s *Session) checkModerators() {
+	s.mu.Lock()
+	if len(s.policy.Moderators) == 0 || s.terminated {
+		s.mu.Unlock()
+		return
+	}
+	onLeave := s.policy.OnModeratorLeave
+	s.mu.Unlock()
+
+	satisfied := s.ModeratorsWanted() == ""
+
+	s.mu.Lock()
+	from := s.state
+	switch {
+	case s.terminated:
+		s.mu.Unlock()
+		return
+	case satisfied && from == StatePending:
+		s.state = StateRunning
+		close(s.ready)
+	case satisfied && from == StatePaused:
+		s.state = StateRunning
+	case !satisfied && from == StateRunning && onLeave != models.ModeratorLeaveTerminate:
+		s.state = StatePaused
+	case !satisfied && from == StateRunning:
+		// terminated below
+	default:
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	switch {
+	case satisfied && from == StatePending:
+		s.touch()
+		s.Notify("moderators present, starting session")
+	case satisfied:
+		s.Notify("moderators present, session resumed")
+	case onLeave == models.ModeratorLeaveTerminate:
+		go s.Terminate("moderator left")
+	default:
+		s.Notify("session paused: waiting for " + s.ModeratorsWanted())
+	}
+}
+
+func hasRole(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
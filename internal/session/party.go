@@ -0,0 +1,109 @@
+package session
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Party modes. The owner started the session; peers may type into it,
+// observers only watch and moderators watch and may terminate it.
+const (
+	ModeOwner     = "owner"
+	ModePeer      = "peer"
+	ModeObserver  = "observer"
+	ModeModerator = "moderator"
+)
+
+// ErrReadOnly is returned when an observer tries to send input.
+var ErrReadOnly = errors.New("session: party is read-only")
+
+// Conn is the client side of a party, usually a WebSocket.
+type Conn interface {
+	io.Writer                             // terminal output
+	Notify(msg string) error              // human readable status line
+	Exit(status int, signal string) error // remote command finished
+	Close() error
+}
+
+// Party is a client attached to a session.
+type Party struct {
+	ID       string    `json:"id"`
+	UserID   int64     `json:"user_id"`
+	Email    string    `json:"email"`
+	Mode     string    `json:"mode"`
+	RoleIDs  []int64   `json:"-"`
+	JoinedAt time.Time `json:"joined_at"`
+
+	conn Conn
+}
+
+// NewParty creates a party for conn. Attach it with Session.AddParty.
+func NewParty(userID int64, email, mode string, conn Conn) *Party {
+	return &Party{
+		ID:       newID(),
+		UserID:   userID,
+		Email:    email,
+		Mode:     mode,
+		JoinedAt: time.Now(),
+		conn:     conn,
+	}
+}
+
+// CanInput reports whether the party may type into the session.
+func (p *Party) CanInput() bool {
+	return p.Mode == ModeOwner || p.Mode == ModePeer
+}
+
+// Notify sends a status line to this party only.
+func (p *Party) Notify(msg string) error {
+	return p.conn.Notify(msg)
+}
+
+// partySet is the set of clients attached to a session.
+type partySet struct {
+	mu      sync.RWMutex
+	parties map[string]*Party
+}
+
+func (ps *partySet) add(p *Party) {
+	ps.mu.Lock()
+	if ps.parties == nil {
+		ps.parties = map[string]*Party{}
+	}
+	ps.parties[p.ID] = p
+	ps.mu.Unlock()
+}
+
+func (ps *partySet) remove(id string) {
+	ps.mu.Lock()
+	delete(ps.parties, id)
+	ps.mu.Unlock()
+}
+
+func (ps *partySet) list() []*Party {
+	ps.mu.RLock()
+	out := make([]*Party, 0, len(ps.parties))
+	for _, p := range ps.parties {
+		out = append(out, p)
+	}
+	ps.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].JoinedAt.Before(out[j].JoinedAt) })
+	return out
+}
+
+// broadcaster fans terminal output out to every party. A party whose
+// connection fails is dropped rather than stalling the others.
+type broadcaster struct{ ps *partySet }
+
+func (b broadcaster) Write(p []byte) (int, error) {
+	for _, party := range b.ps.list() {
+		if _, err := party.conn.Write(p); err != nil {
+			b.ps.remove(party.ID)
+			_ = party.conn.Close()
+		}
+	}
+	return len(p), nil
+}
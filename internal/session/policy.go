@@ -0,0 +1,115 @@
+package session
+
+import (
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+)
+
+// ModeratorRequirement asks for Count moderators holding RoleID.
+type ModeratorRequirement struct {
+	RoleID   int64  `json:"role_id"`
+	RoleName string `json:"role_name"`
+	Count    int    `json:"count"`
+}
+
+// Policy is the merged session policy of a user's roles for one resource.
+type Policy struct {
+	Moderators       []ModeratorRequirement `json:"moderators"`
+	OnModeratorLeave string                 `json:"on_moderator_leave"`
+	IdleTimeout      time.Duration          `json:"idle_timeout"`
+	MaxTTL           time.Duration          `json:"max_ttl"`
+	AllowedForwards  []string               `json:"allowed_forwards"`
+}
+
+// LoadPolicy merges the RolePolicy rows of roleIDs that apply to res. The
+// strictest setting wins: the highest moderator count per moderator role,
+// "terminate" over "pause" and the shortest idle timeout and TTL. Allowed
+// forward destinations are grants, so those of all roles are combined.
+// Session limits apply to every resource; ModeratedLabels only scopes the
+// moderator requirement.
+func LoadPolicy(db *gorm.DB, roleIDs []int64, res models.Resource) (Policy, error) {
+	pol := Policy{OnModeratorLeave: models.ModeratorLeavePause}
+	if len(roleIDs) == 0 {
+		return pol, nil
+	}
+
+	var rows []models.RolePolicy
+	if err := db.Where("role_id IN ?", roleIDs).Find(&rows).Error; err != nil {
+		return pol, err
+	}
+
+	labels := res.Labels()
+	counts := map[int64]int{}
+	var order []int64
+	for _, p := range rows {
+		pol.IdleTimeout = shortest(pol.IdleTimeout, time.Duration(p.IdleTimeoutMinutes)*time.Minute)
+		pol.MaxTTL = shortest(pol.MaxTTL, time.Duration(p.MaxSessionTTLMinutes)*time.Minute)
+		for _, dest := range strings.Split(p.AllowedForwards, ",") {
+			if dest = strings.TrimSpace(dest); dest != "" {
+				pol.AllowedForwards = append(pol.AllowedForwards, dest)
+			}
+		}
+
+		if p.RequiredModerators <= 0 || p.ModeratorRoleID == 0 || !rbac.MatchLabels(p.ModeratedLabels, labels) {
+			continue
+		}
+		if _, seen := counts[p.ModeratorRoleID]; !seen {
+			order = append(order, p.ModeratorRoleID)
+		}
+		if p.RequiredModerators > counts[p.ModeratorRoleID] {
+			counts[p.ModeratorRoleID] = p.RequiredModerators
+		}
+		if p.OnModeratorLeave == models.ModeratorLeaveTerminate {
+			pol.OnModeratorLeave = models.ModeratorLeaveTerminate
+		}
+	}
+
+	if len(order) == 0 {
+		return pol, nil
+	}
+	var roles []models.Role
+	if err := db.Where("id IN ?", order).Find(&roles).Error; err != nil {
+		return pol, err
+	}
+	names := map[int64]string{}
+	for _, r := range roles {
+		names[r.ID] = r.Name
+	}
+	for _, id := range order {
+		pol.Moderators = append(pol.Moderators, ModeratorRequirement{RoleID: id, RoleName: names[id], Count: counts[id]})
+	}
+	return pol, nil
+}
+
+// shortest returns the smaller of two limits where 0 means unlimited.
+func shortest(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// AllowsForward reports whether host:port matches one of the policy's
+// allowed forward destinations.
+func (p Policy) AllowsForward(host string, port int) bool {
+	for _, pattern := range p.AllowedForwards {
+		h, pt, err := net.SplitHostPort(pattern)
+		if err != nil {
+			continue
+		}
+		hostOK, _ := path.Match(strings.ToLower(h), strings.ToLower(host))
+		portOK, _ := path.Match(pt, strconv.Itoa(port))
+		if hostOK && portOK {
+			return true
+		}
+	}
+	return false
+}
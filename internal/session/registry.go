@@ -0,0 +1,151 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+)
+
+// flushInterval controls how often byte counters of live sessions are
+// written to the database.
+const flushInterval = 30 * time.Second
+
+// Registry tracks the sessions currently running on this controller and
+// mirrors them into the sessions table when a database is configured.
+type Registry struct {
+	db       *gorm.DB
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewRegistry creates a registry backed by db (which may be nil). Rows left
+// "active" by a previous controller process are closed, since their
+// sessions died with it.
+func NewRegistry(db *gorm.DB) *Registry {
+	r := &Registry{db: db, sessions: map[string]*Session{}}
+	if db != nil {
+		now := time.Now()
+		if err := db.Model(&models.Session{}).
+			Where("status = ?", models.SessionActive).
+			Updates(map[string]interface{}{
+				"status":     models.SessionEnded,
+				"end_reason": "controller_restart",
+				"ended_at":   now,
+			}).Error; err != nil {
+			log.Printf("⚠️ failed to close stale sessions: %v", err)
+		}
+		go r.flushLoop()
+	}
+	return r
+}
+
+func (r *Registry) Add(s *Session) {
+	r.mu.Lock()
+	r.sessions[s.ID] = s
+	r.mu.Unlock()
+
+	if r.db == nil {
+		return
+	}
+	row := models.Session{
+		ID:           s.ID,
+		OrgID:        s.OrgID,
+		UserID:       s.UserID,
+		UserEmail:    s.UserEmail,
+		ResourceID:   s.ResourceID,
+		ResourceName: s.ResourceName,
+		Host:         s.Host,
+		Login:        s.Login,
+		ClientIP:     s.ClientIP,
+		Status:       models.SessionActive,
+		StartedAt:    s.StartedAt,
+	}
+	if err := r.db.Create(&row).Error; err != nil {
+		log.Printf("⚠️ failed to record session %s: %v", s.ID, err)
+	}
+}
+
+// Remove stops tracking the session and records its end.
+func (r *Registry) Remove(id string) {
+	r.mu.Lock()
+	s, ok := r.sessions[id]
+	delete(r.sessions, id)
+	r.mu.Unlock()
+
+	if !ok || r.db == nil {
+		return
+	}
+	reason := s.Reason()
+	if reason == "" {
+		reason = "client_closed"
+	}
+	if err := r.db.Model(&models.Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     models.SessionEnded,
+		"end_reason": reason,
+		"ended_at":   time.Now(),
+		"bytes_in":   s.BytesIn(),
+		"bytes_out":  s.BytesOut(),
+	}).Error; err != nil {
+		log.Printf("⚠️ failed to close session %s: %v", id, err)
+	}
+}
+
+func (r *Registry) Get(id string) (*Session, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.sessions[id]
+	return s, ok
+}
+
+// List returns the tracked sessions ordered by start time.
+func (r *Registry) List() []*Session {
+	r.mu.RLock()
+	out := make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		out = append(out, s)
+	}
+	r.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+// TerminateMatching terminates every session for which match returns true
+// and reports how many were terminated.
+func (r *Registry) TerminateMatching(match func(*Session) bool, reason string) int {
+	n := 0
+	for _, s := range r.List() {
+		if match(s) {
+			s.Terminate(reason)
+			n++
+		}
+	}
+	return n
+}
+
+// flushLoop periodically persists byte counters of live sessions.
+func (r *Registry) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, s := range r.List() {
+			_ = r.db.Model(&models.Session{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+				"bytes_in":  s.BytesIn(),
+				"bytes_out": s.BytesOut(),
+			}).Error
+		}
+	}
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
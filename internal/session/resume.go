@@ -0,0 +1,185 @@
+package session
+
+import (
+	"crypto/subtle"
+	"errors"
+	"sync"
+	"time"
+)
+
+// resumeBufferSize is how much recent output is kept for clients that
+// reconnect after a network blip.
+const resumeBufferSize = 256 << 10
+
+// Errors returned by Resume.
+var (
+	ErrNotResumable = errors.New("session: not resumable")
+	ErrResumeDenied = errors.New("session: resume token or user mismatch")
+)
+
+// ring is a fixed-size buffer of the most recent output. total counts
+// every byte ever written, so clients can say how much they have seen.
+type ring struct {
+	buf   []byte
+	total int64
+}
+
+func (r *ring) Write(p []byte) {
+	n := int64(len(r.buf))
+	if int64(len(p)) >= n {
+		copy(r.buf, p[int64(len(p))-n:])
+	} else {
+		start := r.total % n
+		c := copy(r.buf[start:], p)
+		copy(r.buf, p[c:])
+	}
+	r.total += int64(len(p))
+}
+
+// since returns the output after offset and whether all of it is still
+// buffered.
+func (r *ring) since(offset int64) ([]byte, bool) {
+	n := int64(len(r.buf))
+	if offset >= r.total {
+		return nil, true
+	}
+	complete := true
+	if offset < 0 || r.total-offset > n {
+		offset, complete = r.total-n, false
+		if offset < 0 {
+			offset = 0
+		}
+	}
+	out := make([]byte, 0, r.total-offset)
+	for i := offset; i < r.total; i++ {
+		out = append(out, r.buf[i%n])
+	}
+	return out, complete
+}
+
+// resumeState is kept for sessions whose owner may reconnect.
+type resumeState struct {
+	mu    sync.Mutex // also serializes output with replays
+	token string
+	ring  ring
+	timer *time.Timer
+}
+
+// output writes to the ring buffer and fans out to the parties under one
+// lock, so a replay never interleaves with live output.
+type resumeOutput struct {
+	rs *resumeState
+	w  broadcaster
+}
+
+func (o resumeOutput) Write(p []byte) (int, error) {
+	o.rs.mu.Lock()
+	defer o.rs.mu.Unlock()
+	o.rs.ring.Write(p)
+	return o.w.Write(p)
+}
+
+// EnableResume keeps recent output so the owner can reattach after a
+// dropped connection. It returns the resume token, which only works for
+// the session's own user. Call it before output starts.
+func (s *Session) EnableResume() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resume == nil {
+		s.resume = &resumeState{token: newID(), ring: ring{buf: make([]byte, resumeBufferSize)}}
+	}
+	return s.resume.token
+}
+
+// Resumable reports whether EnableResume was called.
+func (s *Session) Resumable() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resume != nil
+}
+
+// Detach removes the owner's party after its connection dropped and ends
+// the session unless the owner resumes within grace. If another owner
+// connection is already attached nothing is scheduled.
+func (s *Session) Detach(partyID string, grace time.Duration) {
+	s.RemoveParty(partyID)
+
+	s.mu.Lock()
+	rs, done := s.resume, s.terminated
+	s.mu.Unlock()
+	if rs == nil {
+		s.Terminate("client_closed")
+		return
+	}
+	if done || s.ownerAttached() {
+		return
+	}
+
+	rs.mu.Lock()
+	if rs.timer != nil {
+		rs.timer.Stop()
+	}
+	rs.timer = time.AfterFunc(grace, func() {
+		if !s.ownerAttached() {
+			s.Terminate("client_disconnected")
+		}
+	})
+	rs.mu.Unlock()
+	s.Notify("owner disconnected, waiting " + grace.String() + " for them to reconnect")
+}
+
+// Resume attaches p as the owner again and replays the output after
+// offset, the number of output bytes the client already received. The
+// token must match and userID must be the session's user. Any previous
+// owner connection is closed.
+func (s *Session) Resume(userID int64, token string, p *Party, offset int64) error {
+	s.mu.Lock()
+	rs, done := s.resume, s.terminated
+	s.mu.Unlock()
+	if rs == nil || done {
+		return ErrNotResumable
+	}
+	if userID != s.UserID || subtle.ConstantTimeCompare([]byte(token), []byte(rs.token)) != 1 {
+		return ErrResumeDenied
+	}
+
+	p.Mode = ModeOwner
+	var stale []*Party
+	for _, old := range s.parties.list() {
+		if old.Mode == ModeOwner {
+			stale = append(stale, old)
+		}
+	}
+
+	rs.mu.Lock()
+	if rs.timer != nil {
+		rs.timer.Stop()
+		rs.timer = nil
+	}
+	missed, complete := rs.ring.since(offset)
+	if !complete {
+		_ = p.conn.Notify("some output was lost while disconnected")
+	}
+	if len(missed) > 0 {
+		_, _ = p.conn.Write(missed)
+	}
+	s.parties.add(p)
+	rs.mu.Unlock()
+
+	for _, old := range stale {
+		s.parties.remove(old.ID)
+		_ = old.conn.Close()
+	}
+	s.checkModerators()
+	s.Notify(p.Email + " reconnected")
+	return nil
+}
+
+func (s *Session) ownerAttached() bool {
+	for _, p := range s.parties.list() {
+		if p.Mode == ModeOwner {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,336 @@
+package session
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session states. A moderated session stays pending until its moderators
+// have joined and is paused while they are missing.
+const (
+	StatePending = "pending"
+	StateRunning = "running"
+	StatePaused  = "paused"
+)
+
+// End reasons set by the session itself. Others are free text, such as
+// "locked: ..." or "terminated by ...".
+const (
+	ReasonExit        = "exit"         // remote command finished
+	ReasonIdleTimeout = "idle_timeout" // role policy idle timeout
+	ReasonMaxTTL      = "max_ttl"      // role policy maximum duration
+)
+
+// ErrNotRunning is returned when input arrives while the session is
+// pending or paused.
+var ErrNotRunning = errors.New("session: not running")
+
+// ErrNotOwner is returned when a party other than the owner resizes the
+// terminal.
+var ErrNotOwner = errors.New("session: only the owner may resize")
+
+// Terminal is the remote PTY of a session.
+type Terminal interface {
+	Resize(cols, rows int) error
+	Signal(name string) error
+}
+
+// Session is a live SSH session proxied by the controller.
+type Session struct {
+	ID           string
+	OrgID        int64
+	UserID       int64
+	UserEmail    string
+	RoleIDs      []int64
+	ResourceID   int64
+	ResourceName string
+	Host         string
+	Login        string
+	ClientIP     string
+	StartedAt    time.Time
+
+	bytesIn      atomic.Int64
+	bytesOut     atomic.Int64
+	lastActivity atomic.Int64 // unix nanoseconds
+	parties      partySet
+	done         chan struct{}
+
+	mu         sync.Mutex
+	state      string
+	policy     Policy
+	ready      chan struct{}
+	input      io.Writer
+	terminal   Terminal
+	resume     *resumeState
+	closers    []io.Closer
+	terminated bool
+	reason     string
+}
+
+// Info is the JSON view of a live session.
+type Info struct {
+	ID           string                 `json:"id"`
+	OrgID        int64                  `json:"org_id"`
+	UserID       int64                  `json:"user_id"`
+	UserEmail    string                 `json:"user_email"`
+	ResourceID   int64                  `json:"resource_id"`
+	ResourceName string                 `json:"resource_name"`
+	Host         string                 `json:"host"`
+	Login        string                 `json:"login"`
+	ClientIP     string                 `json:"client_ip"`
+	StartedAt    time.Time              `json:"started_at"`
+	State        string                 `json:"state"`
+	LastActivity time.Time              `json:"last_activity"`
+	ExpiresAt    *time.Time             `json:"expires_at,omitempty"`
+	Moderators   []ModeratorRequirement `json:"moderators,omitempty"`
+	BytesIn      int64                  `json:"bytes_in"`
+	BytesOut     int64                  `json:"bytes_out"`
+	Parties      []*Party               `json:"parties"`
+}
+
+// New creates a running session with a random ID. It is not tracked until
+// it is added to a Registry.
+func New(orgID, userID int64, roleIDs []int64, resourceID int64, login string) *Session {
+	ready := make(chan struct{})
+	close(ready)
+	s := &Session{
+		ID:         newID(),
+		OrgID:      orgID,
+		UserID:     userID,
+		RoleIDs:    roleIDs,
+		ResourceID: resourceID,
+		Login:      login,
+		StartedAt:  time.Now(),
+		state:      StateRunning,
+		ready:      ready,
+		done:       make(chan struct{}),
+	}
+	s.touch()
+	return s
+}
+
+// AddCloser registers c to be closed when the session terminates. If the
+// session has already terminated c is closed immediately.
+func (s *Session) AddCloser(c io.Closer) {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		_ = c.Close()
+		return
+	}
+	s.closers = append(s.closers, c)
+	s.mu.Unlock()
+}
+
+// Terminate ends the session once: it tells every party why, closes the
+// registered closers (the SSH connection) and disconnects all parties.
+// Later calls are no-ops.
+func (s *Session) Terminate(reason string) {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		return
+	}
+	s.terminated = true
+	s.reason = reason
+	closers := s.closers
+	s.closers = nil
+	s.mu.Unlock()
+	close(s.done)
+
+	if reason != ReasonExit {
+		s.Notify("⛔ session terminated: " + reason)
+	}
+	for _, c := range closers {
+		_ = c.Close()
+	}
+	s.CloseParties()
+}
+
+// Done is closed when the session terminates.
+func (s *Session) Done() <-chan struct{} { return s.done }
+
+// Reason returns why the session was terminated, or "" if it was not.
+func (s *Session) Reason() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reason
+}
+
+// State returns the session state.
+func (s *Session) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// SetInput sets the remote stdin that party input is written to.
+func (s *Session) SetInput(w io.Writer) {
+	s.mu.Lock()
+	s.input = countingWriter{w: w, n: &s.bytesIn, touch: s.touch}
+	s.mu.Unlock()
+}
+
+// SetTerminal sets the remote PTY that resize and signal requests go to.
+func (s *Session) SetTerminal(t Terminal) {
+	s.mu.Lock()
+	s.terminal = t
+	s.mu.Unlock()
+}
+
+// Resize changes the remote window size. Only the owner's terminal size
+// counts, so a joiner with a smaller window cannot reflow the owner's.
+func (s *Session) Resize(p *Party, cols, rows int) error {
+	if p.Mode != ModeOwner {
+		return ErrNotOwner
+	}
+	s.mu.Lock()
+	t := s.terminal
+	s.mu.Unlock()
+	if t == nil {
+		return nil
+	}
+	return t.Resize(cols, rows)
+}
+
+// Signal delivers a signal such as "INT" to the remote process. Like
+// input it is refused for observers and while the session is not running.
+func (s *Session) Signal(p *Party, name string) error {
+	if !p.CanInput() {
+		return ErrReadOnly
+	}
+	s.mu.Lock()
+	t, state := s.terminal, s.state
+	s.mu.Unlock()
+	if state != StateRunning {
+		return ErrNotRunning
+	}
+	if t == nil {
+		return nil
+	}
+	return t.Signal(name)
+}
+
+// Exit reports the remote exit status to every party and ends the session.
+func (s *Session) Exit(status int, signal string) {
+	for _, p := range s.parties.list() {
+		_ = p.conn.Exit(status, signal)
+	}
+	s.Terminate(ReasonExit)
+}
+
+// WriteInput forwards data typed by p to the remote stdin. Observers are
+// refused with ErrReadOnly, and nothing is forwarded unless the session is
+// running.
+func (s *Session) WriteInput(p *Party, data []byte) error {
+	if !p.CanInput() {
+		return ErrReadOnly
+	}
+	s.mu.Lock()
+	in, state := s.input, s.state
+	s.mu.Unlock()
+	if state != StateRunning {
+		return ErrNotRunning
+	}
+	if in == nil {
+		return nil
+	}
+	_, err := in.Write(data)
+	return err
+}
+
+// Output returns the writer remote stdout/stderr should be copied to. It
+// counts bytes and fans them out to every attached party, keeping a copy
+// for resumes if enabled.
+func (s *Session) Output() io.Writer {
+	var w io.Writer = broadcaster{ps: &s.parties}
+	s.mu.Lock()
+	if s.resume != nil {
+		w = resumeOutput{rs: s.resume, w: broadcaster{ps: &s.parties}}
+	}
+	s.mu.Unlock()
+	return countingWriter{w: w, n: &s.bytesOut, touch: s.touch}
+}
+
+// AddParty attaches a client to the session.
+func (s *Session) AddParty(p *Party) {
+	s.parties.add(p)
+	s.checkModerators()
+}
+
+// RemoveParty detaches a client from the session without closing it.
+func (s *Session) RemoveParty(id string) {
+	s.parties.remove(id)
+	s.checkModerators()
+}
+
+// Parties returns the attached clients ordered by join time.
+func (s *Session) Parties() []*Party { return s.parties.list() }
+
+// Notify sends a status line to every attached party.
+func (s *Session) Notify(msg string) {
+	for _, p := range s.parties.list() {
+		_ = p.conn.Notify(msg)
+	}
+}
+
+// CloseParties closes every attached client connection.
+func (s *Session) CloseParties() {
+	for _, p := range s.parties.list() {
+		s.parties.remove(p.ID)
+		_ = p.conn.Close()
+	}
+}
+
+func (s *Session) BytesIn() int64  { return s.bytesIn.Load() }
+func (s *Session) BytesOut() int64 { return s.bytesOut.Load() }
+
+func (s *Session) Info() Info {
+	s.mu.Lock()
+	state, mods, ttl := s.state, s.policy.Moderators, s.policy.MaxTTL
+	s.mu.Unlock()
+	var expires *time.Time
+	if ttl > 0 {
+		t := s.StartedAt.Add(ttl)
+		expires = &t
+	}
+	return Info{
+		ID:           s.ID,
+		OrgID:        s.OrgID,
+		UserID:       s.UserID,
+		UserEmail:    s.UserEmail,
+		ResourceID:   s.ResourceID,
+		ResourceName: s.ResourceName,
+		Host:         s.Host,
+		Login:        s.Login,
+		ClientIP:     s.ClientIP,
+		StartedAt:    s.StartedAt,
+		State:        state,
+		LastActivity: s.LastActivity(),
+		ExpiresAt:    expires,
+		Moderators:   mods,
+		BytesIn:      s.BytesIn(),
+		BytesOut:     s.BytesOut(),
+		Parties:      s.Parties(),
+	}
+}
+
+// countingWriter counts the bytes written through it and records the
+// activity for idle tracking.
+type countingWriter struct {
+	w     io.Writer
+	n     *atomic.Int64
+	touch func()
+}
+
+func (c countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
@@ -0,0 +1,177 @@
+// Package sshca manages the controller's SSH keys: the per-organization
+// user CA that signs short-lived user certificates, the host access CA the
+// controller logs into agentless hosts with and the SSH proxy's host key.
+// Keys are created on first use and stored in cert_authorities.
+package sshca
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/models"
+)
+
+// MaxCertTTL caps how long a user certificate is valid.
+const MaxCertTTL = 12 * time.Hour
+
+// principalPrefix marks the single principal of a user certificate, which
+// carries the user ID. Logins are authorized by RBAC, not by principals.
+const principalPrefix = "tl-user:"
+
+// Load returns the signer of the given type for orgID, creating the key
+// pair if it does not exist yet.
+func Load(db *gorm.DB, orgID int64, typ string) (ssh.Signer, error) {
+	var ca models.CertAuthority
+	err := db.Where("org_id = ? AND type = ?", orgID, typ).First(&ca).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ca, err = create(db, orgID, typ)
+		if err != nil {
+			// Another request may have created it concurrently
+			if err2 := db.Where("org_id = ? AND type = ?", orgID, typ).First(&ca).Error; err2 != nil {
+				return nil, err
+			}
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey([]byte(ca.PrivateKey))
+}
+
+func create(db *gorm.DB, orgID int64, typ string) (models.CertAuthority, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return models.CertAuthority{}, err
+	}
+	block, err := ssh.MarshalPrivateKey(priv, fmt.Sprintf("teleport_lite %s org %d", typ, orgID))
+	if err != nil {
+		return models.CertAuthority{}, err
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return models.CertAuthority{}, err
+	}
+	ca := models.CertAuthority{
+		OrgID:      orgID,
+		Type:       typ,
+		PublicKey:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))),
+		PrivateKey: string(pem.EncodeToMemory(block)),
+	}
+	return ca, db.Create(&ca).Error
+}
+
+// ProxyHostKey returns the SSH proxy's host key.
+func ProxyHostKey(db *gorm.DB) (ssh.Signer, error) {
+	return Load(db, 0, models.CAProxyHost)
+}
+
+// SignUserCert issues a user certificate for pub, valid for ttl (capped at
+// MaxCertTTL).
+func SignUserCert(db *gorm.DB, user models.User, pub ssh.PublicKey, ttl time.Duration) (*ssh.Certificate, error) {
+	if ttl <= 0 || ttl > MaxCertTTL {
+		ttl = MaxCertTTL
+	}
+	signer, err := Load(db, user.OrgID, models.CAUser)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             pub,
+		Serial:          uint64(now.UnixNano()),
+		CertType:        ssh.UserCert,
+		KeyId:           user.Email,
+		ValidPrincipals: []string{principalPrefix + strconv.FormatInt(user.ID, 10)},
+		ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(now.Add(ttl).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-pty":             "",
+				"permit-port-forwarding": "",
+			},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, signer); err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// VerifyUserCert checks that cert was issued by an organization's user CA
+// and is currently valid, and returns the organization and user it was
+// issued to.
+func VerifyUserCert(db *gorm.DB, cert *ssh.Certificate) (orgID, userID int64, err error) {
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(cert.SignatureKey)))
+	var ca models.CertAuthority
+	if err := db.Where("type = ? AND public_key = ?", models.CAUser, authorized).First(&ca).Error; err != nil {
+		return 0, 0, errors.New("certificate not signed by a known user CA")
+	}
+	if len(cert.ValidPrincipals) != 1 || !strings.HasPrefix(cert.ValidPrincipals[0], principalPrefix) {
+		return 0, 0, errors.New("certificate has no user principal")
+	}
+	checker := ssh.CertChecker{}
+	if err := checker.CheckCert(cert.ValidPrincipals[0], cert); err != nil {
+		return 0, 0, err
+	}
+	if cert.CertType != ssh.UserCert {
+		return 0, 0, errors.New("not a user certificate")
+	}
+	userID, err = strconv.ParseInt(strings.TrimPrefix(cert.ValidPrincipals[0], principalPrefix), 10, 64)
+	if err != nil {
+		return 0, 0, errors.New("invalid user principal")
+	}
+	return ca.OrgID, userID, nil
+}
+
+// accessCertTTL is how long a host access certificate is valid; one is
+// issued per connection.
+const accessCertTTL = 5 * time.Minute
+
+// HostAccessSigner returns a signer holding a fresh key and a certificate
+// from orgID's host access CA for login, for the controller to log into
+// resources that trust the CA. It doesn't check that anyone may use login;
+// the controller only reaches it through connect.Authorize.
+func HostAccessSigner(db *gorm.DB, orgID int64, login string) (ssh.Signer, error) {
+	ca, err := Load(db, orgID, models.CAHostAccess)
+	if err != nil {
+		return nil, err
+	}
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	cert := &ssh.Certificate{
+		Key:             key.PublicKey(),
+		Serial:          uint64(now.UnixNano()),
+		CertType:        ssh.UserCert,
+		KeyId:           "teleport_lite controller",
+		ValidPrincipals: []string{login},
+		ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+		ValidBefore:     uint64(now.Add(accessCertTTL).Unix()),
+		Permissions: ssh.Permissions{
+			Extensions: map[string]string{
+				"permit-pty":             "",
+				"permit-port-forwarding": "",
+			},
+		},
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		return nil, err
+	}
+	return ssh.NewCertSigner(cert, key)
+}
@@ -0,0 +1,253 @@
+// Package sshproxy is the controller's OpenSSH-compatible proxy. Users
+// jump through it with `ssh -J` or a ProxyCommand using `-W`; the proxy
+// terminates SSH on both hops so sessions are authorized, tracked in the
+// session registry and audited exactly like web terminals, then forwards
+// them to the resource with the controller's credentials.
+package sshproxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"teleport_lite/internal/auth"
+	"teleport_lite/internal/locks"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+	"teleport_lite/internal/session"
+	"teleport_lite/internal/sshca"
+)
+
+// Permission extensions set during authentication.
+const (
+	extUserID = "tl-user-id"
+	extOrgID  = "tl-org-id"
+	extMethod = "tl-auth-method"
+)
+
+// Server accepts SSH connections from users.
+type Server struct {
+	db      *gorm.DB
+	reg     *session.Registry
+	hostKey ssh.Signer
+}
+
+// New loads (or creates) the proxy host key.
+func New(db *gorm.DB, reg *session.Registry) (*Server, error) {
+	hostKey, err := sshca.ProxyHostKey(db)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{db: db, reg: reg, hostKey: hostKey}, nil
+}
+
+// ListenAndServe accepts connections on addr until the listener fails.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("🔐 SSH proxy listening on %s", addr)
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveUser(nc)
+	}
+}
+
+// identity is the authenticated user of a connection.
+type identity struct {
+	user   models.User
+	method string
+}
+
+// config builds the server config. For the inner hop target is the
+// resource being reached and the SSH user name is the login, which must be
+// authorized; outerUserID ties the inner hop to the outer one.
+func (s *Server) config(target *models.Resource, outerUserID int64) *ssh.ServerConfig {
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			cert, ok := key.(*ssh.Certificate)
+			if !ok {
+				return nil, errors.New("only certificates issued by the controller are accepted")
+			}
+			orgID, userID, err := sshca.VerifyUserCert(s.db, cert)
+			if err != nil {
+				return nil, err
+			}
+			return s.authorize(meta, orgID, userID, "certificate", target, outerUserID)
+		},
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			key, err := auth.LookupAPIKey(s.db, string(password))
+			if err != nil {
+				return nil, err
+			}
+			return s.authorize(meta, key.OrgID, key.UserID, "api_key", target, outerUserID)
+		},
+		ServerVersion: "SSH-2.0-TeleportLiteProxy",
+	}
+	cfg.AddHostKey(s.hostKey)
+	return cfg
+}
+
+// authorize applies the same checks as the web terminal: an active,
+// unlocked user and, on the inner hop, an allowed and unlocked login.
+func (s *Server) authorize(meta ssh.ConnMetadata, orgID, userID int64, method string, target *models.Resource, outerUserID int64) (*ssh.Permissions, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil || user.OrgID != orgID {
+		return nil, errors.New("unknown user")
+	}
+	if user.Status != models.UserActive {
+		return nil, errors.New("account suspended")
+	}
+	roleIDs, err := locks.RoleIDs(s.db, orgID, userID)
+	if err != nil {
+		return nil, errors.New("lock check failed")
+	}
+	if lock, err := locks.ForUser(s.db, orgID, userID, roleIDs); err != nil || lock != nil {
+		return nil, errors.New("account locked")
+	}
+
+	if target != nil {
+		if userID != outerUserID {
+			return nil, errors.New("jump and target credentials belong to different users")
+		}
+		login := meta.User()
+		ev, err := rbac.NewEvaluator(s.db, uint64(orgID))
+		if err != nil {
+			return nil, err
+		}
+		if ok, _ := ev.Allowed(user, target.ID, login); !ok {
+			s.audit(user, remoteIP(meta.RemoteAddr()), "ssh_proxy.denied", target.ID, map[string]interface{}{
+				"host": target.Host, "ssh_user": login, "reason": "login not allowed",
+			})
+			return nil, fmt.Errorf("login %s not allowed on %s", login, target.Name)
+		}
+		if msg := locks.Refusal(s.db, orgID, userID, roleIDs, target.ID, login); msg != "" {
+			return nil, errors.New(msg)
+		}
+	}
+
+	return &ssh.Permissions{Extensions: map[string]string{
+		extUserID: strconv.FormatInt(userID, 10),
+		extOrgID:  strconv.FormatInt(orgID, 10),
+		extMethod: method,
+	}}, nil
+}
+
+func (s *Server) identity(perms *ssh.Permissions) (identity, error) {
+	userID, _ := strconv.ParseInt(perms.Extensions[extUserID], 10, 64)
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return identity{}, err
+	}
+	return identity{user: user, method: perms.Extensions[extMethod]}, nil
+}
+
+// directTCPIP is the payload of a direct-tcpip channel open (RFC 4254 7.2).
+type directTCPIP struct {
+	DestHost string
+	DestPort uint32
+	OrigHost string
+	OrigPort uint32
+}
+
+// serveUser handles the outer hop: it only opens direct-tcpip channels to
+// resources, each of which is served as an inner SSH connection.
+func (s *Server) serveUser(nc net.Conn) {
+	defer nc.Close()
+	_ = nc.SetDeadline(time.Now().Add(30 * time.Second))
+	sc, chans, reqs, err := ssh.NewServerConn(nc, s.config(nil, 0))
+	if err != nil {
+		return
+	}
+	defer sc.Close()
+	_ = nc.SetDeadline(time.Time{})
+	go ssh.DiscardRequests(reqs)
+
+	id, err := s.identity(sc.Permissions)
+	if err != nil {
+		return
+	}
+
+	for nch := range chans {
+		if nch.ChannelType() != "direct-tcpip" {
+			nch.Reject(ssh.Prohibited, "this is a jump host: use ssh -J or ProxyCommand with -W")
+			continue
+		}
+		var dest directTCPIP
+		if err := ssh.Unmarshal(nch.ExtraData(), &dest); err != nil {
+			nch.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+			continue
+		}
+		res, err := s.resolve(id.user.OrgID, dest.DestHost)
+		if err != nil {
+			nch.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, chReqs, err := nch.Accept()
+		if err != nil {
+			continue
+		}
+		go ssh.DiscardRequests(chReqs)
+
+		port := strconv.Itoa(int(dest.DestPort))
+		go s.serveTarget(channelNetConn{Channel: ch, local: sc.LocalAddr(), remote: sc.RemoteAddr()}, id.user.ID, res, port)
+	}
+}
+
+// resolve finds the resource a user jumps to by name or host.
+func (s *Server) resolve(orgID int64, name string) (models.Resource, error) {
+	var res models.Resource
+	err := s.db.Where("org_id = ? AND (name = ? OR host = ?)", orgID, name, name).First(&res).Error
+	if err != nil {
+		return res, errors.New("unknown resource " + name)
+	}
+	return res, nil
+}
+
+func (s *Server) audit(user models.User, ip, action string, resourceID int64, meta interface{}) {
+	metaJSON, _ := json.Marshal(meta)
+	_ = s.db.Create(&models.AuditLog{
+		OrgID:         user.OrgID,
+		UserID:        user.ID,
+		Action:        action,
+		ResourceType:  "SSH",
+		ResourceID:    resourceID,
+		Metadata:      datatypes.JSON(metaJSON),
+		IP:            ip,
+		UserAgent:     "ssh-proxy",
+		InitiatorName: user.Name,
+		CreatedAt:     time.Now(),
+	}).Error
+}
+
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// channelNetConn lets an SSH channel carry the inner SSH connection.
+type channelNetConn struct {
+	ssh.Channel
+	local, remote net.Addr
+}
+
+func (c channelNetConn) LocalAddr() net.Addr                { return c.local }
+func (c channelNetConn) RemoteAddr() net.Addr               { return c.remote }
+func (c channelNetConn) SetDeadline(t time.Time) error      { return nil }
+func (c channelNetConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c channelNetConn) SetWriteDeadline(t time.Time) error { return nil }
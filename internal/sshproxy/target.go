@@ -0,0 +1,375 @@
+package sshproxy
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"teleport_lite/internal/connect"
+	"teleport_lite/internal/locks"
+	"teleport_lite/internal/models"
+	"teleport_lite/internal/rbac"
+	"teleport_lite/internal/session"
+)
+
+// moderatorWait is how long a moderated session waits for its moderators.
+const moderatorWait = 15 * time.Minute
+
+// serveTarget handles the inner hop to res: the user authenticates again
+// with the login as SSH user, and every session channel is bridged to the
+// resource as a tracked session.
+func (s *Server) serveTarget(nc net.Conn, outerUserID int64, res models.Resource, port string) {
+	defer nc.Close()
+	sc, chans, reqs, err := ssh.NewServerConn(nc, s.config(&res, outerUserID))
+	if err != nil {
+		return
+	}
+	defer sc.Close()
+	go ssh.DiscardRequests(reqs)
+
+	id, err := s.identity(sc.Permissions)
+	if err != nil {
+		return
+	}
+	login := sc.User()
+
+	ev, err := rbac.NewEvaluator(s.db, uint64(res.OrgID))
+	var access connect.Access
+	if err == nil {
+		access, err = connect.Authorize(ev, id.user, res, login)
+	}
+	if err != nil {
+		for nch := range chans {
+			nch.Reject(ssh.Prohibited, "login "+login+" not allowed on "+res.Name)
+		}
+		return
+	}
+	client, err := connect.Dial(access, port)
+	if err != nil {
+		for nch := range chans {
+			nch.Reject(ssh.ConnectionFailed, "ssh dial error: "+err.Error())
+		}
+		return
+	}
+	defer client.Close()
+
+	t := &target{
+		s:        s,
+		id:       id,
+		res:      res,
+		login:    login,
+		clientIP: remoteIP(sc.RemoteAddr()),
+		client:   client,
+	}
+	var wg sync.WaitGroup
+	for nch := range chans {
+		switch nch.ChannelType() {
+		case "session":
+			wg.Add(1)
+			go func(nch ssh.NewChannel) {
+				defer wg.Done()
+				t.bridgeSession(nch)
+			}(nch)
+		case "direct-tcpip":
+			wg.Add(1)
+			go func(nch ssh.NewChannel) {
+				defer wg.Done()
+				t.bridgeForward(nch)
+			}(nch)
+		default:
+			nch.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+	wg.Wait()
+}
+
+// target is one user's inner connection to a resource.
+type target struct {
+	s        *Server
+	id       identity
+	res      models.Resource
+	login    string
+	clientIP string
+	client   *ssh.Client
+}
+
+// bridgeSession relays a session channel (shell, exec or subsystem such
+// as sftp, which scp and rsync use) to the resource. It is tracked like a
+// web terminal, so locks, moderation, limits and joining all apply.
+func (t *target) bridgeSession(nch ssh.NewChannel) {
+	user := t.id.user
+	roleIDs, err := locks.RoleIDs(t.s.db, user.OrgID, user.ID)
+	if err != nil {
+		nch.Reject(ssh.Prohibited, "session refused: lock check failed")
+		return
+	}
+	tch, treqs, err := t.client.OpenChannel("session", nil)
+	if err != nil {
+		nch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, creqs, err := nch.Accept()
+	if err != nil {
+		tch.Close()
+		return
+	}
+
+	sess := session.New(user.OrgID, user.ID, roleIDs, t.res.ID, t.login)
+	sess.UserEmail = user.Email
+	sess.ResourceName = t.res.Name
+	sess.Host = t.res.Host
+	sess.ClientIP = t.clientIP
+	owner := session.NewParty(user.ID, user.Email, session.ModeOwner, channelConn{ch})
+	owner.RoleIDs = roleIDs
+	sess.AddParty(owner)
+	sess.AddCloser(tch)
+	t.s.reg.Add(sess)
+	defer t.s.reg.Remove(sess.ID)
+
+	meta := map[string]interface{}{
+		"session_id":  sess.ID,
+		"ssh_user":    t.login,
+		"host":        t.res.Host,
+		"via":         "ssh_proxy",
+		"auth_method": t.id.method,
+	}
+	t.s.audit(user, t.clientIP, "ssh_connect", t.res.ID, meta)
+
+	if pol, err := session.LoadPolicy(t.s.db, roleIDs, t.res); err != nil {
+		sess.Terminate("policy error")
+	} else {
+		sess.SetPolicy(pol)
+	}
+	sess.SetInput(tch)
+	sess.SetTerminal(channelTerminal{tch})
+
+	// Client → resource. EOF is passed on, scp and rsync rely on it.
+	go func() {
+		_, _ = io.Copy(partyInput{sess, owner}, ch)
+		_ = tch.CloseWrite()
+	}()
+
+	// Resource → client, then the exit status once all output is through
+	var output sync.WaitGroup
+	output.Add(3)
+	go func() { defer output.Done(); io.Copy(sess.Output(), tch) }()
+	go func() { defer output.Done(); io.Copy(ch.Stderr(), tch.Stderr()) }()
+
+	var status struct {
+		sync.Mutex
+		code   int
+		signal string
+		known  bool
+	}
+	go func() {
+		defer output.Done()
+		for req := range treqs {
+			switch req.Type {
+			case "exit-status":
+				var msg struct{ Status uint32 }
+				if ssh.Unmarshal(req.Payload, &msg) == nil {
+					status.Lock()
+					status.code, status.known = int(msg.Status), true
+					status.Unlock()
+				}
+			case "exit-signal":
+				var msg struct {
+					Signal     string
+					CoreDumped bool
+					Error      string
+					Lang       string
+				}
+				if ssh.Unmarshal(req.Payload, &msg) == nil {
+					status.Lock()
+					status.code, status.signal, status.known = -1, msg.Signal, true
+					status.Unlock()
+				}
+			default:
+				ok, _ := ch.SendRequest(req.Type, req.WantReply, req.Payload)
+				if req.WantReply {
+					req.Reply(ok, nil)
+				}
+			}
+		}
+	}()
+	go func() {
+		output.Wait()
+		status.Lock()
+		code, signal, known := status.code, status.signal, status.known
+		status.Unlock()
+		if known {
+			sess.Exit(code, signal)
+		} else {
+			sess.Terminate("target closed")
+		}
+	}()
+
+	// Client requests → resource. Starting a shell, command or subsystem
+	// waits for moderators when the policy requires them.
+	go func() {
+		for req := range creqs {
+			switch req.Type {
+			case "shell", "exec", "subsystem":
+				if !waitReady(sess, owner) {
+					if req.WantReply {
+						req.Reply(false, nil)
+					}
+					continue
+				}
+			}
+			ok, _ := tch.SendRequest(req.Type, req.WantReply, req.Payload)
+			if req.WantReply {
+				req.Reply(ok, nil)
+			}
+		}
+		sess.Terminate("client_closed")
+	}()
+
+	<-sess.Done()
+
+	meta["reason"] = sess.Reason()
+	meta["bytes_in"] = strconv.FormatInt(sess.BytesIn(), 10)
+	meta["bytes_out"] = strconv.FormatInt(sess.BytesOut(), 10)
+	t.s.audit(user, t.clientIP, "ssh_disconnect", t.res.ID, meta)
+}
+
+// waitReady blocks until a moderated session may start. It reports false
+// if the session ended first.
+func waitReady(sess *session.Session, owner *session.Party) bool {
+	if !sess.Moderated() {
+		return sess.Reason() == ""
+	}
+	select {
+	case <-sess.Ready():
+		return true
+	default:
+	}
+	_ = owner.Notify("waiting for moderators: " + sess.ModeratorsWanted() + " (session " + sess.ID + ")")
+	select {
+	case <-sess.Ready():
+		return true
+	case <-sess.Done():
+		return false
+	case <-time.After(moderatorWait):
+		sess.Terminate("moderators did not join")
+		return false
+	}
+}
+
+// bridgeForward relays a direct-tcpip channel (ssh -L, IDE remote
+// plugins) opened on the inner hop, if the role policy allows the
+// destination.
+func (t *target) bridgeForward(nch ssh.NewChannel) {
+	var dest directTCPIP
+	if err := ssh.Unmarshal(nch.ExtraData(), &dest); err != nil {
+		nch.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+		return
+	}
+	user := t.id.user
+	roleIDs, err := locks.RoleIDs(t.s.db, user.OrgID, user.ID)
+	if err != nil {
+		nch.Reject(ssh.Prohibited, "lock check failed")
+		return
+	}
+	pol, err := session.LoadPolicy(t.s.db, roleIDs, t.res)
+	if err != nil || !pol.AllowsForward(dest.DestHost, int(dest.DestPort)) {
+		nch.Reject(ssh.Prohibited, "forwarding to this destination is not allowed for your roles")
+		return
+	}
+
+	addr := net.JoinHostPort(dest.DestHost, strconv.Itoa(int(dest.DestPort)))
+	remote, err := t.client.Dial("tcp", addr)
+	if err != nil {
+		nch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer remote.Close()
+	ch, reqs, err := nch.Accept()
+	if err != nil {
+		return
+	}
+	defer ch.Close()
+	go ssh.DiscardRequests(reqs)
+
+	meta := map[string]interface{}{
+		"host":        t.res.Host,
+		"login":       t.login,
+		"destination": addr,
+		"via":         "ssh_proxy",
+	}
+	t.s.audit(user, t.clientIP, "port_forward.start", t.res.ID, meta)
+	start := time.Now()
+
+	var sent, received int64
+	done := make(chan struct{})
+	go func() {
+		sent, _ = io.Copy(remote, ch)
+		if cw, ok := remote.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+		close(done)
+	}()
+	received, _ = io.Copy(ch, remote)
+	_ = ch.CloseWrite()
+	<-done
+
+	meta["bytes_sent"] = sent
+	meta["bytes_received"] = received
+	meta["duration_ms"] = time.Since(start).Milliseconds()
+	t.s.audit(user, t.clientIP, "port_forward.end", t.res.ID, meta)
+}
+
+// partyInput writes client input through the session so observers,
+// moderation pauses and byte counts apply.
+type partyInput struct {
+	sess  *session.Session
+	party *session.Party
+}
+
+func (p partyInput) Write(b []byte) (int, error) {
+	if err := p.sess.WriteInput(p.party, b); err != nil && err != session.ErrNotRunning {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// channelConn is the owner's SSH channel as a session.Conn.
+type channelConn struct{ ssh.Channel }
+
+func (c channelConn) Notify(msg string) error {
+	_, err := c.Stderr().Write([]byte("\r\n[" + msg + "]\r\n"))
+	return err
+}
+
+func (c channelConn) Exit(status int, signal string) error {
+	if signal != "" {
+		_, err := c.SendRequest("exit-signal", false, ssh.Marshal(struct {
+			Signal     string
+			CoreDumped bool
+			Error      string
+			Lang       string
+		}{Signal: signal}))
+		return err
+	}
+	_, err := c.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+	return err
+}
+
+// channelTerminal sends resize and signal requests to the resource.
+type channelTerminal struct{ ssh.Channel }
+
+func (t channelTerminal) Resize(cols, rows int) error {
+	_, err := t.SendRequest("window-change", false, ssh.Marshal(struct {
+		Cols, Rows, Width, Height uint32
+	}{uint32(cols), uint32(rows), 0, 0}))
+	return err
+}
+
+func (t channelTerminal) Signal(name string) error {
+	_, err := t.SendRequest("signal", false, ssh.Marshal(struct{ Signal string }{name}))
+	return err
+}
@@ -0,0 +1,143 @@
+package tunnel
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
+)
+
+// Agent is the host side of a tunnel: it dials the controller and serves
+// the direct-tcpip channels the controller opens, to loopback only.
+type Agent struct {
+	ControllerURL string
+	Signer        ssh.Signer
+	// Token returns the current agent token.
+	Token func() string
+	// HostKeyFile pins the controller's key on first connect.
+	HostKeyFile string
+	// Local serves connections to these loopback ports in process instead
+	// of dialing them, e.g. the agent's own SSH server.
+	Local map[uint32]func(net.Conn)
+}
+
+// Run keeps the tunnel up, reconnecting with backoff. It never returns.
+func (a *Agent) Run() {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := a.runOnce()
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Printf("⚠️ tunnel disconnected: %v (retrying in %s)", err, backoff)
+		time.Sleep(backoff)
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
+
+func (a *Agent) runOnce() error {
+	u, err := url.Parse(strings.TrimRight(a.ControllerURL, "/") + "/agents/tunnel")
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+a.Token())
+	ws, _, err := websocket.DefaultDialer.Dial(u.String(), header)
+	if err != nil {
+		return err
+	}
+	nc := NetConn(ws)
+	defer nc.Close()
+
+	conn, chans, reqs, err := ssh.NewClientConn(nc, u.Host, &ssh.ClientConfig{
+		User:            "agent",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(a.Signer)},
+		HostKeyCallback: a.checkHostKey,
+		Timeout:         15 * time.Second,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+	log.Printf("🔌 tunnel connected to %s", u.Host)
+
+	for nch := range chans {
+		if nch.ChannelType() != "direct-tcpip" {
+			nch.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		go a.serveDirect(conn, nch)
+	}
+	return conn.Wait()
+}
+
+// checkHostKey trusts the controller key seen first and refuses any other
+// afterwards. Delete HostKeyFile after rotating the controller's key.
+func (a *Agent) checkHostKey(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	seen := ssh.MarshalAuthorizedKey(key)
+	pinned, err := os.ReadFile(a.HostKeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return os.WriteFile(a.HostKeyFile, seen, 0600)
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bytes.TrimSpace(pinned), bytes.TrimSpace(seen)) {
+		return errors.New("controller host key changed, refusing tunnel (see " + a.HostKeyFile + ")")
+	}
+	return nil
+}
+
+// serveDirect connects a controller channel to a loopback port on this
+// host, normally the SSH server.
+func (a *Agent) serveDirect(conn ssh.Conn, nch ssh.NewChannel) {
+	var dest DirectTCPIP
+	if err := ssh.Unmarshal(nch.ExtraData(), &dest); err != nil {
+		nch.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+		return
+	}
+	if ip := net.ParseIP(dest.DestHost); dest.DestHost != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		nch.Reject(ssh.Prohibited, "tunnel only reaches loopback addresses")
+		return
+	}
+	if serve := a.Local[dest.DestPort]; serve != nil {
+		ch, reqs, err := nch.Accept()
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		serve(ChanConn(ch, conn.LocalAddr(), conn.RemoteAddr()))
+		return
+	}
+	local, err := net.DialTimeout("tcp", net.JoinHostPort(dest.DestHost, strconv.Itoa(int(dest.DestPort))), 10*time.Second)
+	if err != nil {
+		nch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nch.Accept()
+	if err != nil {
+		local.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	Join(ch, local)
+}
@@ -0,0 +1,116 @@
+// Package tunnel is the shared part of the agent's reverse tunnel: the
+// agent runs an SSH client over a WebSocket to the controller's
+// /agents/tunnel, and the controller opens direct-tcpip channels back
+// through it to the host's own SSH port. Hosts behind NAT or without
+// inbound SSH can be reached this way.
+package tunnel
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/ssh"
+)
+
+// NetConn adapts a WebSocket to a net.Conn carrying a byte stream in
+// binary messages, so an SSH connection can run over it.
+func NetConn(ws *websocket.Conn) net.Conn {
+	return &wsConn{ws: ws}
+}
+
+type wsConn struct {
+	ws *websocket.Conn
+	r  io.Reader
+	mu sync.Mutex
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.r == nil {
+			mt, r, err := c.ws.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			if mt != websocket.BinaryMessage {
+				continue
+			}
+			c.r = r
+		}
+		n, err := c.r.Read(b)
+		if err == io.EOF {
+			c.r = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) Close() error                       { return c.ws.Close() }
+func (c *wsConn) LocalAddr() net.Addr                { return c.ws.LocalAddr() }
+func (c *wsConn) RemoteAddr() net.Addr               { return c.ws.RemoteAddr() }
+func (c *wsConn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *wsConn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+// DirectTCPIP is the payload of a direct-tcpip channel open (RFC 4254 7.2).
+type DirectTCPIP struct {
+	DestHost string
+	DestPort uint32
+	OrigHost string
+	OrigPort uint32
+}
+
+// ChanConn adapts an SSH channel to a net.Conn. Deadlines are not
+// supported.
+func ChanConn(ch ssh.Channel, local, remote net.Addr) net.Conn {
+	return chanConn{Channel: ch, local: local, remote: remote}
+}
+
+type chanConn struct {
+	ssh.Channel
+	local, remote net.Addr
+}
+
+func (c chanConn) LocalAddr() net.Addr                { return c.local }
+func (c chanConn) RemoteAddr() net.Addr               { return c.remote }
+func (c chanConn) SetDeadline(t time.Time) error      { return nil }
+func (c chanConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c chanConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// Join copies between ch and nc in both directions until both are done,
+// then closes them.
+func Join(ch ssh.Channel, nc net.Conn) {
+	done := make(chan struct{})
+	go func() {
+		io.Copy(nc, ch)
+		if tc, ok := nc.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(ch, nc)
+	ch.CloseWrite()
+	<-done
+	ch.Close()
+	nc.Close()
+}
@@ -41,6 +41,10 @@ document.addEventListener("DOMContentLoaded", async () => {
     loadTable("/api/v1/roles", "rolesTable", 4);
     loadTable("/api/v1/resources", "resourcesTable", 4);
     loadResourcesChart();
+    // terminate buttons depend on the caller's permissions
+    loadCurrentUser().then(loadActiveSessions);
+    const refreshSessions = document.getElementById("refreshSessions");
+    if (refreshSessions) refreshSessions.addEventListener("click", loadActiveSessions);
   }
 
   // Users loaders
@@ -56,8 +60,12 @@ document.addEventListener("DOMContentLoaded", async () => {
   if (onResources) {
     console.log("🔌 Loading real local resources...");
     loadLocalResources();
+    loadCurrentUser().then(loadRegistrationTokens);
     setupAddResourceModal();
     setupNoAccessModal();
+    // Dashboard "Observe"/"Join" links land here with ?join=<session id>
+    const params = new URLSearchParams(window.location.search);
+    if (params.get("join")) joinSSH(params.get("join"), params.get("mode") || "observer");
   }
 
   // Audit page handlers
@@ -547,12 +555,20 @@ async function loadLocalResources() {
   const grid = document.getElementById("resourcesGrid");
   if (!grid) return;
 
+  const statusFilter = document.getElementById("resourceStatusFilter");
+  if (statusFilter && !statusFilter.dataset.bound) {
+    statusFilter.dataset.bound = "1";
+    statusFilter.addEventListener("change", loadLocalResources);
+  }
+  const status = statusFilter ? statusFilter.value : "";
+
   try {
-    const res = await fetch("/api/v1/resources", { credentials: "include" });
+    const url = "/api/v1/resources" + (status ? `?status=${encodeURIComponent(status)}` : "");
+    const res = await fetch(url, { credentials: "include" });
     const data = await res.json();
 
     if (!data.resources || data.resources.length === 0) {
-      grid.innerHTML = `<p class="text-slate-400 text-center">No local resources found</p>`;
+      grid.innerHTML = `<p class="text-slate-400 text-center">${status ? "No " + status + " resources" : "No local resources found"}</p>`;
       return;
     }
 
@@ -560,14 +576,18 @@ async function loadLocalResources() {
       .map((r) => {
         const osVersion = r.Metadata?.os || r.metadata?.os || "Unknown OS";
         const statusColor =
-          r.Status === "online" ? "text-green-600" : "text-red-600";
+          r.Status === "online" ? "text-green-600" : r.Status === "degraded" ? "text-amber-600" : r.Status === "agentless" ? "text-slate-600" : "text-red-600";
+        const update = r.update_status;
+        const updateNote = update && update.state !== "updated"
+          ? ` · <span class="${update.state === "pending" ? "text-amber-600" : "text-red-600"}" title="${update.error || ""}">update to ${update.to} ${update.state.replace("_", " ")}</span>`
+          : "";
 
         return `
           <div class="bg-white border border-slate-200 rounded-xl p-4 shadow-sm hover:shadow-md transition">
             <div class="flex items-center justify-between mb-2">
               <div>
                 <h3 class="text-slate-800 font-semibold">${r.Name}</h3>
-                <p class="text-xs text-slate-500">${r.Host}</p>
+                <p class="text-xs text-slate-500">${r.Host}${r.tunnel ? ' <span class="ml-1 px-1.5 py-0.5 rounded bg-slate-100 text-slate-600" title="Reached through the agent\'s reverse tunnel">tunnel</span>' : ""}</p>
               </div>
                   <div class="flex items-center gap-2">
                     <button class="px-3 py-1 bg-blue-600 hover:bg-blue-700 text-white text-xs rounded-lg connect-btn"
@@ -576,7 +596,7 @@ async function loadLocalResources() {
                     </button>
                   </div>
             </div>
-            <p class="text-xs text-slate-600">${osVersion}</p>
+            <p class="text-xs text-slate-600">${osVersion} · <span class="${statusColor}">${r.Status || "unknown"}</span>${r.agent_version ? " · agent " + r.agent_version : ""}${updateNote}</p>
           </div>
         `;
       })
@@ -591,7 +611,7 @@ async function loadLocalResources() {
           return;
         }
         const host = e.currentTarget.dataset.host;
-        await showUserSelectModal(host);
+        await showUserSelectModal(host, e.currentTarget.dataset.resourceId);
       });
     });
   } catch (err) {
@@ -601,7 +621,7 @@ async function loadLocalResources() {
 }
 
 // --------------------------- SELECT SSH USER MODAL --------------------------- //
-async function showUserSelectModal(host) {
+async function showUserSelectModal(host, resourceId) {
   const modal = document.getElementById("userModal");
   const select = document.getElementById("userSelect");
   const confirmBtn = document.getElementById("confirmUserSelect");
@@ -644,7 +664,7 @@ async function showUserSelectModal(host) {
     if (confirmBtn.disabled) return;
     const selectedUser = select.value;
     modal.classList.add("hidden");
-    openSSH(host, selectedUser);
+    openSSH(host, selectedUser, resourceId);
   };
 }
 
@@ -760,7 +780,7 @@ function ensureSSHState() {
           return;
         }
         const active = sshState.sessions.get(sshState.activeId);
-        if (active) openSSH(active.host, active.user);
+        if (active && active.host) openSSH(active.host, active.user, active.resourceId);
       });
     }
   }
@@ -821,8 +841,9 @@ function activateSSHSession(sessionId) {
 function closeSSHSession(sessionId) {
   const session = sshState.sessions.get(sessionId);
   if (!session) return;
+  session.closed = true;
   try {
-    if (session.ws) session.ws.close();
+    if (session.ws) session.ws.close(1000);
   } catch {}
   try {
     if (session.term && session.term.dispose) session.term.dispose();
@@ -857,7 +878,58 @@ function closeAllSSHSessions() {
   updateSSHEMptyState();
 }
 
-function openSSH(host, user) {
+function openSSH(host, user, resourceId) {
+  const proto = location.protocol === "https:" ? "wss" : "ws";
+  let url = `${proto}://${location.host}/api/v1/ws/ssh?host=${encodeURIComponent(
+    host
+  )}&port=22&user=${encodeURIComponent(user)}`;
+  if (resourceId) url += `&resource_id=${encodeURIComponent(resourceId)}`;
+
+  openTerminalTab({
+    label: `${user}@${host}`,
+    url,
+    host,
+    user,
+    resourceId,
+    onOpen: (ws, term) => {
+      const cols = term.cols || 120;
+      const rows = term.rows || 32;
+      ws.send(JSON.stringify({ op: "auth", cols, rows, proto: "framed" }));
+    },
+  });
+}
+
+// joinSSH attaches to another user's live session as an observer, peer or
+// moderator. Moderator tabs get a button to terminate the session.
+function joinSSH(sessionId, mode) {
+  const proto = location.protocol === "https:" ? "wss" : "ws";
+  const url = `${proto}://${location.host}/api/v1/ws/ssh/join?session_id=${encodeURIComponent(
+    sessionId
+  )}&mode=${encodeURIComponent(mode)}&proto=framed`;
+
+  const icons = { peer: "👥", moderator: "🛡", observer: "👁" };
+  openTerminalTab({
+    label: `${icons[mode] || icons.observer} ${sessionId.slice(0, 8)}`,
+    url,
+    readOnly: mode !== "peer",
+    onTerminate:
+      mode === "moderator"
+        ? async () => {
+            if (!confirm("Terminate this session for everyone?")) return;
+            const resp = await fetch(`/api/v1/sessions/${encodeURIComponent(sessionId)}/terminate`, {
+              method: "POST",
+              credentials: "include",
+            });
+            if (!resp.ok) {
+              const data = await resp.json().catch(() => ({}));
+              alert("Failed to terminate: " + (data.error || resp.statusText));
+            }
+          }
+        : null,
+  });
+}
+
+function openTerminalTab({ label, url, host, user, resourceId, readOnly, onOpen, onTerminate }) {
   if (!ensureSSHState()) {
     alert("SSH modal not available.");
     return;
@@ -867,7 +939,6 @@ function openSSH(host, user) {
   updateSSHEMptyState();
 
   const sessionId = `ssh-${Date.now()}-${++sshState.seq}`;
-  const label = `${user}@${host}`;
 
   const tab = document.createElement("div");
   tab.className =
@@ -883,6 +954,17 @@ function openSSH(host, user) {
     e.stopPropagation();
     closeSSHSession(sessionId);
   });
+  if (onTerminate) {
+    const stopBtn = document.createElement("button");
+    stopBtn.className = "text-red-500 hover:text-red-700 text-xs leading-none";
+    stopBtn.title = "Terminate session";
+    stopBtn.innerHTML = "⛔";
+    stopBtn.addEventListener("click", (e) => {
+      e.stopPropagation();
+      onTerminate();
+    });
+    tab.appendChild(stopBtn);
+  }
   tab.appendChild(closeBtn);
   if (sshState.tabList) sshState.tabList.appendChild(tab);
 
@@ -897,8 +979,9 @@ function openSSH(host, user) {
   }
 
   const term = new Terminal({
-    cursorBlink: true,
+    cursorBlink: !readOnly,
     convertEol: true,
+    disableStdin: !!readOnly,
     fontFamily: "ui-monospace, SFMono-Regular, Menlo, Monaco, Consolas, monospace",
     fontSize: 14,
     theme: { background: "#0b1221", foreground: "#e5e7eb" },
@@ -909,45 +992,96 @@ function openSSH(host, user) {
   term.open(container);
   fit.fit();
 
-  const proto = location.protocol === "https:" ? "wss" : "ws";
-  const url = `${proto}://${location.host}/api/v1/ws/ssh?host=${encodeURIComponent(
-    host
-  )}&port=22&user=${encodeURIComponent(user)}`;
+  const entry = {
+    id: sessionId,
+    host,
+    user,
+    resourceId,
+    tabEl: tab,
+    containerEl: container,
+    term,
+    fit,
+    ws: null,
+    closed: false,
+  };
+  sshState.sessions.set(sessionId, entry);
 
-  const ws = new WebSocket(url);
-  ws.binaryType = "arraybuffer";
+  // resume holds the server session id and token once the server sends
+  // them; received counts output bytes so a resume replays only the rest.
+  let resume = null;
+  let received = 0;
+  let retries = 0;
 
-  ws.onopen = () => {
-    const cols = term.cols || 120;
-    const rows = term.rows || 32;
-    ws.send(JSON.stringify({ op: "auth", cols, rows }));
+  const sendControl = (msg) => {
+    if (entry.ws && entry.ws.readyState === WebSocket.OPEN) entry.ws.send(JSON.stringify(msg));
   };
 
-  ws.onmessage = (ev) => {
-    if (ev.data instanceof ArrayBuffer) term.write(new Uint8Array(ev.data));
-    else term.write(String(ev.data));
+  const connect = (wsUrl, first) => {
+    const ws = new WebSocket(wsUrl);
+    ws.binaryType = "arraybuffer";
+    entry.ws = ws;
+
+    ws.onopen = () => {
+      retries = 0;
+      if (first && onOpen) onOpen(ws, term);
+      if (!first) sendControl({ op: "resize", cols: term.cols, rows: term.rows });
+    };
+
+    // Framed protocol: binary frames are terminal data, text frames are
+    // JSON control messages.
+    ws.onmessage = (ev) => {
+      if (ev.data instanceof ArrayBuffer) {
+        received += ev.data.byteLength;
+        term.write(new Uint8Array(ev.data));
+        return;
+      }
+      let msg;
+      try {
+        msg = JSON.parse(ev.data);
+      } catch {
+        term.write(String(ev.data));
+        return;
+      }
+      if (msg.op === "session") {
+        resume = { id: msg.session_id, token: msg.resume_token };
+      } else if (msg.op === "notice") {
+        term.write(`\r\n\x1b[33m[${msg.message}]\x1b[0m\r\n`);
+      } else if (msg.op === "exit") {
+        resume = null;
+        const how = msg.signal ? `killed by signal ${msg.signal}` : `exit status ${msg.status}`;
+        term.write(`\r\n\x1b[33m[${how}]\x1b[0m\r\n`);
+      } else if (msg.op === "error") {
+        term.write(`\r\n\x1b[31m[${msg.message}]\x1b[0m\r\n`);
+      }
+    };
+
+    // A normal close means the session ended. Anything else is a network
+    // problem, so owners try to resume while the server keeps the session.
+    ws.onclose = (ev) => {
+      if (entry.closed) return;
+      if (resume && ev.code !== 1000 && retries < 24) {
+        if (retries === 0) term.write("\r\n\x1b[33m[Connection lost, reconnecting...]\x1b[0m\r\n");
+        retries++;
+        const proto = location.protocol === "https:" ? "wss" : "ws";
+        const resumeUrl = `${proto}://${location.host}/api/v1/ws/ssh/resume?session_id=${encodeURIComponent(
+          resume.id
+        )}&token=${encodeURIComponent(resume.token)}&offset=${received}`;
+        setTimeout(() => !entry.closed && connect(resumeUrl, false), 5000);
+        return;
+      }
+      clearInterval(keepalive);
+      term.write("\r\n\x1b[33m[Disconnected]\x1b[0m\r\n");
+    };
   };
 
-  ws.onclose = () =>
-    term.write("\r\n\x1b[33m[Disconnected]\x1b[0m\r\n");
-  ws.onerror = () =>
-    term.write("\r\n\x1b[31m[WebSocket error]\x1b[0m\r\n");
+  const keepalive = setInterval(() => sendControl({ op: "ping" }), 30000);
+  connect(url, true);
 
   term.onData((data) => {
-    if (ws.readyState === WebSocket.OPEN)
-      ws.send(new TextEncoder().encode(data));
-  });
-
-  sshState.sessions.set(sessionId, {
-    id: sessionId,
-    host,
-    user,
-    tabEl: tab,
-    containerEl: container,
-    term,
-    fit,
-    ws,
+    if (!readOnly && entry.ws && entry.ws.readyState === WebSocket.OPEN)
+      entry.ws.send(new TextEncoder().encode(data));
   });
+  term.onResize(({ cols, rows }) => sendControl({ op: "resize", cols, rows }));
 
   activateSSHSession(sessionId);
   updateSSHEMptyState();
@@ -992,7 +1126,15 @@ function setupAddResourceModal() {
     }
 
     const ttl = ttlInput ? parseInt(ttlInput.value || '0', 10) : 0;
-    const payload = { resource_id: null, ttl_minutes: Number.isFinite(ttl) ? ttl : 0 };
+    const maxUses = parseInt(document.getElementById('addGenTokenMaxUses')?.value || '1', 10);
+    const payload = {
+      resource_id: null,
+      ttl_minutes: Number.isFinite(ttl) ? ttl : 0,
+      description: document.getElementById('addGenTokenDescription')?.value || '',
+      labels: document.getElementById('addGenTokenLabels')?.value || '',
+      allowed_types: document.getElementById('addGenTokenTypes')?.value || '',
+      max_uses: Number.isFinite(maxUses) ? maxUses : 1,
+    };
 
     try {
       createBtn.disabled = true;
@@ -1018,6 +1160,7 @@ function setupAddResourceModal() {
         return;
       }
 
+      loadRegistrationTokens();
       const tokenText = data.token || data.Token || '';
       if (resultVal) resultVal.textContent = tokenText;
       if (resultWrap) resultWrap.classList.remove('hidden');
@@ -1060,6 +1203,66 @@ function setupAddResourceModal() {
 
 }
 
+// --------------------------- REGISTRATION TOKENS --------------------------- //
+async function loadRegistrationTokens() {
+  const section = document.getElementById("registrationTokensSection");
+  const table = document.getElementById("registrationTokensTable");
+  if (!section || !table) return;
+  if (!(window.currentUserPermissions || []).includes("resources:generate-token")) return;
+  section.classList.remove("hidden");
+
+  const refresh = document.getElementById("refreshRegistrationTokens");
+  if (refresh && !refresh.dataset.bound) {
+    refresh.dataset.bound = "1";
+    refresh.addEventListener("click", loadRegistrationTokens);
+  }
+
+  try {
+    const res = await fetch("/api/v1/agents/tokens", { credentials: "include" });
+    const data = await res.json();
+    const tokens = data.tokens || [];
+    if (tokens.length === 0) {
+      table.innerHTML = `<tr><td colspan="8" class="py-4 text-center text-slate-400">No registration tokens</td></tr>`;
+      return;
+    }
+
+    const stateColor = { active: "text-green-600", expired: "text-slate-500", exhausted: "text-slate-500", revoked: "text-red-600" };
+    table.innerHTML = tokens
+      .map((t) => `
+        <tr class="border-b last:border-0">
+          <td class="py-2 px-2 whitespace-nowrap font-mono text-slate-700">${t.prefix}…</td>
+          <td class="py-2 px-2 text-slate-700">${t.description || "-"}</td>
+          <td class="py-2 px-2 text-slate-700">${t.labels || "-"}</td>
+          <td class="py-2 px-2 text-slate-700">${t.allowed_types || "any"}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-slate-700">${t.uses} / ${t.max_uses === 0 ? "∞" : t.max_uses}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-slate-700">${t.expires_at ? new Date(t.expires_at).toLocaleString() : "never"}</td>
+          <td class="py-2 px-2 whitespace-nowrap ${stateColor[t.state] || ""}">${t.state}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-right">
+            ${t.state === "active" ? `<button class="revoke-token-btn px-2 py-1 bg-red-600 hover:bg-red-700 text-white text-xs rounded" data-token-id="${t.id}">Revoke</button>` : ""}
+          </td>
+        </tr>`)
+      .join("");
+
+    table.querySelectorAll(".revoke-token-btn").forEach((btn) => {
+      btn.addEventListener("click", async () => {
+        if (!confirm("Revoke this registration token? Agents already registered keep working.")) return;
+        const resp = await fetch(`/api/v1/agents/tokens/${encodeURIComponent(btn.dataset.tokenId)}`, {
+          method: "DELETE",
+          credentials: "include",
+        });
+        if (!resp.ok) {
+          const data = await resp.json().catch(() => ({}));
+          alert("Failed to revoke: " + (data.error || resp.statusText));
+        }
+        loadRegistrationTokens();
+      });
+    });
+  } catch (err) {
+    console.error("Error loading registration tokens:", err);
+    table.innerHTML = `<tr><td colspan="8" class="py-4 text-red-500">Failed to load registration tokens</td></tr>`;
+  }
+}
+
 // --------------------------- GENERATE TOKEN MODAL --------------------------- //
 // previous standalone token modal removed — token UI is integrated into Add Resource modal
 
@@ -1313,6 +1516,81 @@ async function loadResourcesChart() {
   }
 }
 
+// --------------------------- DASHBOARD LIVE SESSIONS --------------------------- //
+function formatBytes(n) {
+  if (!n) return "0 B";
+  const units = ["B", "KB", "MB", "GB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return `${n.toFixed(i === 0 ? 0 : 1)} ${units[i]}`;
+}
+
+async function loadActiveSessions() {
+  const table = document.getElementById("sessionsTable");
+  if (!table) return;
+
+  try {
+    const res = await fetch("/api/v1/sessions/active", { credentials: "include" });
+    if (res.status === 403) {
+      table.innerHTML = `<tr><td colspan="7" class="py-4 text-slate-400">You don't have permission to view sessions.</td></tr>`;
+      return;
+    }
+    const data = await res.json();
+    const sessions = data.sessions || [];
+
+    if (sessions.length === 0) {
+      table.innerHTML = `<tr><td colspan="7" class="py-4 text-center text-slate-400">No live sessions</td></tr>`;
+      return;
+    }
+
+    const perms = window.currentUserPermissions || [];
+    const canTerminate = perms.includes("sessions:write");
+    const canJoin = perms.includes("sessions:join");
+    table.innerHTML = sessions
+      .map((s) => `
+        <tr class="border-b last:border-0">
+          <td class="py-2 px-2 whitespace-nowrap text-slate-700">${s.user_email || s.user_id}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-slate-700">${s.resource_name || s.host}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-slate-700">${s.login}${s.state && s.state !== "running" ? ` <span class="ml-1 px-1.5 py-0.5 rounded bg-amber-100 text-amber-700 text-xs">${s.state}</span>` : ""}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-slate-700">${s.client_ip || "-"}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-slate-700">${new Date(s.started_at).toLocaleString()}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-slate-700">${formatBytes(s.bytes_in)} / ${formatBytes(s.bytes_out)}</td>
+          <td class="py-2 px-2 whitespace-nowrap text-right space-x-1">
+            ${canJoin ? `<a class="px-2 py-1 bg-slate-100 hover:bg-slate-200 text-slate-700 text-xs rounded" href="/resources?join=${encodeURIComponent(s.id)}&mode=observer">Observe</a>
+            <a class="px-2 py-1 bg-blue-600 hover:bg-blue-700 text-white text-xs rounded" href="/resources?join=${encodeURIComponent(s.id)}&mode=peer">Join</a>
+            ${(s.moderators || []).length ? `<a class="px-2 py-1 bg-amber-500 hover:bg-amber-600 text-white text-xs rounded" href="/resources?join=${encodeURIComponent(s.id)}&mode=moderator">Moderate</a>` : ""}` : ""}
+            ${canTerminate ? `<button class="terminate-session-btn px-2 py-1 bg-red-600 hover:bg-red-700 text-white text-xs rounded" data-session-id="${s.id}">Terminate</button>` : ""}
+          </td>
+        </tr>`)
+      .join("");
+
+    table.querySelectorAll(".terminate-session-btn").forEach((btn) => {
+      btn.addEventListener("click", async () => {
+        if (!confirm("Terminate this session?")) return;
+        try {
+          const resp = await fetch(`/api/v1/sessions/${encodeURIComponent(btn.dataset.sessionId)}`, {
+            method: "DELETE",
+            credentials: "include",
+          });
+          if (!resp.ok) {
+            const data = await resp.json().catch(() => ({}));
+            alert("Failed to terminate: " + (data.error || resp.statusText));
+          }
+        } catch (err) {
+          console.error("Terminate session failed", err);
+        }
+        loadActiveSessions();
+      });
+    });
+  } catch (err) {
+    console.error("Failed to load live sessions:", err);
+    table.innerHTML = `<tr><td colspan="7" class="py-4 text-red-500">Failed to load sessions</td></tr>`;
+  }
+}
+
 //Snippet
 document.addEventListener("DOMContentLoaded", () => {
   // Detect controller URL automatically